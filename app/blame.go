@@ -0,0 +1,58 @@
+package app
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+	"github.com/miniclip/gonsul/internal/exporter"
+	"github.com/miniclip/gonsul/internal/util"
+
+	"github.com/olekukonko/tablewriter"
+
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+type Iblame interface {
+	RunBlame()
+}
+
+type blame struct {
+	config   config.IConfig
+	logger   util.ILogger
+	exporter exporter.IExporter
+}
+
+func NewBlame(config config.IConfig, logger util.ILogger, exporter exporter.IExporter) Iblame {
+	return &blame{
+		config:   config,
+		logger:   logger,
+		exporter: exporter,
+	}
+}
+
+// RunBlame is our entry point function for the Blame Application mode, it prints
+// where the given Consul KV path is exported from, without touching Consul
+func (a *blame) RunBlame() {
+	a.logger.PrintInfo("Starting in mode: BLAME")
+
+	kvPath := a.config.GetBlameKey()
+	origins := a.exporter.Blame(kvPath)
+	if len(origins) == 0 {
+		util.ExitError(errors.New("BLAME: no file exports the key: "+kvPath), util.ErrorKeyNotFound, a.logger)
+	}
+
+	// Our table is redacted before being printed, as any other output
+	output := &bytes.Buffer{}
+	table := tablewriter.NewWriter(output)
+	table.SetHeader([]string{"KEY", "MOUNT", "FILE", "DOCUMENT PATH", "COMMIT", "AUTHOR", "DATE", "MESSAGE"})
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	for _, origin := range origins {
+		row := []string{origin.KVPath, origin.Mount, origin.File, origin.DocumentPath, "", "", "", ""}
+		if origin.Commit != nil {
+			row[4], row[5], row[6], row[7] = origin.Commit.SHA, origin.Commit.Author, origin.Commit.Date, origin.Commit.Message
+		}
+		table.Append(row)
+	}
+	table.Render()
+	fmt.Print(a.logger.Redact(output.String()))
+}
@@ -0,0 +1,50 @@
+package app
+
+import (
+	"github.com/miniclip/gonsul/internal/entities"
+	"github.com/miniclip/gonsul/internal/util"
+
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+
+	"testing"
+)
+
+func TestBlame_RunBlame(t *testing.T) {
+	RegisterTestingT(t)
+
+	// Create our mocks and our Blame mode
+	cfg, log, exp, _ := getCommonMocks()
+	blame := NewBlame(cfg, log, exp)
+
+	origins := []entities.KeyOrigin{{
+		KVPath:       "config/app/db/host",
+		Mount:        "default",
+		File:         "app.json",
+		DocumentPath: "db/host",
+		Commit:       &entities.CommitInfo{Mount: "default", SHA: "4b825dc642cb6eb9a060e54bf8d69288fbee4904"},
+	}}
+
+	// Create our assertions
+	cfg.On("GetBlameKey").Return("config/app/db/host")
+	log.On("PrintInfo", mock.Anything).Return()
+	log.On("Redact", mock.Anything).Return(func(msg string) string { return msg })
+	exp.On("Blame", "config/app/db/host").Return(origins)
+
+	// Run our application mode
+	blame.RunBlame()
+
+	// Create our expectations
+	Expect(exp.AssertExpectations(t)).To(BeTrue(), "Assert Exporter Blame")
+	Expect(exp.AssertNumberOfCalls(t, "Blame", 1))
+
+	// Keys no file exports are reported as an error
+	cfg, log, exp, _ = getCommonMocks()
+	blame = NewBlame(cfg, log, exp)
+	cfg.On("GetBlameKey").Return("config/missing")
+	log.On("PrintInfo", mock.Anything).Return()
+	log.On("PrintError", mock.Anything).Return()
+	exp.On("Blame", "config/missing").Return([]entities.KeyOrigin{})
+
+	Expect(func() { blame.RunBlame() }).To(PanicWith(util.GonsulError{Code: util.ErrorKeyNotFound}))
+}
@@ -37,6 +37,11 @@ func (a *once) RunOnce() {
 		a.logger.PrintInfo("Starting in mode: ONCE")
 	}
 
+	// Verifying every commit since our last sync, tell the exporter which commits those were
+	if a.config.VerifyAllCommits() {
+		a.exporter.SetSyncedCommits(a.importer.GetSyncedCommits())
+	}
+
 	// Start our data export
 	a.logger.PrintDebug("Starting data retrieve from GIT")
 	exportedData := a.exporter.Start()
@@ -44,6 +49,6 @@ func (a *once) RunOnce() {
 
 	// Start data import to Consul
 	a.logger.PrintDebug("Starting data import to Consul")
-	a.importer.Start(exportedData)
+	a.importer.Start(exportedData, a.exporter.GetSkippedKeys(), a.exporter.GetEmptyKeys(), a.exporter.GetCommits())
 	a.logger.PrintDebug("Finished data import to Consul")
 }
@@ -2,6 +2,7 @@ package app
 
 import (
 	"github.com/miniclip/gonsul/internal/config"
+	"github.com/miniclip/gonsul/internal/entities"
 
 	. "github.com/onsi/gomega"
 	"github.com/stretchr/testify/mock"
@@ -24,10 +25,17 @@ func TestOnce_RunOnce(t *testing.T) {
 
 		// Create our assertions
 		cfg.On("GetStrategy").Return(mode)
+		cfg.On("VerifyAllCommits").Return(false)
 		log.On("PrintInfo", mock.Anything).Return()
 		log.On("PrintDebug", mock.Anything).Return()
+		commits := []entities.CommitInfo{{Mount: "default", SHA: "4b825dc642cb6eb9a060e54bf8d69288fbee4904"}}
 		exp.On("Start").Return(transitive)
-		imp.On("Start", transitive).Return()
+		skipped := map[string]bool{"skipped": true}
+		exp.On("GetCommits").Return(commits)
+		empty := map[string]bool{"empty": true}
+		exp.On("GetSkippedKeys").Return(skipped)
+		exp.On("GetEmptyKeys").Return(empty)
+		imp.On("Start", transitive, skipped, empty, commits).Return()
 
 		// Run our application mode
 		once.RunOnce()
@@ -43,3 +51,30 @@ func TestOnce_RunOnce(t *testing.T) {
 		Expect(imp.AssertNumberOfCalls(t, "Start", 1))
 	}
 }
+
+func TestOnce_RunOnce_VerifyAllCommits(t *testing.T) {
+	RegisterTestingT(t)
+
+	cfg, log, exp, imp := getCommonMocks()
+	once := NewOnce(cfg, log, exp, imp)
+
+	// Verifying every commit, the exporter learns what we synced last before exporting
+	synced := []entities.CommitInfo{{Mount: "default", SHA: "45a81b9041cfaff50b8da101579dd3cf15f6b3c2"}}
+	commits := []entities.CommitInfo{{Mount: "default", SHA: "4b825dc642cb6eb9a060e54bf8d69288fbee4904"}}
+	cfg.On("GetStrategy").Return(config.StrategyOnce)
+	cfg.On("VerifyAllCommits").Return(true)
+	log.On("PrintInfo", mock.Anything).Return()
+	log.On("PrintDebug", mock.Anything).Return()
+	imp.On("GetSyncedCommits").Return(synced)
+	exp.On("SetSyncedCommits", synced).Return()
+	exp.On("Start").Return(map[string]string{})
+	exp.On("GetCommits").Return(commits)
+	exp.On("GetSkippedKeys").Return(map[string]bool{})
+	exp.On("GetEmptyKeys").Return(map[string]bool{})
+	imp.On("Start", map[string]string{}, map[string]bool{}, map[string]bool{}, commits).Return()
+
+	once.RunOnce()
+
+	Expect(exp.AssertExpectations(t)).To(BeTrue(), "Assert synced commits are set")
+	Expect(imp.AssertExpectations(t)).To(BeTrue(), "Assert synced commits are read")
+}
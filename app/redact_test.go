@@ -0,0 +1,112 @@
+package app
+
+import (
+	"github.com/miniclip/gonsul/internal/entities"
+	"github.com/miniclip/gonsul/internal/secrets"
+	"github.com/miniclip/gonsul/internal/util"
+	"github.com/miniclip/gonsul/tests/mocks"
+
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureOutput returns everything the given function prints to stdout
+func captureOutput(fn func()) string {
+	reader, writer, _ := os.Pipe()
+	stdout := os.Stdout
+	os.Stdout = writer
+	defer func() {
+		os.Stdout = stdout
+	}()
+
+	fn()
+	_ = writer.Close()
+	output, _ := ioutil.ReadAll(reader)
+
+	return string(output)
+}
+
+func TestRedaction(t *testing.T) {
+	RegisterTestingT(t)
+
+	// Our fixture secrets, along with a provider one only known once looked up
+	content, err := ioutil.ReadFile("../tests/data/test-secrets-redaction.json")
+	Expect(err).To(BeNil())
+	values := map[string]string{}
+	Expect(json.Unmarshal(content, &values)).To(BeNil())
+	Expect(os.Setenv("GONSUL_REDACT_TOKEN", "env-t0ken-value")).To(BeNil())
+	defer os.Unsetenv("GONSUL_REDACT_TOKEN")
+	fixture := secrets.NewSecrets(values, map[string]secrets.IProvider{"env": secrets.NewEnvProvider("GONSUL_REDACT_")})
+	_, found, err := fixture.Lookup("env.TOKEN")
+	Expect(found).To(BeTrue())
+	Expect(err).To(BeNil())
+
+	logger := util.NewLogger(util.LogLevelDebug)
+	logger.SetSecrets(fixture.Values)
+
+	// Every secret in any form, on every output channel
+	var leaks []string
+	for _, secret := range append(fixture.Values(), "env-t0ken-value") {
+		escaped, _ := json.Marshal(secret)
+		leaks = append(leaks, secret, string(escaped), base64.StdEncoding.EncodeToString([]byte(secret)))
+		// As exported documents escape them
+		leaks = append(leaks, html.EscapeString(secret), strings.Replace(secret, "'", "''", -1))
+		leaks = append(leaks, strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(secret))
+	}
+	message := "connecting with " + strings.Join(leaks, " and ")
+
+	output := captureOutput(func() {
+		logger.PrintError(message)
+		logger.PrintInfo(message)
+		logger.PrintDebug(message)
+
+		// Tables
+		cfg, _, exp, _ := getCommonMocks()
+		cfg.On("GetBlameKey").Return("config/app/db")
+		exp.On("Blame", "config/app/db").Return([]entities.KeyOrigin{{KVPath: "config/app/db", Mount: "default", File: "app.json", DocumentPath: values["db-password"]}})
+		NewBlame(cfg, logger, exp).RunBlame()
+	})
+
+	// HTTP responses
+	once := &mocks.Ionce{}
+	once.On("RunOnce").Run(func(args mock.Arguments) {
+		logger.AddMessage("config/" + values["api-key"])
+		util.ExitError(errors.New(message), util.ErrorDeleteNotAllowed, logger)
+	}).Return()
+	hook := NewHook(&mocks.IHookHttp{}, nil, logger, once).(*hook)
+	response := httptest.NewRecorder()
+	output += captureOutput(func() {
+		hook.httpHandler(response, httptest.NewRequest(http.MethodGet, "/v1/run", nil))
+	})
+	for name, header := range response.Header() {
+		output += name + ": " + strings.Join(header, ",") + "\n"
+	}
+	output += response.Body.String()
+
+	Expect(output).To(ContainSubstring(util.Redacted))
+	Expect(output).To(ContainSubstring("DOCUMENT PATH"))
+	for _, secret := range fixture.Values() {
+		if len(secret) < 4 {
+			continue
+		}
+		for _, line := range strings.Split(secret, "\n") {
+			Expect(output).NotTo(ContainSubstring(line), "Assert no secret is output")
+		}
+		Expect(output).NotTo(ContainSubstring(html.EscapeString(secret)), "Assert no HTML escaped secret is output")
+		Expect(output).NotTo(ContainSubstring(strings.Replace(secret, "'", "''", -1)), "Assert no YAML single quoted secret is output")
+	}
+	Expect(strings.Count(output, "shorter than 4 characters")).To(Equal(1), "Assert short values are warned about once")
+	Expect(output).NotTo(ContainSubstring("env-t0ken-value"))
+	Expect(output).To(ContainSubstring(" on "), "Assert short values are left alone")
+}
@@ -0,0 +1,83 @@
+package app
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+	"github.com/miniclip/gonsul/internal/exporter"
+	"github.com/miniclip/gonsul/internal/secrets"
+	"github.com/miniclip/gonsul/internal/util"
+
+	"errors"
+	"fmt"
+	"sort"
+)
+
+type Ivalidate interface {
+	RunValidate()
+}
+
+type validate struct {
+	config   config.IConfig
+	logger   util.ILogger
+	exporter exporter.IExporter
+}
+
+func NewValidate(config config.IConfig, logger util.ILogger, exporter exporter.IExporter) Ivalidate {
+	return &validate{
+		config:   config,
+		logger:   logger,
+		exporter: exporter,
+	}
+}
+
+// RunValidate is our entry point function for the Validate Application mode, it runs our
+// whole export pipeline on local files, reporting every error found, without touching Consul
+func (a *validate) RunValidate() {
+	a.logger.PrintInfo("Starting in mode: VALIDATE")
+
+	// HEADS UP: Below function will exit program, listing every error found, if any
+	localData := a.exporter.Start()
+
+	// Make sure our secrets placeholders can be rendered (our exporter did, if it rendered them)
+	var failures []string
+	if a.config.DoSecrets() && a.config.GetSecretsStage() == config.SecretsStageImport {
+		values := make([]string, 0, len(localData))
+		for kvPath, value := range localData {
+			failures = append(failures, a.checkPlaceholders(kvPath, value)...)
+			values = append(values, value)
+		}
+		if a.config.IsSecretsStrict() {
+			for _, name := range a.config.GetSecrets().Unused(values) {
+				failures = append(failures, fmt.Sprintf("VALIDATE: unused secret: %s", name))
+			}
+		}
+	}
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		for _, failure := range failures {
+			a.logger.PrintError(failure)
+		}
+		util.ExitError(errors.New(fmt.Sprintf("VALIDATE: %d errors found", len(failures))), util.ErrorFailedMustache, a.logger)
+	}
+
+	a.logger.PrintInfo(fmt.Sprintf("VALIDATE: %d keys are valid", len(localData)))
+}
+
+// checkPlaceholders makes sure the given value is a valid mustache template, whose
+// placeholders are all found on our secrets
+func (a *validate) checkPlaceholders(kvPath string, value string) []string {
+	if _, err := secrets.Placeholders(value); err != nil {
+		return []string{fmt.Sprintf("VALIDATE: %s: invalid placeholder: %s", kvPath, err.Error())}
+	}
+
+	missing, err := a.config.GetSecrets().Missing(value)
+	if err != nil {
+		return []string{fmt.Sprintf("VALIDATE: %s: %s", kvPath, err.Error())}
+	}
+
+	var failures []string
+	for _, name := range missing {
+		failures = append(failures, fmt.Sprintf("VALIDATE: %s: unknown secret placeholder: %s", kvPath, name))
+	}
+
+	return failures
+}
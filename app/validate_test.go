@@ -0,0 +1,51 @@
+package app
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+	"github.com/miniclip/gonsul/internal/secrets"
+	"github.com/miniclip/gonsul/internal/util"
+
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+
+	"testing"
+)
+
+func TestValidate_RunValidate(t *testing.T) {
+	RegisterTestingT(t)
+
+	// Create our mocks and our Validate mode
+	cfg, log, exp, imp := getCommonMocks()
+	validate := NewValidate(cfg, log, exp)
+
+	// Create our assertions
+	cfg.On("DoSecrets").Return(true)
+	cfg.On("IsSecretsStrict").Return(false)
+	cfg.On("GetSecretsStage").Return(config.SecretsStageImport)
+	cfg.On("GetSecrets").Return(secrets.NewSecrets(map[string]string{"db-pass": "secret"}, nil))
+	log.On("PrintInfo", mock.Anything).Return()
+	exp.On("Start").Return(map[string]string{"app/db": `{"pass": "{{db-pass}}"}`, "app/name": "web"})
+
+	// Run our application mode
+	validate.RunValidate()
+
+	// Create our expectations, Consul is never touched
+	Expect(exp.AssertExpectations(t)).To(BeTrue(), "Assert Exporter Start")
+	Expect(imp.AssertNotCalled(t, "Start", mock.Anything, mock.Anything, mock.Anything, mock.Anything)).To(BeTrue())
+	log.AssertCalled(t, "PrintInfo", "VALIDATE: 2 keys are valid")
+
+	// Broken and unknown placeholders are all reported
+	cfg, log, exp, _ = getCommonMocks()
+	validate = NewValidate(cfg, log, exp)
+	cfg.On("DoSecrets").Return(true)
+	cfg.On("IsSecretsStrict").Return(false)
+	cfg.On("GetSecretsStage").Return(config.SecretsStageImport)
+	cfg.On("GetSecrets").Return(secrets.NewSecrets(map[string]string{"db-pass": "secret"}, nil))
+	log.On("PrintInfo", mock.Anything).Return()
+	log.On("PrintError", mock.Anything).Return()
+	exp.On("Start").Return(map[string]string{"app/db": "{{db-user}}:{{db-pass}}", "app/name": "{{#open}}"})
+
+	Expect(func() { validate.RunValidate() }).To(PanicWith(util.GonsulError{Code: util.ErrorFailedMustache}))
+	log.AssertCalled(t, "PrintError", "VALIDATE: app/db: unknown secret placeholder: db-user")
+	log.AssertNumberOfCalls(t, "PrintError", 3)
+}
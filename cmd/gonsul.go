@@ -31,8 +31,9 @@ func start() {
 		util.ExitError(err, util.ErrorBadParams, util.NewLogger(0))
 	}
 
-	// Build our logger
+	// Build our logger, which never outputs any of our secrets
 	logger := util.NewLogger(cfg.GetLogLevel())
+	logger.SetSecrets(cfg.GetSecrets().Values)
 
 	// Are we just printing the app version
 	if cfg.IsShowVersion() {
@@ -41,11 +42,23 @@ func start() {
 		return
 	}
 
+	// Are we just validating our local files
+	if cfg.IsValidating() {
+		app.NewValidate(cfg, logger, exporter.NewExporter(cfg, logger)).RunValidate()
+		return
+	}
+
+	// Are we just finding where a key comes from
+	if cfg.GetBlameKey() != "" {
+		app.NewBlame(cfg, logger, exporter.NewExporter(cfg, logger)).RunBlame()
+		return
+	}
+
 	// Build all dependencies for our application
 	hookHttpServer := app.NewHookHttp(cfg, logger)
 	httpClient := &http.Client{Timeout: time.Second * time.Duration(cfg.GetTimeout())}
 	exp := exporter.NewExporter(cfg, logger)
-	imp := importer.NewImporter(cfg, logger, httpClient)
+	imp := importer.NewImporter(cfg, logger, httpClient, app.Version)
 	sigChannel := make(chan os.Signal)
 	// Build our Applications
 	once := app.NewOnce(cfg, logger, exp, imp)
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Array expansion modes, how arrays found while expanding JSON/YAML files are written
+const ArraysJSON = "json"
+const ArraysIndexed = "indexed"
+const ArraysCSV = "csv"
+
+// validateArrayMode makes sure the given array expansion mode is a valid one
+func validateArrayMode(mode string) error {
+	if mode != ArraysJSON && mode != ArraysIndexed && mode != ArraysCSV {
+		return errors.New(fmt.Sprintf("array expansion mode (%s) is invalid, must be one of: %s, %s, %s", mode, ArraysJSON, ArraysIndexed, ArraysCSV))
+	}
+
+	return nil
+}
+
+// parseArrayModeRules parses our "file/pattern=mode,..." array expansion modes flag
+func parseArrayModeRules(rules string) ([]fileRule, error) {
+	return parseFileRules(rules, "array expansion mode", "mode", func(value string) (string, error) {
+		mode := strings.ToLower(value)
+		return mode, validateArrayMode(mode)
+	})
+}
+
+// GetArrayMode returns the array expansion mode of the given file, its path being
+// relative to the repository base path
+func (config *config) GetArrayMode(filePath string) string {
+	if mode, ok := matchFileRule(config.arrayModeRules, filePath); ok {
+		return mode
+	}
+
+	return config.arrayMode
+}
@@ -0,0 +1,26 @@
+package config
+
+import (
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestGetArrayMode(t *testing.T) {
+	RegisterTestingT(t)
+
+	rules, err := parseArrayModeRules("legacy/*.json=CSV,/hosts.yaml=indexed,legacy/app.json=indexed")
+	Expect(err).To(BeNil())
+
+	cfg := &config{arrayMode: ArraysJSON, arrayModeRules: rules}
+	Expect(cfg.GetArrayMode("legacy/app.json")).To(Equal(ArraysCSV), "Assert first matching rule wins")
+	Expect(cfg.GetArrayMode("hosts.yaml")).To(Equal(ArraysIndexed))
+	Expect(cfg.GetArrayMode("legacy/sub/app.json")).To(Equal(ArraysJSON), "Assert patterns do not cross directories")
+
+	// Invalid rules are refused
+	for _, invalid := range []string{"app.json", "=csv", "app.json=list", "[=csv"} {
+		rules, err = parseArrayModeRules(invalid)
+		Expect(err).To(Not(BeNil()), invalid)
+		Expect(rules).To(BeNil(), invalid)
+	}
+}
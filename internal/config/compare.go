@@ -0,0 +1,46 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Normalization rules, applied to both local and live values before comparing them
+const NormalizeLineEndings = "line-endings"
+const NormalizeTrailingNewline = "trailing-newline"
+
+// normalizations are all our known normalization rules
+var normalizations = []string{NormalizeLineEndings, NormalizeTrailingNewline}
+
+// parseNormalizations parses our comma separated list of normalization rules
+func parseNormalizations(list string) (map[string]bool, error) {
+	normalize := map[string]bool{}
+	if list == "" {
+		return normalize, nil
+	}
+
+	for _, rule := range strings.Split(list, ",") {
+		rule = strings.ToLower(strings.TrimSpace(rule))
+		known := false
+		for _, knownRule := range normalizations {
+			known = known || rule == knownRule
+		}
+		if !known {
+			return nil, errors.New(fmt.Sprintf("normalization (%s) is invalid, must be one of: %s", rule, strings.Join(normalizations, ", ")))
+		}
+		normalize[rule] = true
+	}
+
+	return normalize, nil
+}
+
+// ShouldNormalize tells if the given normalization rule applies to our values
+func (config *config) ShouldNormalize(rule string) bool {
+	return config.normalize[rule]
+}
+
+// IsCompareSemantic tells if JSON/YAML values are compared by their content instead of their bytes
+func (config *config) IsCompareSemantic() bool {
+	return config.compareSemantic
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"github.com/miniclip/gonsul/internal/secrets"
 	"github.com/miniclip/gonsul/internal/util"
 
 	"encoding/json"
@@ -17,6 +18,12 @@ const StrategyOnce = "ONCE"
 const StrategyPoll = "POLL"
 const StrategyHook = "HOOK"
 
+// CommandValidate is our validate command, checking local files without syncing them
+const CommandValidate = "validate"
+
+// CommandBlame is our blame command, finding where a Consul KV path is exported from
+const CommandBlame = "blame"
+
 type config struct {
 	shouldClone     bool
 	logLevel        int
@@ -28,17 +35,46 @@ type config struct {
 	repoRemoteName  string
 	repoBasePath    string
 	repoRootDir     string
+	repoCommit      string
+	sourceArchive   string
+	mounts          []Mount
+	gpgKeyring      string
+	sshSigners      string
+	verifyAll       bool
 	consulURL       string
 	consulACL       string
 	consulBasePath  string
+	consulStateKey  string
+	blameKey        string
+	validating      bool
 	expandJSON      bool
 	expandYAML      bool
+	expandFormats   map[string]bool
+	arrayMode       string
+	arrayModeRules  []fileRule
+	nullPolicy      string
+	expandStrict    bool
+	expandDepth     int
+	outputFormats   []fileRule
+	normalize       map[string]bool
+	compareSemantic bool
+	schemas         []fileRule
 	doSecrets       bool
-	secretsMap      map[string]string
+	secretsStrict   bool
+	secretsStage    string
+	secrets         secrets.ISecrets
+	encrypter       secrets.IEncrypter
+	encryptKeys     []string
+	encryptSecrets  bool
 	allowDeletes    string
 	pollInterval    int
 	Working         chan bool
 	validExtensions []string
+	templateExt     string
+	references      bool
+	overlayBase     string
+	overlays        []string
+	keyRules        keyRules
 	keepFileExt     bool
 	timeout         int
 	version         bool
@@ -57,17 +93,44 @@ type IConfig interface {
 	GetRepoRemoteName() string
 	GetRepoBasePath() string
 	GetRepoRootDir() string
+	GetRepoCommit() string
+	GetSourceArchive() string
+	GetMounts() []Mount
+	GetRepoGPGKeyring() string
+	GetRepoSSHAllowedSigners() string
+	VerifyAllCommits() bool
 	GetConsulURL() string
 	GetConsulACL() string
 	GetConsulBasePath() string
-	ShouldExpandJSON() bool
-	ShouldExpandYAML() bool
+	GetConsulStateKey() string
+	GetBlameKey() string
+	IsValidating() bool
+	ShouldExpand(format string) bool
+	GetArrayMode(filePath string) string
+	GetNullPolicy() string
+	IsExpandStrict() bool
+	GetExpandDepth() int
+	GetOutputFormat(filePath string) string
+	ShouldNormalize(rule string) bool
+	IsCompareSemantic() bool
+	GetSchemas(filePath string) []string
+	IsSchema(filePath string) bool
 	DoSecrets() bool
-	GetSecretsMap() map[string]string
+	IsSecretsStrict() bool
+	GetSecretsStage() string
+	GetSecrets() secrets.ISecrets
+	GetEncrypter() secrets.IEncrypter
+	ShouldEncrypt(key string, fromSecrets bool) bool
 	AllowDeletes() string
 	GetPollInterval() int
 	WorkingChan() chan bool
 	GetValidExtensions() []string
+	GetTemplateExt() string
+	DoReferences() bool
+	GetOverlayBase() string
+	GetOverlays() []string
+	RewriteKey(key string) string
+	ValidateKey(key string) error
 	KeepFileExt() bool
 	GetTimeout() int
 	IsShowVersion() bool
@@ -83,7 +146,7 @@ func NewConfig() (IConfig, error) {
 
 func buildConfig(flags ConfigFlags) (*config, error) {
 	// Set some local variable and some others defaulted
-	var secrets map[string]string
+	var secretsMap map[string]string
 	var err error
 	var clone = true
 	var doSecrets = false
@@ -95,12 +158,19 @@ func buildConfig(flags ConfigFlags) (*config, error) {
 		}, nil
 	}
 
-	// Make sure we have the mandatory flags set
-	if *flags.ConsulURL == "" || *flags.ValidExtensions == "" {
+	// Make sure we have the mandatory flags set, blaming a key or validating never talks to Consul
+	validating := flags.Command == CommandValidate
+	blaming := flags.Command == CommandBlame
+	if (*flags.ConsulURL == "" && !blaming && !validating) || *flags.ValidExtensions == "" {
 		flag.PrintDefaults()
 		return nil, errors.New("required flags not set")
 	}
 
+	// Blaming needs to know what to blame
+	if blaming && flags.BlameKey == "" {
+		return nil, errors.New("blame command requires a Consul KV path, as in: blame <path> [flags]")
+	}
+
 	// Set our valid extensions
 	extensions, err := setValidExtensions(*flags.ValidExtensions)
 	if err != nil {
@@ -126,19 +196,120 @@ func buildConfig(flags ConfigFlags) (*config, error) {
 		clone = false
 	}
 
+	// When syncing from an archive there is no repository at all
+	if *flags.SourceArchive != "" {
+		clone = false
+	}
+
+	// Make sure the formats to expand are properly given
+	expandFormats, err := parseExpandFormats(*flags.ExpandFormats)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure array expansion modes are properly given
+	arrayMode := strings.ToLower(*flags.ExpandArrays)
+	if err := validateArrayMode(arrayMode); err != nil {
+		return nil, err
+	}
+	arrayModeRules, err := parseArrayModeRules(*flags.ExpandArraysFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure null policy is properly given
+	nullPolicy := strings.ToLower(*flags.ExpandNulls)
+	if err := validateNullPolicy(nullPolicy); err != nil {
+		return nil, err
+	}
+
+	// Make sure expansion depth is properly given
+	if *flags.ExpandDepth < 0 {
+		return nil, errors.New("expansion depth must not be negative")
+	}
+
+	// Make sure output formats are properly given
+	outputFormatRules, err := parseOutputFormatRules(*flags.OutputFormats)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure normalization rules are properly given
+	normalize, err := parseNormalizations(*flags.Normalize)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure our key rewriting and validation rules are properly given
+	keyRules, err := parseKeyRules(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure our overlays are properly given
+	overlayBase, overlays, err := parseOverlays(*flags.OverlayBase, *flags.Overlays)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure schemas are properly given
+	schemas, err := parseSchemaRules(*flags.Schemas)
+	if err != nil {
+		return nil, err
+	}
+
 	// Make sure log level is properly set
 	errorLevel := util.ErrorLevels[strings.ToUpper(*flags.LogLevel)]
 	if errorLevel < util.LogLevelErr {
 		return nil, errors.New(fmt.Sprintf("log level invalid, must be one of: %s, %s, %s", util.LogErr, util.LogInfo, util.LogDebug))
 	}
 
+	// Build the list of sources we're going to export, either from a
+	// mounts file or a single one from our repository flags
+	defaultMount, err := buildDefaultMount(flags)
+	if err != nil {
+		return nil, err
+	}
+	mounts := []Mount{defaultMount}
+	if *flags.MountsFile != "" {
+		mounts, err = buildMounts(*flags.MountsFile, flags)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Validating only ever reads local files, it never clones a repository
+	if validating {
+		clone = false
+		for index := range mounts {
+			mounts[index].RepoURL = ""
+		}
+	}
+
 	// Should we build a secrets map for on-the-fly mustache replacement
 	if *flags.SecretsFile != "" {
-		secrets, err = buildSecretsMap(*flags.SecretsFile, *flags.RepoRootDir)
+		secretsMap, err = buildSecretsMap(*flags.SecretsFile, *flags.RepoRootDir)
 		if err != nil {
 			return nil, err
 		}
-		doSecrets = true
+	}
+
+	// Secrets are either rendered on the final values, or on the files before parsing them
+	secretsStage := *flags.SecretsStage
+	if secretsStage != SecretsStageImport && secretsStage != SecretsStageExport {
+		return nil, errors.New(fmt.Sprintf("secrets-stage must be one of: %s, %s", SecretsStageImport, SecretsStageExport))
+	}
+
+	// Along with any secret provider, resolving its own namespace placeholders
+	configSecrets, doSecrets, err := buildSecrets(flags, secretsMap)
+	if err != nil {
+		return nil, err
+	}
+
+	// Some values may be written encrypted, so Consul never holds them as plaintext
+	encrypter, encryptKeys, err := buildEncrypter(flags, secretsStage)
+	if err != nil {
+		return nil, err
 	}
 
 	return &config{
@@ -152,17 +323,46 @@ func buildConfig(flags ConfigFlags) (*config, error) {
 		repoRemoteName:  *flags.RepoRemoteName,
 		repoBasePath:    *flags.RepoBasePath,
 		repoRootDir:     *flags.RepoRootDir,
+		repoCommit:      *flags.RepoCommit,
+		sourceArchive:   *flags.SourceArchive,
+		mounts:          mounts,
+		gpgKeyring:      *flags.RepoGPGKeyring,
+		sshSigners:      *flags.RepoSSHSigners,
+		verifyAll:       *flags.RepoVerifyAll,
 		consulURL:       *flags.ConsulURL,
 		consulACL:       *flags.ConsulACL,
 		consulBasePath:  *flags.ConsulBasePath,
+		consulStateKey:  *flags.ConsulStateKey,
+		blameKey:        flags.BlameKey,
+		validating:      validating,
 		expandJSON:      *flags.ExpandJSON,
 		expandYAML:      *flags.ExpandYAML,
+		expandFormats:   expandFormats,
+		arrayMode:       arrayMode,
+		arrayModeRules:  arrayModeRules,
+		nullPolicy:      nullPolicy,
+		expandStrict:    *flags.ExpandStrict,
+		expandDepth:     *flags.ExpandDepth,
+		outputFormats:   outputFormatRules,
+		normalize:       normalize,
+		compareSemantic: *flags.CompareSemantic,
+		schemas:         schemas,
 		doSecrets:       doSecrets,
-		secretsMap:      secrets,
+		secretsStrict:   *flags.SecretsStrict,
+		secretsStage:    secretsStage,
+		secrets:         configSecrets,
+		encrypter:       encrypter,
+		encryptKeys:     encryptKeys,
+		encryptSecrets:  *flags.EncryptSecrets,
 		allowDeletes:    *flags.AllowDeletes,
 		pollInterval:    *flags.PollInterval,
 		Working:         make(chan bool, 1),
 		validExtensions: extensions,
+		templateExt:     strings.Trim(*flags.TemplateExt, "."),
+		references:      *flags.References,
+		overlayBase:     overlayBase,
+		overlays:        overlays,
+		keyRules:        keyRules,
 		keepFileExt:     *flags.KeepFileExt,
 		timeout:         *flags.Timeout,
 		version:         *flags.Version,
@@ -209,6 +409,30 @@ func (config *config) GetRepoRootDir() string {
 	return config.repoRootDir
 }
 
+func (config *config) GetRepoCommit() string {
+	return config.repoCommit
+}
+
+func (config *config) GetSourceArchive() string {
+	return config.sourceArchive
+}
+
+func (config *config) GetMounts() []Mount {
+	return config.mounts
+}
+
+func (config *config) GetRepoGPGKeyring() string {
+	return config.gpgKeyring
+}
+
+func (config *config) GetRepoSSHAllowedSigners() string {
+	return config.sshSigners
+}
+
+func (config *config) VerifyAllCommits() bool {
+	return config.verifyAll
+}
+
 func (config *config) GetConsulURL() string {
 	return config.consulURL
 }
@@ -221,22 +445,43 @@ func (config *config) GetConsulBasePath() string {
 	return config.consulBasePath
 }
 
-func (config *config) ShouldExpandJSON() bool {
-	return config.expandJSON
+func (config *config) GetConsulStateKey() string {
+	return config.consulStateKey
+}
+
+func (config *config) GetBlameKey() string {
+	return config.blameKey
+}
+
+func (config *config) IsValidating() bool {
+	return config.validating
+}
+
+func (config *config) GetNullPolicy() string {
+	return config.nullPolicy
+}
+
+func (config *config) IsExpandStrict() bool {
+	return config.expandStrict
 }
 
-func (config *config) ShouldExpandYAML() bool {
-	return config.expandYAML
+func (config *config) GetExpandDepth() int {
+	return config.expandDepth
 }
 
 func (config *config) DoSecrets() bool {
 	return config.doSecrets
 }
 
-func (config *config) GetSecretsMap() map[string]string {
-	return config.secretsMap
+func (config *config) IsSecretsStrict() bool {
+	return config.secretsStrict
+}
+
+func (config *config) GetSecretsStage() string {
+	return config.secretsStage
 }
 
+
 func (config *config) AllowDeletes() string {
 	return strings.ToLower(config.allowDeletes)
 }
@@ -253,6 +498,14 @@ func (config *config) GetValidExtensions() []string {
 	return config.validExtensions
 }
 
+func (config *config) GetTemplateExt() string {
+	return config.templateExt
+}
+
+func (config *config) DoReferences() bool {
+	return config.references
+}
+
 func (config *config) KeepFileExt() bool {
 	return config.keepFileExt
 }
@@ -282,14 +535,23 @@ func buildSecretsMap(secretsFile string, repoRootPath string) (map[string]string
 		return nil, errors.New(fmt.Sprintf("could not open file (%s). Error message: %s", secretsFile, err.Error()))
 	}
 
-	var secretsMap map[string]string
+	var secretsTree map[string]interface{}
 
-	// Decode data into "generic"
-	err = json.Unmarshal([]byte(content), &secretsMap)
+	// Decode data into "generic", numbers kept as written
+	decoder := json.NewDecoder(strings.NewReader(string(content)))
+	decoder.UseNumber()
+	err = decoder.Decode(&secretsTree)
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("could not parse keys JSON file (%s). Error message: %s", secretsFile, err.Error()))
 	}
 
+	// Nested maps are flattened into dotted placeholders: {{db.prod.password}}
+	secretsMap := map[string]string{}
+	err = flattenSecrets("", secretsTree, secretsMap)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid keys JSON file (%s). Error message: %s", secretsFile, err.Error()))
+	}
+
 	return secretsMap, nil
 }
 
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"github.com/miniclip/gonsul/internal/secrets"
+
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// buildEncrypter builds the encrypter of the values we write encrypted, along with the key
+// patterns it applies to. The encrypter is nil if no value is to be encrypted
+func buildEncrypter(flags ConfigFlags, secretsStage string) (secrets.IEncrypter, []string, error) {
+	var patterns []string
+	if *flags.EncryptKeys != "" {
+		for _, pattern := range strings.Split(*flags.EncryptKeys, ",") {
+			pattern = strings.Trim(strings.TrimSpace(pattern), "/")
+			if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+				return nil, nil, errors.New(fmt.Sprintf("invalid encrypted key pattern (%s)", pattern))
+			}
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	// Where values come from is only known while rendering them on the final values
+	if *flags.EncryptSecrets && secretsStage != SecretsStageImport {
+		return nil, nil, errors.New(fmt.Sprintf("encrypt-secrets requires secrets-stage=%s", SecretsStageImport))
+	}
+
+	recipient, transitKey := *flags.EncryptRecipient, *flags.VaultTransitKey
+	if len(patterns) == 0 && !*flags.EncryptSecrets {
+		if recipient != "" || transitKey != "" {
+			return nil, nil, errors.New("encrypt-recipient and vault-transit-key require encrypt-keys or encrypt-secrets")
+		}
+		return nil, nil, nil
+	}
+	if (recipient == "") == (transitKey == "") {
+		return nil, nil, errors.New("encrypted values require either encrypt-recipient or vault-transit-key")
+	}
+
+	if recipient != "" {
+		encrypter, err := secrets.NewAgeEncrypter(recipient)
+		return encrypter, patterns, err
+	}
+
+	if *flags.VaultAddr == "" {
+		return nil, nil, errors.New("vault-transit-key requires vault-addr")
+	}
+	token := *flags.VaultToken
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	client := &http.Client{Timeout: time.Second * time.Duration(*flags.Timeout)}
+	encrypter, err := secrets.NewVaultTransitEncrypter(*flags.VaultAddr, token, transitKey, client)
+
+	return encrypter, patterns, err
+}
+
+// GetEncrypter returns the encrypter of the values we write encrypted, nil if there are none
+func (config *config) GetEncrypter() secrets.IEncrypter {
+	return config.encrypter
+}
+
+// ShouldEncrypt tells if the value of the given key, relative to our Consul KV base path, is
+// written encrypted. Values rendered from secret placeholders may be encrypted too
+func (config *config) ShouldEncrypt(key string, fromSecrets bool) bool {
+	if config.encrypter == nil {
+		return false
+	}
+	if fromSecrets && config.encryptSecrets {
+		return true
+	}
+
+	key = strings.Trim(key, "/")
+	for _, pattern := range config.encryptKeys {
+		if matched, _ := path.Match(pattern, key); matched {
+			return true
+		}
+	}
+
+	return false
+}
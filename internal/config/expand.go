@@ -0,0 +1,138 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Structured file formats, that can be expanded into keys
+const FormatJSON = "json"
+const FormatYAML = "yaml"
+const FormatTOML = "toml"
+const FormatHCL = "hcl"
+const FormatProperties = "properties"
+const FormatEnv = "env"
+const FormatINI = "ini"
+
+// formats are all our known structured file formats
+var formats = []string{FormatJSON, FormatYAML, FormatTOML, FormatHCL, FormatProperties, FormatEnv, FormatINI}
+
+// parseExpandFormats parses our comma separated list of formats to expand
+func parseExpandFormats(list string) (map[string]bool, error) {
+	expand := map[string]bool{}
+	if list == "" {
+		return expand, nil
+	}
+
+	for _, format := range strings.Split(list, ",") {
+		format = strings.ToLower(strings.TrimSpace(format))
+		known := false
+		for _, knownFormat := range formats {
+			known = known || format == knownFormat
+		}
+		if !known {
+			return nil, errors.New(fmt.Sprintf("format to expand (%s) is invalid, must be one of: %s", format, strings.Join(formats, ", ")))
+		}
+		expand[format] = true
+	}
+
+	return expand, nil
+}
+
+// Null policies, what to do with null values found while expanding JSON/YAML files
+const NullsDelete = "delete"
+const NullsSkip = "skip"
+const NullsEmpty = "empty"
+
+// validateNullPolicy makes sure the given null policy is a valid one
+func validateNullPolicy(policy string) error {
+	if policy != NullsDelete && policy != NullsSkip && policy != NullsEmpty {
+		return errors.New(fmt.Sprintf("null policy (%s) is invalid, must be one of: %s, %s, %s", policy, NullsDelete, NullsSkip, NullsEmpty))
+	}
+
+	return nil
+}
+
+// fileRule sets a per file value, such as an array expansion mode, for the files matching its pattern
+type fileRule struct {
+	pattern string
+	value   string
+}
+
+// validateOutputFormat makes sure the given output format is one we can write files in
+func validateOutputFormat(format string) error {
+	if format != FormatJSON && format != FormatYAML {
+		return errors.New(fmt.Sprintf("output format (%s) is invalid, must be one of: %s, %s", format, FormatJSON, FormatYAML))
+	}
+
+	return nil
+}
+
+// parseFileRules parses a "file/pattern=value,..." flag, keeping its order as
+// the first matching pattern wins
+func parseFileRules(rules string, name string, placeholder string, parse func(value string) (string, error)) ([]fileRule, error) {
+	var parsed []fileRule
+	if rules == "" {
+		return parsed, nil
+	}
+
+	for _, pair := range strings.Split(rules, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.New(fmt.Sprintf("invalid file %s (%s), must be: file/pattern=%s", name, pair, placeholder))
+		}
+		if _, err := path.Match(parts[0], ""); err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid file pattern (%s): %s", parts[0], err.Error()))
+		}
+		value, err := parse(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, fileRule{pattern: strings.TrimPrefix(parts[0], "/"), value: value})
+	}
+
+	return parsed, nil
+}
+
+// parseOutputFormatRules parses our "file/pattern=format,..." output formats flag
+func parseOutputFormatRules(rules string) ([]fileRule, error) {
+	return parseFileRules(rules, "output format", "format", func(value string) (string, error) {
+		format := strings.ToLower(value)
+		return format, validateOutputFormat(format)
+	})
+}
+
+// matchFileRule returns the value of the first rule matching the given file, its path
+// being relative to the repository base path
+func matchFileRule(rules []fileRule, filePath string) (string, bool) {
+	filePath = strings.TrimPrefix(filePath, "/")
+	for _, rule := range rules {
+		if matched, _ := path.Match(rule.pattern, filePath); matched {
+			return rule.value, true
+		}
+	}
+
+	return "", false
+}
+
+// GetOutputFormat returns the format the given file values are written to Consul in,
+// empty if they're written as they are in the file
+func (config *config) GetOutputFormat(filePath string) string {
+	format, _ := matchFileRule(config.outputFormats, filePath)
+
+	return format
+}
+
+// ShouldExpand tells if the files of the given format should be expanded into keys
+func (config *config) ShouldExpand(format string) bool {
+	switch format {
+	case FormatJSON:
+		return config.expandJSON || config.expandFormats[format]
+	case FormatYAML:
+		return config.expandYAML || config.expandFormats[format]
+	}
+
+	return config.expandFormats[format]
+}
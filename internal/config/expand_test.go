@@ -0,0 +1,43 @@
+package config
+
+import (
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestShouldExpand(t *testing.T) {
+	RegisterTestingT(t)
+
+	formats, err := parseExpandFormats("toml, ENV")
+	Expect(err).To(BeNil())
+
+	cfg := &config{expandYAML: true, expandFormats: formats}
+	Expect(cfg.ShouldExpand(FormatTOML)).To(BeTrue())
+	Expect(cfg.ShouldExpand(FormatEnv)).To(BeTrue(), "Assert formats are case insensitive")
+	Expect(cfg.ShouldExpand(FormatYAML)).To(BeTrue(), "Assert --expand-yaml still applies")
+	Expect(cfg.ShouldExpand(FormatJSON)).To(BeFalse())
+	Expect(cfg.ShouldExpand(FormatHCL)).To(BeFalse())
+
+	// Unknown formats are refused
+	formats, err = parseExpandFormats("toml,xml")
+	Expect(err).To(Not(BeNil()))
+	Expect(formats).To(BeNil())
+}
+
+func TestGetOutputFormat(t *testing.T) {
+	RegisterTestingT(t)
+
+	rules, err := parseOutputFormatRules("services/*.yaml=JSON,legacy.json=yaml")
+	Expect(err).To(BeNil())
+
+	cfg := &config{outputFormats: rules}
+	Expect(cfg.GetOutputFormat("services/web.yaml")).To(Equal(FormatJSON))
+	Expect(cfg.GetOutputFormat("/legacy.json")).To(Equal(FormatYAML))
+	Expect(cfg.GetOutputFormat("app.json")).To(Equal(""), "Assert files are written as they are by default")
+
+	// Formats we can't write files in are refused
+	rules, err = parseOutputFormatRules("app.yaml=toml")
+	Expect(err).To(Not(BeNil()))
+	Expect(rules).To(BeNil())
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
 	"github.com/miniclip/gonsul/internal/util"
 	"github.com/namsral/flag"
 )
@@ -17,15 +18,63 @@ type ConfigFlags struct {
 	RepoRemoteName  *string
 	RepoBasePath    *string
 	RepoRootDir     *string
+	RepoCommit      *string
+	SourceArchive   *string
+	MountsFile      *string
+	RepoGPGKeyring  *string
+	RepoSSHSigners  *string
+	RepoVerifyAll   *bool
+	RepoTrustAnchor *string
+	// Submodules and LFS
+	RepoSubmodules        *string
+	RepoSubmodulePrefixes *string
+	RepoLFS               *string
+	RepoLFSStore          *string
+	RepoDepth             *int
 	ConsulURL       *string
 	ConsulACL       *string
 	ConsulBasePath  *string
+	ConsulStateKey  *string
+	BlameKey        string
+	Command         string
 	ExpandJSON      *bool
 	ExpandYAML      *bool
+	// Array expansion
+	ExpandFormats     *string
+	ExpandArrays      *string
+	ExpandArraysFiles *string
+	ExpandNulls       *string
+	ExpandStrict      *bool
+	ExpandDepth       *int
+	OutputFormats     *string
+	Normalize         *string
+	CompareSemantic   *bool
+	Schemas           *string
 	SecretsFile     *string
+	SecretsEnv      *string
+	SecretsDir      *string
+	VaultAddr       *string
+	VaultToken      *string
+	SOPSAgeKeyFile  *string
+	SecretsStrict   *bool
+	SecretsStage    *string
+	EncryptKeys     *string
+	EncryptSecrets  *bool
+	EncryptRecipient *string
+	VaultTransitKey *string
 	AllowDeletes    *string
 	PollInterval    *int
 	ValidExtensions *string
+	TemplateExt     *string
+	References      *bool
+	OverlayBase     *string
+	Overlays        *string
+	KeyCase         *string
+	KeyReplace      *string
+	KeyMap          *string
+	KeyCharset      *string
+	KeyMaxDepth     *int
+	KeyMaxLength    *int
 	KeepFileExt     *bool
 	Timeout         *int
 	Version         *bool
@@ -47,21 +96,100 @@ func parseFlags() ConfigFlags {
 	flags.RepoRemoteName = flag.String("repo-remote-name", "origin", "The repository remote name")
 	flags.RepoBasePath = flag.String("repo-base-path", "/", "The base directory to look from inside the repo")
 	flags.RepoRootDir = flag.String("repo-root", "/tmp/gonsul/repo", "The path where the repo will be downloaded to")
+	flags.RepoCommit = flag.String("repo-commit", "", "A commit hash to read files from, instead of the checked out working tree")
+	flags.SourceArchive = flag.String("source-archive", "", "A tar, tar.gz or zip archive to read files from, instead of a repository")
+	flags.MountsFile = flag.String("mounts-file", "", "A JSON file with multiple repositories/archives to export, each mapped to a Consul KV prefix")
+	flags.RepoGPGKeyring = flag.String("repo-gpg-keyring", "", "An armored GPG keyring, if set commits must be signed by one of its keys to be synced")
+	flags.RepoSSHSigners = flag.String("repo-ssh-allowed-signers", "", "An SSH allowed signers file, if set commits must be signed by one of its keys to be synced")
+	flags.RepoVerifyAll = flag.Bool("repo-verify-all", false, "Verify every commit since the last synced one, not only the synced commit? (Default false)")
+	flags.RepoTrustAnchor = flag.String("repo-trust-anchor", "", "A trusted commit hash, verifying every commit since it when there is no last synced one (Default full history)")
+	flags.RepoSubmodules = flag.String("repo-submodules", "on", "Submodules policy: off, on or a maximum recursion depth")
+	flags.RepoSubmodulePrefixes = flag.String("repo-submodule-prefixes", "", "A comma separated list of submodule/path=consul/prefix mappings for submodule files")
+	flags.RepoLFS = flag.String("repo-lfs", "fail", "What to do with Git LFS pointer files: fail, resolve (from the local LFS store)")
+	flags.RepoLFSStore = flag.String("repo-lfs-store", "", "The local Git LFS objects directory (Default <repo-root>/.git/lfs/objects)")
+	flags.RepoDepth = flag.Int("repo-depth", 0, "Shallow clone depth, the number of commits to fetch (Default 0, full history)")
 	flags.ConsulURL = flag.String("consul-url", "", "(REQUIRED) The Consul URL REST API endpoint (Full URL with scheme)")
 	flags.ConsulACL = flag.String("consul-acl", "", "The Consul ACL to use (Must have write on the KV following --consul-base path)")
 	flags.ConsulBasePath = flag.String("consul-base-path", "", "The base KV path will be prefixed to dir path")
+	flags.ConsulStateKey = flag.String("consul-state-key", "", "A KV path (relative to --consul-base-path) where Gonsul writes the synced commits metadata, e.g. _gonsul/state")
 	flags.ExpandJSON = flag.Bool("expand-json", false, "Expand and parse JSON files as full paths? (Default false)")
 	flags.ExpandYAML = flag.Bool("expand-yaml", false, "Expand and parse YAML files as full paths? (Default false)")
+	flags.ExpandFormats = flag.String("expand-formats", "", fmt.Sprintf("A comma separated list of file formats to expand into keys (%s)", strings.Join(formats, ", ")))
+	flags.ExpandArrays = flag.String("expand-arrays", ArraysJSON, fmt.Sprintf("How expanded files arrays are written (%s, %s, %s)", ArraysJSON, ArraysIndexed, ArraysCSV))
+	flags.ExpandArraysFiles = flag.String("expand-arrays-files", "", "A comma separated list of file/pattern=mode array expansion modes, overriding --expand-arrays for matching files")
+	flags.ExpandNulls = flag.String("expand-nulls", NullsDelete, fmt.Sprintf("What to do with expanded files null values (%s, %s, %s)", NullsDelete, NullsSkip, NullsEmpty))
+	flags.ExpandStrict = flag.Bool("expand-strict", false, "Fail on expanded files constructs that cannot be written to Consul, instead of warning? (Default false)")
+	flags.ExpandDepth = flag.Int("expand-depth", 0, "How deep expanded files create keys, deeper objects and arrays are stored as a whole (Default 0, no limit)")
+	flags.OutputFormats = flag.String("output-formats", "", fmt.Sprintf("A comma separated list of file/pattern=format rules, writing matching files values in a canonical %s or %s", FormatJSON, FormatYAML))
+	flags.Normalize = flag.String("normalize", "", fmt.Sprintf("A comma separated list of normalizations applied to local and live values before comparing them (%s)", strings.Join(normalizations, ", ")))
+	flags.CompareSemantic = flag.Bool("compare-semantic", false, "Compare JSON/YAML values by their content, so reformatting them does not update Consul? (Default false)")
+	flags.Schemas = flag.String("schemas", "", "A comma separated list of file/pattern=schema/file rules, validating matching files against JSON Schema files of the repository")
 	flags.SecretsFile = flag.String("secrets-file", "", "A key value json file with placeholders->secrets mapping, in order to do on the fly replace")
+	flags.SecretsEnv = flag.String("secrets-env", "", "An environment variables prefix, {{env.NAME}} placeholders being replaced by the variable named prefix+NAME (e.g. GONSUL_SECRET_)")
+	flags.SecretsDir = flag.String("secrets-dir", "", "A directory of secret files, {{dir.name}} placeholders being replaced by the content of its file name")
+	flags.VaultAddr = flag.String("vault-addr", "", "The Vault URL, {{vault.path#field}} placeholders being replaced by the field of its KV secret at path")
+	flags.VaultToken = flag.String("vault-token", "", "The Vault token to read secrets with (Default VAULT_TOKEN environment variable)")
+	flags.SOPSAgeKeyFile = flag.String("sops-age-key-file", "", "An age key file, {{sops.file#path/to/value}} placeholders being replaced by the value of the SOPS file of the repository (Default SOPS_AGE_KEY_FILE environment variable)")
+	flags.SecretsStrict = flag.Bool("secrets-strict", false, "Fail on secret placeholders not found and on unused secrets file entries, instead of writing them empty? (Default false)")
+	flags.SecretsStage = flag.String("secrets-stage", SecretsStageImport, fmt.Sprintf("When secrets are rendered: %s (on final values), %s (on files, before parsing them)", SecretsStageImport, SecretsStageExport))
+	flags.EncryptKeys = flag.String("encrypt-keys", "", "A comma separated list of key patterns, relative to --consul-base-path, whose values are written encrypted to Consul")
+	flags.EncryptSecrets = flag.Bool("encrypt-secrets", false, "Write the values rendered from secret placeholders encrypted to Consul? (Default false)")
+	flags.EncryptRecipient = flag.String("encrypt-recipient", "", "An age public key (age1...) encrypted values are encrypted to")
+	flags.VaultTransitKey = flag.String("vault-transit-key", "", "A Vault transit key (mount/key) encrypted values are encrypted with, through --vault-addr")
 	flags.AllowDeletes = flag.String("allow-deletes", "false", "false, nothing will be done and a report on conflicting deletes will be shown; true: deletes reported conflitcs and proceeds; skip: reportes conflitcs, does not performe any deletes and proceeds syncing remaining files.) (Default false)")
 	flags.PollInterval = flag.Int("poll-interval", 60, "The number of seconds for the repository polling interval")
 	flags.ValidExtensions = flag.String("input-ext", "json,txt,ini", "A comma separated list of file extensions valid as input")
+	flags.TemplateExt = flag.String("template-ext", "", "An extension of template files (e.g. tmpl for config.json.tmpl), rendered with Go templates before being exported")
+	flags.References = flag.Bool("references", false, "Resolve {{ref key}} references to other keys values and {{include file}} snippets of the repository? (Default false)")
+	flags.OverlayBase = flag.String("overlay-base", "", "A directory of base files, exported under each of the --overlays directories along with their own files")
+	flags.Overlays = flag.String("overlays", "", "A comma separated list of environment directories, whose files override (deep merging JSON/YAML files) the --overlay-base ones")
+	flags.KeyCase = flag.String("key-case", "", fmt.Sprintf("Fold the case of exported keys (%s, %s)", KeyCaseLower, KeyCaseUpper))
+	flags.KeyReplace = flag.String("key-replace", "", "A comma separated list of from=to replacements applied to exported keys (e.g. ' =-')")
+	flags.KeyMap = flag.String("key-map", "", "A comma separated list of regexp=replacement mappings applied to exported keys (e.g. '^legacy/=apps/')")
+	flags.KeyCharset = flag.String("key-charset", "", "The characters allowed in exported keys, as a regexp bracket expression content (e.g. 'a-z0-9_.-')")
+	flags.KeyMaxDepth = flag.Int("key-max-depth", 0, "The maximum number of path segments of exported keys (Default 0, no limit)")
+	flags.KeyMaxLength = flag.Int("key-max-length", 0, "The maximum length of exported keys (Default 0, no limit)")
 	flags.KeepFileExt = flag.Bool("keep-ext", false, "Do we want to keep file name extensions ? (If not set to true defaults by ommiting the file name extension.) (Default false)")
 	flags.Timeout = flag.Int("timeout", 5, "The number of seconds for the client to wait for a response from Consul")
 	flags.Version = flag.Bool("v", false, "Will show the Gonsul version")
 
+	// Our commands come before any flag
+	var arguments []string
+	flags.Command, flags.BlameKey, arguments = parseCommand(os.Args[1:])
+
 	// Parse our command line flags
-	flag.Parse()
+	_ = flag.CommandLine.Parse(arguments)
+
+	// Validating is meant to run on a working copy, the current directory unless told otherwise
+	if flags.Command == CommandValidate {
+		rootDirSet := false
+		flag.Visit(func(f *flag.Flag) {
+			rootDirSet = rootDirSet || f.Name == "repo-root"
+		})
+		if !rootDirSet {
+			*flags.RepoRootDir = "."
+		}
+	}
 
 	return flags
 }
+
+// parseCommand splits the command (and its own arguments) our flags may be preceded by
+// from these flags, the blame command taking the Consul KV path to blame
+func parseCommand(arguments []string) (command string, blameKey string, flags []string) {
+	if len(arguments) == 0 {
+		return "", "", arguments
+	}
+
+	switch arguments[0] {
+	case CommandValidate:
+		return arguments[0], "", arguments[1:]
+	case CommandBlame:
+		if len(arguments) > 1 && !strings.HasPrefix(arguments[1], "-") {
+			return arguments[0], arguments[1], arguments[2:]
+		}
+		return arguments[0], "", arguments[1:]
+	}
+
+	return "", "", arguments
+}
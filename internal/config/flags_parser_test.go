@@ -0,0 +1,37 @@
+package config
+
+import (
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	RegisterTestingT(t)
+
+	command, blameKey, flags := parseCommand([]string{"--strategy=ONCE"})
+	Expect(command).To(Equal(""))
+	Expect(blameKey).To(Equal(""))
+	Expect(flags).To(Equal([]string{"--strategy=ONCE"}))
+
+	command, blameKey, flags = parseCommand([]string{CommandValidate, "--expand-json"})
+	Expect(command).To(Equal(CommandValidate))
+	Expect(blameKey).To(Equal(""))
+	Expect(flags).To(Equal([]string{"--expand-json"}))
+
+	command, blameKey, flags = parseCommand([]string{CommandBlame, "app1/db/host", "--expand-json"})
+	Expect(command).To(Equal(CommandBlame))
+	Expect(blameKey).To(Equal("app1/db/host"))
+	Expect(flags).To(Equal([]string{"--expand-json"}))
+
+	// A missing path is left for our configuration to refuse, flags aren't paths
+	command, blameKey, flags = parseCommand([]string{CommandBlame, "--expand-json"})
+	Expect(command).To(Equal(CommandBlame))
+	Expect(blameKey).To(Equal(""))
+	Expect(flags).To(Equal([]string{"--expand-json"}))
+
+	// Commands only come first
+	command, _, flags = parseCommand([]string{"--expand-json", CommandValidate})
+	Expect(command).To(Equal(""))
+	Expect(flags).To(Equal([]string{"--expand-json", CommandValidate}))
+}
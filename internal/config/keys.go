@@ -0,0 +1,131 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Key case folding rules
+const KeyCaseLower = "lower"
+const KeyCaseUpper = "upper"
+
+// keyMapping rewrites the keys matching its pattern, as in "^legacy/=apps/"
+type keyMapping struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// keyRules are the rules rewriting and validating the keys we export, relative to their
+// mount Consul KV path
+type keyRules struct {
+	fold      string
+	replacer  *strings.Replacer
+	mappings  []keyMapping
+	charset   *regexp.Regexp
+	maxDepth  int
+	maxLength int
+}
+
+// parseKeyRules parses our key rewriting and validation flags
+func parseKeyRules(flags ConfigFlags) (keyRules, error) {
+	rules := keyRules{fold: strings.ToLower(*flags.KeyCase), maxDepth: *flags.KeyMaxDepth, maxLength: *flags.KeyMaxLength}
+	if rules.fold != "" && rules.fold != KeyCaseLower && rules.fold != KeyCaseUpper {
+		return rules, errors.New(fmt.Sprintf("key case (%s) is invalid, must be one of: %s, %s", rules.fold, KeyCaseLower, KeyCaseUpper))
+	}
+	if rules.maxDepth < 0 || rules.maxLength < 0 {
+		return rules, errors.New("key maximum depth and length must not be negative")
+	}
+
+	// Character replacements, from=to pairs (to may be empty)
+	if *flags.KeyReplace != "" {
+		var pairs []string
+		for _, pair := range strings.Split(*flags.KeyReplace, ",") {
+			parts := strings.SplitN(pair, "=", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				return rules, errors.New(fmt.Sprintf("invalid key replacement (%s), must be: from=to", pair))
+			}
+			pairs = append(pairs, parts[0], parts[1])
+		}
+		rules.replacer = strings.NewReplacer(pairs...)
+	}
+
+	// Regular expression mappings, pattern=replacement pairs
+	if *flags.KeyMap != "" {
+		for _, pair := range strings.Split(*flags.KeyMap, ",") {
+			parts := strings.SplitN(pair, "=", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				return rules, errors.New(fmt.Sprintf("invalid key mapping (%s), must be: pattern=replacement", pair))
+			}
+			pattern, err := regexp.Compile(parts[0])
+			if err != nil {
+				return rules, errors.New(fmt.Sprintf("invalid key mapping pattern (%s): %s", parts[0], err.Error()))
+			}
+			rules.mappings = append(rules.mappings, keyMapping{pattern: pattern, replacement: parts[1]})
+		}
+	}
+
+	// Allowed characters, as a regular expression bracket expression content
+	if *flags.KeyCharset != "" {
+		charset, err := regexp.Compile("^[" + *flags.KeyCharset + "]$")
+		if err != nil {
+			return rules, errors.New(fmt.Sprintf("invalid key charset (%s): %s", *flags.KeyCharset, err.Error()))
+		}
+		rules.charset = charset
+	}
+
+	return rules, nil
+}
+
+// RewriteKey applies our key rewriting rules to the given key: case folding, character
+// replacements and then regular expression mappings
+func (config *config) RewriteKey(key string) string {
+	switch config.keyRules.fold {
+	case KeyCaseLower:
+		key = strings.ToLower(key)
+	case KeyCaseUpper:
+		key = strings.ToUpper(key)
+	}
+	if config.keyRules.replacer != nil {
+		key = config.keyRules.replacer.Replace(key)
+	}
+	for _, mapping := range config.keyRules.mappings {
+		key = mapping.pattern.ReplaceAllString(key, mapping.replacement)
+	}
+
+	return key
+}
+
+// ValidateKey checks the given (rewritten) key against our key validation rules: its allowed
+// characters, its depth and its length. Empty path segments are refused along with any rule
+func (config *config) ValidateKey(key string) error {
+	rules := config.keyRules
+	if rules.charset == nil && rules.maxDepth == 0 && rules.maxLength == 0 {
+		return nil
+	}
+
+	segments := strings.Split(key, "/")
+	for _, segment := range segments {
+		if segment == "" {
+			return errors.New("empty path segment")
+		}
+		if rules.charset == nil {
+			continue
+		}
+		for _, char := range segment {
+			if !rules.charset.MatchString(string(char)) {
+				return errors.New(fmt.Sprintf("character %q is not allowed", char))
+			}
+		}
+	}
+	if rules.maxDepth > 0 && len(segments) > rules.maxDepth {
+		return errors.New(fmt.Sprintf("depth %d is over the maximum of %d", len(segments), rules.maxDepth))
+	}
+	if rules.maxLength > 0 && utf8.RuneCountInString(key) > rules.maxLength {
+		return errors.New(fmt.Sprintf("length %d is over the maximum of %d", utf8.RuneCountInString(key), rules.maxLength))
+	}
+
+	return nil
+}
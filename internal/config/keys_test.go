@@ -0,0 +1,51 @@
+package config
+
+import (
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+// keyFlags returns our key rules flags, as given on the command line
+func keyFlags(fold string, replace string, mapping string, charset string, maxDepth int, maxLength int) ConfigFlags {
+	return ConfigFlags{KeyCase: &fold, KeyReplace: &replace, KeyMap: &mapping, KeyCharset: &charset, KeyMaxDepth: &maxDepth, KeyMaxLength: &maxLength}
+}
+
+func TestRewriteKey(t *testing.T) {
+	RegisterTestingT(t)
+
+	rules, err := parseKeyRules(keyFlags("lower", " =-,_=-", `^legacy/=apps/,(^|/)\.=$1,\.conf$=`, "", 0, 0))
+	Expect(err).To(BeNil())
+
+	cfg := &config{keyRules: rules}
+	Expect(cfg.RewriteKey("Legacy/My App/.Hidden_File.conf")).To(Equal("apps/my-app/hidden-file"))
+	Expect(cfg.RewriteKey("other/key")).To(Equal("other/key"))
+	Expect((&config{}).RewriteKey("As Is")).To(Equal("As Is"), "Assert keys are left alone without rules")
+
+	// Invalid rules are refused
+	for _, invalid := range []ConfigFlags{
+		keyFlags("title", "", "", "", 0, 0),
+		keyFlags("", "=-", "", "", 0, 0),
+		keyFlags("", "", "[=x", "", 0, 0),
+		keyFlags("", "", "", "z-a", 0, 0),
+		keyFlags("", "", "", "", -1, 0),
+	} {
+		_, err = parseKeyRules(invalid)
+		Expect(err).NotTo(BeNil())
+	}
+}
+
+func TestValidateKey(t *testing.T) {
+	RegisterTestingT(t)
+
+	rules, err := parseKeyRules(keyFlags("", "", "", "a-z0-9_.-", 3, 20))
+	Expect(err).To(BeNil())
+
+	cfg := &config{keyRules: rules}
+	Expect(cfg.ValidateKey("app/db/host")).To(BeNil())
+	Expect(cfg.ValidateKey("app/DB/host")).To(MatchError(`character 'D' is not allowed`))
+	Expect(cfg.ValidateKey("app//host")).To(MatchError("empty path segment"))
+	Expect(cfg.ValidateKey("app/db/host/port")).To(MatchError("depth 4 is over the maximum of 3"))
+	Expect(cfg.ValidateKey("app/database-hostname")).To(MatchError("length 21 is over the maximum of 20"))
+	Expect((&config{}).ValidateKey("app//Any Key")).To(BeNil(), "Assert keys are valid without rules")
+}
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// DefaultMountName is the name of the single mount built from the command line
+// flags, whenever no mounts file is given
+const DefaultMountName = "default"
+
+// Submodule and Git LFS policies
+const SubmodulesOff = "off"
+const SubmodulesOn = "on"
+const LFSFail = "fail"
+const LFSResolve = "resolve"
+
+// defaultSubmoduleDepth mirrors Git default submodule recursion depth
+const defaultSubmoduleDepth = 10
+
+// Mount maps a single source (a repository, a repository sub directory or an
+// archive) to a Consul KV prefix. Its JSON keys follow our command line flag names
+type Mount struct {
+	Name           string `json:"name"`
+	RepoURL        string `json:"repo-url"`
+	RepoSSHKey     string `json:"repo-ssh-key"`
+	RepoSSHUser    string `json:"repo-ssh-user"`
+	RepoBranch     string `json:"repo-branch"`
+	RepoRemoteName string `json:"repo-remote-name"`
+	RepoBasePath   string `json:"repo-base-path"`
+	RepoRootDir    string `json:"repo-root"`
+	RepoCommit     string `json:"repo-commit"`
+	SourceArchive  string `json:"source-archive"`
+	ConsulBasePath string `json:"consul-base-path"`
+	// RepoSubmodules is one of off, on or a maximum recursion depth
+	RepoSubmodules    string            `json:"repo-submodules"`
+	SubmodulePrefixes map[string]string `json:"repo-submodule-prefixes"`
+	RepoLFS           string            `json:"repo-lfs"`
+	RepoLFSStore      string            `json:"repo-lfs-store"`
+	RepoDepth         int               `json:"repo-depth"`
+	// RepoTrustAnchor is the commit we verify history from, if we never synced this mount
+	RepoTrustAnchor string `json:"repo-trust-anchor"`
+}
+
+// IsCloning tells if this mount's repository should be cloned by Gonsul
+func (m Mount) IsCloning() bool {
+	return m.RepoURL != "" && m.SourceArchive == ""
+}
+
+// SubmoduleDepth returns how deep we should recurse into submodules, zero meaning not at all
+func (m Mount) SubmoduleDepth() int {
+	switch m.RepoSubmodules {
+	case SubmodulesOff:
+		return 0
+	case SubmodulesOn, "":
+		return defaultSubmoduleDepth
+	}
+
+	depth, _ := strconv.Atoi(m.RepoSubmodules)
+
+	return depth
+}
+
+// validate makes sure the mount policies are valid ones
+func (m Mount) validate() error {
+	if m.RepoSubmodules != SubmodulesOff && m.RepoSubmodules != SubmodulesOn {
+		if depth, err := strconv.Atoi(m.RepoSubmodules); err != nil || depth < 1 {
+			return errors.New(fmt.Sprintf("mount %s submodules policy is invalid, must be one of: %s, %s, a positive depth", m.Name, SubmodulesOff, SubmodulesOn))
+		}
+	}
+
+	if m.RepoDepth < 0 {
+		return errors.New(fmt.Sprintf("mount %s depth must not be negative", m.Name))
+	}
+
+	if m.RepoLFS != LFSFail && m.RepoLFS != LFSResolve {
+		return errors.New(fmt.Sprintf("mount %s LFS policy is invalid, must be one of: %s, %s", m.Name, LFSFail, LFSResolve))
+	}
+
+	// Short hashes could match more than one commit, we only trust exactly the one given
+	if _, err := hex.DecodeString(m.RepoTrustAnchor); err != nil || (m.RepoTrustAnchor != "" && len(m.RepoTrustAnchor) != 40) {
+		return errors.New(fmt.Sprintf("mount %s trust anchor must be a full commit hash", m.Name))
+	}
+
+	return nil
+}
+
+// parseSubmodulePrefixes parses our "submodule/path=consul/prefix,..." flag
+func parseSubmodulePrefixes(prefixes string) (map[string]string, error) {
+	mapping := map[string]string{}
+	if prefixes == "" {
+		return mapping, nil
+	}
+
+	for _, pair := range strings.Split(prefixes, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.New(fmt.Sprintf("invalid submodule prefix mapping (%s), must be: submodule/path=consul/prefix", pair))
+		}
+		mapping[parts[0]] = parts[1]
+	}
+
+	return mapping, nil
+}
+
+// buildDefaultMount creates our single mount from the command line flags
+func buildDefaultMount(flags ConfigFlags) (Mount, error) {
+	prefixes, err := parseSubmodulePrefixes(*flags.RepoSubmodulePrefixes)
+	if err != nil {
+		return Mount{}, err
+	}
+
+	mount := Mount{
+		Name:           DefaultMountName,
+		RepoURL:        *flags.RepoURL,
+		RepoSSHKey:     *flags.RepoSSHKey,
+		RepoSSHUser:    *flags.RepoSSHUser,
+		RepoBranch:     *flags.RepoBranch,
+		RepoRemoteName: *flags.RepoRemoteName,
+		RepoBasePath:   *flags.RepoBasePath,
+		RepoRootDir:    *flags.RepoRootDir,
+		RepoCommit:     *flags.RepoCommit,
+		SourceArchive:  *flags.SourceArchive,
+		// Submodules and LFS
+		RepoSubmodules:    strings.ToLower(*flags.RepoSubmodules),
+		SubmodulePrefixes: prefixes,
+		RepoLFS:           strings.ToLower(*flags.RepoLFS),
+		RepoLFSStore:      *flags.RepoLFSStore,
+		// Shallow clones
+		RepoDepth: *flags.RepoDepth,
+		// Commit verification
+		RepoTrustAnchor: *flags.RepoTrustAnchor,
+	}
+
+	return mount, mount.validate()
+}
+
+// buildMounts loads our mounts from the given JSON file, using the command line
+// flags as defaults for any omitted repository setting
+func buildMounts(mountsFile string, flags ConfigFlags) ([]Mount, error) {
+	content, err := ioutil.ReadFile(mountsFile)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("could not open mounts file (%s). Error message: %s", mountsFile, err.Error()))
+	}
+
+	var mounts []Mount
+	if err := json.Unmarshal(content, &mounts); err != nil {
+		return nil, errors.New(fmt.Sprintf("could not parse mounts JSON file (%s). Error message: %s", mountsFile, err.Error()))
+	}
+
+	if len(mounts) == 0 {
+		return nil, errors.New(fmt.Sprintf("the mounts file (%s) has no mounts", mountsFile))
+	}
+
+	names := map[string]bool{}
+	for i := range mounts {
+		mount := &mounts[i]
+
+		// Every mount needs a unique name, it's how we report conflicts and where we clone it
+		if mount.Name == "" || names[mount.Name] {
+			return nil, errors.New(fmt.Sprintf("mount #%d must have a unique, non empty, name", i+1))
+		}
+		names[mount.Name] = true
+
+		if mount.RepoURL == "" && mount.RepoRootDir == "" && mount.SourceArchive == "" {
+			return nil, errors.New(fmt.Sprintf("mount %s must have one of: repo-url, repo-root, source-archive", mount.Name))
+		}
+
+		// Fill up defaults from our flags
+		if mount.RepoRootDir == "" {
+			mount.RepoRootDir = path.Join(*flags.RepoRootDir, mount.Name)
+		}
+		if mount.RepoSSHKey == "" {
+			mount.RepoSSHKey = *flags.RepoSSHKey
+		}
+		if mount.RepoSSHUser == "" {
+			mount.RepoSSHUser = *flags.RepoSSHUser
+		}
+		if mount.RepoBranch == "" {
+			mount.RepoBranch = *flags.RepoBranch
+		}
+		if mount.RepoRemoteName == "" {
+			mount.RepoRemoteName = *flags.RepoRemoteName
+		}
+		if mount.RepoBasePath == "" {
+			mount.RepoBasePath = "/"
+		}
+		if mount.RepoSubmodules == "" {
+			mount.RepoSubmodules = strings.ToLower(*flags.RepoSubmodules)
+		}
+		if mount.RepoLFS == "" {
+			mount.RepoLFS = strings.ToLower(*flags.RepoLFS)
+		}
+		if mount.RepoDepth == 0 {
+			mount.RepoDepth = *flags.RepoDepth
+		}
+		if mount.RepoTrustAnchor == "" {
+			mount.RepoTrustAnchor = *flags.RepoTrustAnchor
+		}
+		if err := mount.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return mounts, nil
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	. "github.com/onsi/gomega"
+
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestBuildMounts(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, _ := ioutil.TempDir("", "gonsul-mounts")
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	sshKey, sshUser, branch, remote, root := "/keys/id_rsa", "git", "master", "origin", "/tmp/gonsul/repo"
+	submodules, lfs, depth := SubmodulesOn, LFSFail, 0
+	anchor := "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+	flags := ConfigFlags{
+		RepoSSHKey:     &sshKey,
+		RepoSSHUser:    &sshUser,
+		RepoBranch:     &branch,
+		RepoRemoteName: &remote,
+		RepoRootDir:    &root,
+		RepoSubmodules: &submodules,
+		RepoLFS:        &lfs,
+		RepoDepth:      &depth,
+		// Commit verification
+		RepoTrustAnchor: &anchor,
+	}
+
+	// A valid file gets its omitted settings from our flags
+	mountsFile := path.Join(dir, "mounts.json")
+	_ = ioutil.WriteFile(mountsFile, []byte(`[
+		{"name": "platform", "repo-url": "git@example.com:platform.git", "repo-branch": "main", "consul-base-path": "platform"},
+		{"name": "bundle", "source-archive": "/tmp/bundle.tgz", "repo-base-path": "config", "repo-submodules": "2", "repo-lfs": "resolve"},
+		{"name": "signed", "repo-root": "/signed", "repo-trust-anchor": "45a81b9041cfaff50b8da101579dd3cf15f6b3c2"}
+	]`), 0600)
+
+	mounts, err := buildMounts(mountsFile, flags)
+	Expect(err).To(BeNil())
+	Expect(mounts).To(HaveLen(3))
+	Expect(mounts[0].RepoBranch).To(Equal("main"))
+	Expect(mounts[0].RepoRootDir).To(Equal("/tmp/gonsul/repo/platform"))
+	Expect(mounts[0].RepoSSHKey).To(Equal(sshKey))
+	Expect(mounts[0].RepoBasePath).To(Equal("/"))
+	Expect(mounts[0].IsCloning()).To(BeTrue())
+	Expect(mounts[1].RepoBasePath).To(Equal("config"))
+	Expect(mounts[1].IsCloning()).To(BeFalse())
+	Expect(mounts[0].SubmoduleDepth()).To(Equal(10))
+	Expect(mounts[1].SubmoduleDepth()).To(Equal(2))
+	Expect(mounts[0].RepoLFS).To(Equal(LFSFail))
+	Expect(mounts[1].RepoLFS).To(Equal(LFSResolve))
+	Expect(mounts[0].RepoTrustAnchor).To(Equal(anchor))
+	Expect(mounts[2].RepoTrustAnchor).To(Equal("45a81b9041cfaff50b8da101579dd3cf15f6b3c2"))
+
+	// Invalid files are refused
+	invalid := []string{
+		`[]`,
+		`[{"repo-url": "git@example.com:platform.git"}]`,
+		`[{"name": "a", "repo-root": "/a"}, {"name": "a", "repo-root": "/b"}]`,
+		`[{"name": "a"}]`,
+		`{"name": "a"}`,
+		`[{"name": "a", "repo-root": "/a", "repo-submodules": "0"}]`,
+		`[{"name": "a", "repo-root": "/a", "repo-lfs": "skip"}]`,
+		`[{"name": "a", "repo-root": "/a", "repo-trust-anchor": "45a81b9"}]`,
+		`[{"name": "a", "repo-root": "/a", "repo-trust-anchor": "main"}]`,
+	}
+	for _, content := range invalid {
+		_ = ioutil.WriteFile(mountsFile, []byte(content), 0600)
+		mounts, err = buildMounts(mountsFile, flags)
+		Expect(err).To(Not(BeNil()), content)
+		Expect(mounts).To(BeNil(), content)
+	}
+}
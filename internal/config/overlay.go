@@ -0,0 +1,58 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// parseOverlays parses our overlay base directory and its comma separated environment directories,
+// all relative to the repository base path
+func parseOverlays(base string, list string) (string, []string, error) {
+	base = cleanOverlayDir(base)
+	if base == "" && list == "" {
+		return "", nil, nil
+	}
+	if base == "" || list == "" {
+		return "", nil, errors.New("overlay-base and overlays must be given together")
+	}
+
+	var overlays []string
+	for _, overlay := range strings.Split(list, ",") {
+		overlay = cleanOverlayDir(overlay)
+		if overlay == "" {
+			return "", nil, errors.New("overlays must not be empty")
+		}
+
+		// Directories can't hold one another, we wouldn't know which one a file is from
+		for _, other := range append([]string{base}, overlays...) {
+			if overlay == other || strings.HasPrefix(overlay, other+"/") || strings.HasPrefix(other, overlay+"/") {
+				return "", nil, errors.New(fmt.Sprintf("overlay (%s) overlaps with %s", overlay, other))
+			}
+		}
+		overlays = append(overlays, overlay)
+	}
+
+	return base, overlays, nil
+}
+
+// cleanOverlayDir cleans an overlay directory, relative to the repository base path
+func cleanOverlayDir(dir string) string {
+	dir = strings.TrimSpace(dir)
+	if dir == "" {
+		return ""
+	}
+
+	return strings.Trim(path.Clean("/"+dir), "/")
+}
+
+// GetOverlayBase returns the directory our overlays are based on, empty if there are no overlays
+func (config *config) GetOverlayBase() string {
+	return config.overlayBase
+}
+
+// GetOverlays returns the directories overriding our overlay base directory, one per environment
+func (config *config) GetOverlays() []string {
+	return config.overlays
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"errors"
+	"path"
+	"strings"
+)
+
+// parseSchemaRules parses our "file/pattern=schema/file,..." schemas flag
+func parseSchemaRules(rules string) ([]fileRule, error) {
+	return parseFileRules(rules, "schema", "schema/file", func(value string) (string, error) {
+		schemaPath := strings.TrimPrefix(path.Clean("/"+value), "/")
+		if schemaPath == "" {
+			return "", errors.New("schema file must not be empty")
+		}
+		return schemaPath, nil
+	})
+}
+
+// GetSchemas returns the JSON Schema files the given file must be valid against, every
+// path being relative to the repository base path
+func (config *config) GetSchemas(filePath string) []string {
+	var schemas []string
+	filePath = strings.TrimPrefix(filePath, "/")
+	for _, rule := range config.schemas {
+		if matched, _ := path.Match(rule.pattern, filePath); matched {
+			schemas = append(schemas, rule.value)
+		}
+	}
+
+	return schemas
+}
+
+// IsSchema tells if the given file is one of our JSON Schema files, which are never exported
+func (config *config) IsSchema(filePath string) bool {
+	filePath = strings.TrimPrefix(filePath, "/")
+	for _, rule := range config.schemas {
+		if rule.value == filePath {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"github.com/miniclip/gonsul/internal/secrets"
+
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Our secret providers namespaces, as in {{vault.secret/app#password}}
+const SecretsEnv = "env"
+const SecretsDir = "dir"
+const SecretsVault = "vault"
+const SecretsSOPS = "sops"
+
+// Our secrets stages, rendering final values (import) or files before parsing them (export)
+const SecretsStageImport = "import"
+const SecretsStageExport = "export"
+
+// buildSecrets builds our secrets from the secrets file map and every configured provider,
+// telling if there is any secret to replace at all
+func buildSecrets(flags ConfigFlags, secretsMap map[string]string) (secrets.ISecrets, bool, error) {
+	providers := map[string]secrets.IProvider{}
+
+	if *flags.SecretsEnv != "" {
+		providers[SecretsEnv] = secrets.NewEnvProvider(*flags.SecretsEnv)
+	}
+
+	if *flags.SecretsDir != "" {
+		providers[SecretsDir] = secrets.NewDirProvider(*flags.SecretsDir)
+	}
+
+	if *flags.VaultAddr != "" {
+		token := *flags.VaultToken
+		if token == "" {
+			token = os.Getenv("VAULT_TOKEN")
+		}
+		client := &http.Client{Timeout: time.Second * time.Duration(*flags.Timeout)}
+		providers[SecretsVault] = secrets.NewVaultProvider(*flags.VaultAddr, token, client)
+	}
+
+	keyFile := *flags.SOPSAgeKeyFile
+	if keyFile == "" {
+		keyFile = os.Getenv("SOPS_AGE_KEY_FILE")
+	}
+	if keyFile != "" {
+		identities, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, false, errors.New(fmt.Sprintf("could not open age key file (%s). Error message: %s", keyFile, err.Error()))
+		}
+		provider, err := secrets.NewSOPSProvider(string(identities))
+		if err != nil {
+			return nil, false, errors.New(fmt.Sprintf("invalid age key file (%s). Error message: %s", keyFile, err.Error()))
+		}
+		providers[SecretsSOPS] = provider
+	}
+
+	doSecrets := secretsMap != nil || len(providers) > 0
+
+	return secrets.NewSecrets(secretsMap, providers), doSecrets, nil
+}
+
+// flattenSecrets adds the secrets of a (nested) secrets file map to the given flat map,
+// nested names being joined by dots
+func flattenSecrets(prefix string, value interface{}, secretsMap map[string]string) error {
+	if tree, ok := value.(map[string]interface{}); ok {
+		for key, child := range tree {
+			name := key
+			if prefix != "" {
+				name = prefix + "." + key
+			}
+			if err := flattenSecrets(name, child, secretsMap); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// A dotted name can't be written both flat and nested
+	for name := range secretsMap {
+		if name == prefix || strings.HasPrefix(name, prefix+".") || strings.HasPrefix(prefix, name+".") {
+			return errors.New(fmt.Sprintf("secret %s conflicts with secret %s", prefix, name))
+		}
+	}
+
+	switch typed := value.(type) {
+	case string:
+		secretsMap[prefix] = typed
+	case json.Number:
+		secretsMap[prefix] = typed.String()
+	case bool:
+		secretsMap[prefix] = strconv.FormatBool(typed)
+	default:
+		return errors.New(fmt.Sprintf("secret %s must be a string, a number, a boolean or a map", prefix))
+	}
+
+	return nil
+}
+
+// GetSecrets returns our secrets, resolving placeholders from the secrets file and our providers
+func (config *config) GetSecrets() secrets.ISecrets {
+	return config.secrets
+}
@@ -4,3 +4,9 @@ type Entry struct {
 	KVPath string
 	Value  string
 }
+
+// SourceEntry is a single directory entry of a file tree our exporter reads
+type SourceEntry struct {
+	Name  string
+	IsDir bool
+}
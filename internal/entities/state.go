@@ -0,0 +1,31 @@
+package entities
+
+// SyncState is the metadata Gonsul writes to Consul alongside the synced keys, so
+// both applications and humans can tell which revision of the configuration is live
+type SyncState struct {
+	Commits  []CommitInfo `json:"commits"`
+	Version  string       `json:"version"`
+	SyncedAt string       `json:"synced_at"`
+	Inserts  int          `json:"inserts"`
+	Updates  int          `json:"updates"`
+	Deletes  int          `json:"deletes"`
+}
+
+// CommitInfo describes the commit a mount was exported from
+type CommitInfo struct {
+	Mount   string `json:"mount"`
+	SHA     string `json:"sha"`
+	Author  string `json:"author"`
+	Date    string `json:"date"`
+	Message string `json:"message"`
+}
+
+// KeyOrigin describes where an exported Consul key comes from
+type KeyOrigin struct {
+	KVPath       string
+	Mount        string
+	File         string
+	DocumentPath string
+	// Commit is the last commit that changed the key value, nil if unknown
+	Commit *CommitInfo
+}
@@ -0,0 +1,259 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+	"github.com/miniclip/gonsul/internal/entities"
+	"github.com/miniclip/gonsul/internal/util"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Blame finds which files (and which path inside them, for expanded files) export
+// the given Consul KV path, along with the last commit that changed its value
+func (e *exporter) Blame(kvPath string) []entities.KeyOrigin {
+	var origins []entities.KeyOrigin
+
+	// Forget about the commits and errors of any previous run
+	e.commits = nil
+	e.errors = nil
+
+	for _, mount := range e.config.GetMounts() {
+		source := newLFSSource(e.openSource(mount), mount, e.logger)
+		start := e.mountCommit(mount)
+
+		// Render every file, keeping track of the file each one is read from
+		var files []sourceFile
+		sourcePaths := map[string]string{}
+		e.walkDir(source, ".", func(filePath string, content []byte) {
+			exportPath, rendered, ok := e.renderFile(source, filePath, string(content))
+			if !ok {
+				return
+			}
+			files = append(files, sourceFile{path: exportPath, content: rendered})
+			sourcePaths[exportPath] = filePath
+		})
+		renderedFiles := map[string]sourceFile{}
+		for _, file := range files {
+			renderedFiles[file.path] = file
+		}
+
+		// Export each file on its own, using the very same mapping and overlays as our exports
+		for _, file := range e.applyOverlays(files) {
+			fileData := map[string]string{}
+			e.parseFile(file.path, file.content, fileData)
+
+			// Overlay files are read from their base file and their own one, if any
+			from := file.from
+			if len(from) == 0 {
+				from = []string{file.path}
+			}
+			var fromSources []string
+			for _, exportPath := range from {
+				fromSources = append(fromSources, sourcePaths[exportPath])
+			}
+
+			for fileKey, value := range fileData {
+				for key := range e.mapSubmodulePrefixes(mount, map[string]string{fileKey: value}) {
+					if e.mountKVPath(mount, key) != kvPath {
+						continue
+					}
+
+					supplier := sourcePaths[e.keySupplier(file, renderedFiles, fileKey)]
+					origin := entities.KeyOrigin{
+						KVPath:       kvPath,
+						Mount:        mount.Name,
+						File:         path.Join(cleanSourcePath(mount.RepoBasePath), supplier),
+						DocumentPath: strings.Trim(strings.TrimPrefix(fileKey, e.config.RewriteKey(e.cleanFilePath(file.path))), "/"),
+					}
+					if start != nil {
+						origin.Commit = e.lastChange(mount, start, file.path, fromSources, fileKey, value)
+					}
+					origins = append(origins, origin)
+				}
+			}
+		}
+	}
+
+	// Broken files are reported as they would be by our exports
+	e.exitOnErrors()
+
+	return origins
+}
+
+// keySupplier returns the path of the file supplying the given key of an exported file: the
+// overlay file of an overlay one if it sets the key itself, its base file otherwise
+func (e *exporter) keySupplier(file sourceFile, renderedFiles map[string]sourceFile, fileKey string) string {
+	if len(file.from) == 0 {
+		return file.path
+	}
+	if len(file.from) == 1 {
+		return file.from[0]
+	}
+
+	// Our overlay file is parsed on its own, as if it was exported without its base one
+	overlayData := map[string]string{}
+	e.tryExport(func() {
+		e.parseFile(file.path, renderedFiles[file.from[1]].content, overlayData)
+	})
+	if _, ok := overlayData[fileKey]; ok {
+		return file.from[1]
+	}
+
+	return file.from[0]
+}
+
+// mountCommit returns the commit exported for the given mount, nil if not a Git one
+func (e *exporter) mountCommit(mount config.Mount) *entities.CommitInfo {
+	for _, commit := range e.commits {
+		if commit.Mount == mount.Name {
+			return &commit
+		}
+	}
+
+	return nil
+}
+
+// lastChange walks our first parent history back from the exported commit, looking for
+// the commit that last changed the value the given exported file holds for the given key.
+// Overlay files are read from each of their source files, merged as our exports do. As we
+// follow first parents only, changes made on a merged branch are blamed on their merge commit
+func (e *exporter) lastChange(mount config.Mount, start *entities.CommitInfo, exportPath string, sourcePaths []string, fileKey string, value string) *entities.CommitInfo {
+	repo, err := git.PlainOpen(mount.RepoRootDir)
+	if err != nil {
+		return nil
+	}
+
+	commit, err := repo.CommitObject(plumbing.NewHash(start.SHA))
+	if err != nil {
+		return nil
+	}
+
+	// Our sources are rooted at the mount base path, Git trees at the repository root
+	var repoFiles []string
+	for _, sourcePath := range sourcePaths {
+		repoFiles = append(repoFiles, path.Join(cleanSourcePath(mount.RepoBasePath), sourcePath))
+	}
+	blobs, ok := fileBlobs(commit, repoFiles)
+	if !ok {
+		// Submodule files have no history on our repository
+		return nil
+	}
+
+	for commit.NumParents() > 0 {
+		parent, err := commit.Parent(0)
+		if err != nil {
+			// Shallow clones have no history beyond their depth
+			e.logger.PrintDebug(fmt.Sprintf("EXPORTER: history of %s stops at %s: %s", repoFiles[0], commit.Hash.String(), err.Error()))
+			break
+		}
+
+		parentBlobs, ok := fileBlobs(parent, repoFiles)
+		if !ok {
+			break
+		}
+
+		// Only files that did change may have a different value
+		if parentBlobs != blobs {
+			parentValue, ok := e.valueAt(parent, repoFiles, sourcePaths, exportPath, fileKey)
+			if !ok || parentValue != value {
+				break
+			}
+		}
+
+		commit, blobs = parent, parentBlobs
+	}
+
+	info := newCommitInfo(mount, commit)
+
+	return &info
+}
+
+// valueAt returns the value the given exported file holds for the given key on the given commit,
+// merging its overlay file (the second one, if any) over its base file as our exports do
+func (e *exporter) valueAt(commit *object.Commit, repoFiles []string, sourcePaths []string, exportPath string, fileKey string) (string, bool) {
+	var contents []string
+	for index, repoFile := range repoFiles {
+		file, err := commit.File(repoFile)
+		if err != nil {
+			// Overlay files may be more recent than their base file
+			if index > 0 {
+				continue
+			}
+			return "", false
+		}
+		content, err := file.Contents()
+		if err != nil {
+			return "", false
+		}
+		contents = append(contents, content)
+	}
+
+	// Older versions of our files are rendered too, but can't include other files
+	fileData := map[string]string{}
+	ok := e.tryExport(func() {
+		var merged string
+		for index, content := range contents {
+			_, rendered, ok := e.renderFile(nil, sourcePaths[index], content)
+			if !ok {
+				return
+			}
+			if index == 0 {
+				merged = rendered
+			} else {
+				merged = e.mergeOverlay(exportPath, merged, rendered)
+			}
+		}
+		e.parseFile(exportPath, merged, fileData)
+	})
+	if !ok {
+		return "", false
+	}
+
+	value, ok := fileData[fileKey]
+
+	return value, ok
+}
+
+// tryExport runs the given export step, telling whether it went fine instead of reporting
+// its errors, as older versions of our files are allowed to be broken
+func (e *exporter) tryExport(step func()) (ok bool) {
+	errorCount := len(e.errors)
+	defer func() {
+		if r := recover(); r != nil {
+			if _, isGonsulError := r.(util.GonsulError); !isGonsulError {
+				panic(r)
+			}
+			ok = false
+		}
+		e.errors = e.errors[:errorCount]
+	}()
+
+	step()
+
+	return len(e.errors) == errorCount
+}
+
+// fileBlobs returns the hashes of the given files blobs on the given commit, as a single
+// string. Only the first file must exist, overlay files may be more recent than their base one
+func fileBlobs(commit *object.Commit, repoFiles []string) (string, bool) {
+	var blobs []string
+	for index, repoFile := range repoFiles {
+		file, err := commit.File(repoFile)
+		if err != nil {
+			if index > 0 {
+				blobs = append(blobs, plumbing.ZeroHash.String())
+				continue
+			}
+			return "", false
+		}
+		blobs = append(blobs, file.Hash.String())
+	}
+
+	return strings.Join(blobs, ","), true
+}
@@ -0,0 +1,158 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+	"github.com/miniclip/gonsul/internal/entities"
+	"github.com/miniclip/gonsul/internal/util"
+	"github.com/miniclip/gonsul/tests/mocks"
+
+	. "github.com/onsi/gomega"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// blameConfig is the configuration blaming a key depends on, on top of the given one if any
+func blameConfig(mount config.Mount, configs ...*mocks.IConfig) *mocks.IConfig {
+	cfg := &mocks.IConfig{}
+	if len(configs) > 0 {
+		cfg = configs[0]
+	}
+	cfg.On("GetMounts").Return([]config.Mount{mount})
+	cfg.On("GetConsulBasePath").Return("")
+	cfg.On("GetRepoGPGKeyring").Return("")
+	cfg.On("GetRepoSSHAllowedSigners").Return("")
+
+	return exportDefaults(cfg)
+}
+
+// commitFile writes the given file on our repository work tree and commits it
+func commitFile(repo *git.Repository, root string, file string, content string, message string) plumbing.Hash {
+	Expect(os.MkdirAll(filepath.Dir(filepath.Join(root, file)), 0755)).To(Succeed())
+	Expect(ioutil.WriteFile(filepath.Join(root, file), []byte(content), 0644)).To(Succeed())
+
+	worktree, err := repo.Worktree()
+	Expect(err).To(BeNil())
+	_, err = worktree.Add(file)
+	Expect(err).To(BeNil())
+
+	hash, err := worktree.Commit(message, &git.CommitOptions{
+		Author: &object.Signature{Name: "Jane", Email: "jane@example.com", When: time.Unix(1622542908, 0)},
+	})
+	Expect(err).To(BeNil())
+
+	return hash
+}
+
+func TestBlame(t *testing.T) {
+	RegisterTestingT(t)
+
+	root, err := ioutil.TempDir("", "gonsul-blame")
+	Expect(err).To(BeNil())
+	defer os.RemoveAll(root)
+
+	repo, err := git.PlainInit(root, false)
+	Expect(err).To(BeNil())
+
+	commitFile(repo, root, "config/app1.yaml", "db:\n  host: a\n  port: 1\n", "Add app1")
+	hostChange := commitFile(repo, root, "config/app1.yaml", "db:\n  host: b\n  port: 1\n", "Move app1 database")
+	portChange := commitFile(repo, root, "config/app1.yaml", "db:\n  host: b\n  port: 2\n", "Change app1 database port")
+	commitFile(repo, root, "config/app2.yaml", "db:\n  host: c\n", "Add app2")
+
+	mount := config.Mount{Name: "default", RepoRootDir: root, RepoBasePath: "config", ConsulBasePath: "apps"}
+	e := &exporter{config: blameConfig(mount), logger: util.NewLogger(0)}
+
+	// Our document path is the path inside the file, and only commits changing the value count
+	origins := e.Blame("apps/app1/db/host")
+	Expect(origins).To(HaveLen(1))
+	Expect(origins[0].KVPath).To(Equal("apps/app1/db/host"))
+	Expect(origins[0].Mount).To(Equal("default"))
+	Expect(origins[0].File).To(Equal("config/app1.yaml"))
+	Expect(origins[0].DocumentPath).To(Equal("db/host"))
+	Expect(origins[0].Commit).To(Equal(&entities.CommitInfo{
+		Mount:   "default",
+		SHA:     hostChange.String(),
+		Author:  "Jane <jane@example.com>",
+		Date:    "2021-06-01T10:21:48Z",
+		Message: "Move app1 database",
+	}))
+
+	// A later commit of the same file blames the keys it changed
+	origins = e.Blame("apps/app1/db/port")
+	Expect(origins).To(HaveLen(1))
+	Expect(origins[0].Commit.SHA).To(Equal(portChange.String()))
+
+	// Keys nobody exports are blamed on no file
+	Expect(e.Blame("apps/app1/db/user")).To(BeEmpty())
+}
+
+func TestLastChangeStopsAtBrokenFiles(t *testing.T) {
+	RegisterTestingT(t)
+
+	root, err := ioutil.TempDir("", "gonsul-blame")
+	Expect(err).To(BeNil())
+	defer os.RemoveAll(root)
+
+	repo, err := git.PlainInit(root, false)
+	Expect(err).To(BeNil())
+
+	// An older version that can't be parsed ends our walk, without any error reported
+	commitFile(repo, root, "app1.yaml", "db:\n  host: [a\n", "Add a broken app1")
+	fixed := commitFile(repo, root, "app1.yaml", "db:\n  host: a\n", "Fix app1")
+	head := commitFile(repo, root, "app2.yaml", "db:\n  host: c\n", "Add app2")
+
+	mount := config.Mount{Name: "default", RepoRootDir: root}
+	e := &exporter{config: blameConfig(mount), logger: util.NewLogger(0)}
+
+	start := &entities.CommitInfo{Mount: "default", SHA: head.String()}
+	commit := e.lastChange(mount, start, "app1.yaml", []string{"app1.yaml"}, "app1/db/host", "a")
+	Expect(commit).To(Not(BeNil()))
+	Expect(commit.SHA).To(Equal(fixed.String()))
+	Expect(e.errors).To(BeEmpty())
+
+	// Files missing from our commit have no history to walk
+	Expect(e.lastChange(mount, start, "app3.yaml", []string{"app3.yaml"}, "app3/db/host", "a")).To(BeNil())
+}
+
+func TestBlameOverlays(t *testing.T) {
+	RegisterTestingT(t)
+
+	root, err := ioutil.TempDir("", "gonsul-blame")
+	Expect(err).To(BeNil())
+	defer os.RemoveAll(root)
+
+	repo, err := git.PlainInit(root, false)
+	Expect(err).To(BeNil())
+
+	hostChange := commitFile(repo, root, "base/app/config.yaml", "db:\n  host: db.internal\n  port: 5432\n", "Add app")
+	portChange := commitFile(repo, root, "dev/app/config.yaml", "db:\n  port: 5433\n", "Change dev port")
+	commitFile(repo, root, "base/app/config.yaml", "db:\n  host: db.internal\n  port: 6432\n", "Change base port")
+
+	mount := config.Mount{Name: "default", RepoRootDir: root}
+	cfg := &mocks.IConfig{}
+	cfg.On("GetOverlayBase").Return("base")
+	cfg.On("GetOverlays").Return([]string{"dev"})
+	e := &exporter{config: blameConfig(mount, cfg), logger: util.NewLogger(0)}
+
+	// Keys inherited from the base file are blamed on it, under their overlay path
+	origins := e.Blame("dev/app/config/db/host")
+	Expect(origins).To(HaveLen(1))
+	Expect(origins[0].File).To(Equal("base/app/config.yaml"))
+	Expect(origins[0].DocumentPath).To(Equal("db/host"))
+	Expect(origins[0].Commit.SHA).To(Equal(hostChange.String()))
+
+	// While keys the overlay file sets are blamed on it, base changes they override left alone
+	origins = e.Blame("dev/app/config/db/port")
+	Expect(origins).To(HaveLen(1))
+	Expect(origins[0].File).To(Equal("dev/app/config.yaml"))
+	Expect(origins[0].Commit.SHA).To(Equal(portChange.String()))
+
+	// Base files are only exported under their overlays
+	Expect(e.Blame("base/app/config/db/host")).To(BeEmpty())
+}
@@ -2,36 +2,116 @@ package exporter
 
 import (
 	"github.com/miniclip/gonsul/internal/entities"
+	"github.com/miniclip/gonsul/internal/util"
 
 	"fmt"
-	"io/ioutil"
 	"path"
 	"path/filepath"
 	"strings"
 )
 
-// traverse is our entry point function to start traversing a given directory.
-// this is a recursive function, as it will call itself whenever we hit a sub folder
-func (e *exporter) parseDir(directory string, localData map[string]string) {
-	// Read the entire directory
-	files, _ := ioutil.ReadDir(directory)
+// parseDir is our entry point function to start traversing a given source directory.
+// every valid file found is parsed into the given local data
+func (e *exporter) parseDir(source ISource, directory string, localData map[string]string) {
+	schemas := map[string]*schema{}
+	owners := map[string]keyOwner{}
+	parse := func(file sourceFile) {
+		// Files with references are validated once their references are resolved
+		if e.config.DoReferences() && len(e.config.GetSchemas(file.path)) > 0 && referencePattern.MatchString(file.content) {
+			e.referencing = append(e.referencing, referencingFile{source: source, file: file, schemas: schemas})
+		} else {
+			e.validateSchemas(source, file.path, file.content, schemas)
+		}
+		fileData := map[string]string{}
+		originals := e.parseFile(file.path, file.content, fileData)
+		e.mergeFileKeys(file.path, fileData, originals, localData, owners)
+	}
+
+	// Overlay directories are resolved over their base once every file is rendered,
+	// otherwise files are parsed as soon as they're read
+	var files []sourceFile
+	overlays := e.config.GetOverlayBase() != ""
+	e.walkDir(source, directory, func(filePath string, content []byte) {
+		exportPath, value, ok := e.renderFile(source, filePath, string(content))
+		if !ok {
+			return
+		}
+
+		file := sourceFile{path: exportPath, content: value}
+		if overlays {
+			files = append(files, file)
+			return
+		}
+		parse(file)
+	})
+
+	for _, file := range e.applyOverlays(files) {
+		parse(file)
+	}
+}
+
+// renderFile renders the templates or secrets of a file, returning the path it's exported as
+// along with its final content. It tells whether the file could be rendered at all
+func (e *exporter) renderFile(source ISource, filePath string, content string) (string, string, bool) {
+	// Snippets are included first, as part of the file
+	if e.config.DoReferences() {
+		included, ok := e.resolveIncludes(source, []string{filePath}, content)
+		if !ok {
+			return "", "", false
+		}
+		content = included
+	}
+
+	// Template files are rendered with their own engine, instead of mustache
+	if exportPath, isTemplate := e.templateFile(filePath); isTemplate {
+		rendered, ok := e.renderTemplate(source, filePath, content)
+		return exportPath, rendered, ok
+	}
+
+	// Secrets are replaced first, so files are validated and parsed with their actual values
+	if e.shouldRenderSecrets() {
+		rendered, ok := e.renderSecrets(filePath, content)
+		return filePath, rendered, ok
+	}
+
+	return filePath, content, true
+}
+
+// walkDir calls the given function for each file with a valid extension on the given source
+// directory. this is a recursive function, as it will call itself whenever we hit a sub folder
+func (e *exporter) walkDir(source ISource, directory string, fn func(filePath string, content []byte)) {
+	// Read the entire directory, an unreadable one would otherwise delete all its keys from Consul
+	files, err := source.ReadDir(directory)
+	if err != nil {
+		e.addError(util.ErrorFailedReadingSource, fmt.Sprintf("EXPORTER: could not read directory %s: %s", directory, err.Error()))
+		return
+	}
 	// Loop each entry
 	for _, file := range files {
-		if file.IsDir() {
+		if file.IsDir {
 			// We found a directory, recurse it
-			newDir := directory + "/" + file.Name()
-			e.parseDir(newDir, localData)
+			newDir := path.Join(directory, file.Name)
+			e.walkDir(source, newDir, fn)
 		} else {
-			filePath := directory + "/" + file.Name()
-			ext := filepath.Ext(filePath)
-			if !e.isExtensionValid(ext) {
+			filePath := path.Join(directory, file.Name)
+			// Template files are exported as the file they render
+			exportPath, _ := e.templateFile(filePath)
+			ext := filepath.Ext(exportPath)
+			// Schema files describe other files, they're never exported themselves
+			if !e.isExtensionValid(ext) || e.config.IsSchema(filePath) {
 				continue
 			}
-			content, err := ioutil.ReadFile(filePath) // just pass the file name
+			content, err := source.ReadFile(filePath) // just pass the file name
 			if err != nil {
-				fmt.Print(err)
+				// Files we can't read are reported once we're done with every file
+				if exportErr, ok := err.(exportError); ok {
+					e.errors = append(e.errors, exportErr)
+				} else {
+					e.addError(util.ErrorFailedReadingSource, fmt.Sprintf("EXPORTER: could not read file %s: %s", filePath, err.Error()))
+				}
+				continue
 			}
-			e.parseFile(filePath, string(content), localData)
+			fn(filePath, content)
 		}
 	}
 }
@@ -47,61 +127,66 @@ func (e *exporter) isExtensionValid(extension string) bool {
 	return false
 }
 
-// parseFile ...
-func (e *exporter) parseFile(filePath string, value string, localData map[string]string) {
+// parseFile parses a file into the given local data, its keys being rewritten and validated
+// by our key rules. It returns the key each key was rewritten from
+func (e *exporter) parseFile(filePath string, value string, localData map[string]string) map[string]string {
+	fileData := map[string]string{}
+	e.extractKeys(filePath, value, fileData)
+
+	return e.applyKeyRules(filePath, fileData, localData)
+}
+
+// extractKeys ...
+func (e *exporter) extractKeys(filePath string, value string, localData map[string]string) {
 	// Extract our file extension and cleanup file path
 	ext := filepath.Ext(filePath)
 	cleanedPath := e.cleanFilePath(filePath)
 
-	// Check if the file is a JSON one
-	if ext == ".json" {
-		// Check if we should parse JSON files
-		if e.config.ShouldExpandJSON() {
-			// Great, we should iterate our JSON (And that's the value)
-			e.expandJSON(cleanedPath, value, localData)
+	// Check if the file is a structured one
+	documentFormat := ""
+	if format := findFormat(ext); format != nil {
+		output := e.outputFormat(filePath, format)
+
+		// Check if we should expand its files
+		if e.config.ShouldExpand(format.Name()) {
+			// Great, we should iterate our document (And that's the value)
+			e.expandDocument(format, output, cleanedPath, value, e.config.GetArrayMode(filePath), localData)
 
 			// we must return here, to avoid importing the file as blob
 			return
 		}
 
-		// Not expanding json file, but we should validate anyways
-		// HEADS UP: Below function will exit program if any error found
-		_ = e.validateJSON(cleanedPath, value)
-	}
-
-	// Check if the file is a YAML one
-	if ext == ".yaml" {
-		// Check if we should parse JSON files
-		if e.config.ShouldExpandYAML() {
-			// Great, we should iterate our JSON (And that's the value)
-			e.expandYAML(cleanedPath, value, localData)
-
-			// we must return here, to avoid importing the file as blob
+		// Not expanding the file, but we should validate anyways (or write it as a canonical
+		// document). Broken files are reported once we're done with every file
+		valid := false
+		if e.config.GetOutputFormat(filePath) != "" {
+			value, valid = e.convertDocument(format, output, cleanedPath, value)
+		} else {
+			_, _, valid = e.validateDocument(format, cleanedPath, value)
+		}
+		if !valid {
 			return
 		}
-
-		// Not expanding json file, but we should validate anyways
-		// HEADS UP: Below function will exit program if any error found
-		_ = e.validateYAML(cleanedPath, value)
+		documentFormat = output.Name()
 	}
 
-	// Not expanding JSON files, create new single "piece" with the
+	// Not expanding the file, create new single "piece" with the
 	// value given (the file content) and add to collection
 	piece := e.createPiece(cleanedPath, value)
 	localData[piece.KVPath] = piece.Value
+	if documentFormat != "" {
+		e.markDocument(piece.KVPath, documentFormat)
+	}
 }
 
 // cleanFilePath ...
 func (e *exporter) cleanFilePath(filePath string) string {
-	// Set part of the config that should be removed from the current
-	// file system path in order to build our final Consul KV path
-	replace := path.Join(e.config.GetRepoRootDir(), e.config.GetRepoBasePath())
-	// Remove the above from the file system path
-	entryFilePath := strings.Replace(filePath, replace, "", 1)
-	// Remove any left slash
-	entryFilePath = strings.Replace(entryFilePath, "/", "", 1)
+	// Source paths are already relative to the repo base path, which
+	// is exactly the hierarchy we want to build our Consul KV path
+	entryFilePath := strings.TrimPrefix(filePath, "/")
 	// Set or not the file extension when importing to consul k/v the file
-	if !e.config.KeepFileExt() {
+	// (dot files such as .env are named after their extension, they keep it)
+	if !e.config.KeepFileExt() && filepath.Ext(entryFilePath) != path.Base(entryFilePath) {
 		entryFilePath = strings.TrimSuffix(entryFilePath, filepath.Ext(entryFilePath))
 	}
 
@@ -110,19 +195,7 @@ func (e *exporter) cleanFilePath(filePath string) string {
 
 // createPiece ...
 func (e *exporter) createPiece(piecePath string, value string) entities.Entry {
-	// Create our Consul base path variable
-	var kvPath string
-
-	// Check if we have a Consul KV base path
-	if e.config.GetConsulBasePath() != "" {
-		kvPath = e.config.GetConsulBasePath()
-	}
-
-	// Finally append the Consul KV base path to the file path, if base is not an empty string
-	if kvPath != "" {
-		fullPath := path.Join(kvPath, piecePath)
-		return entities.Entry{KVPath: fullPath, Value: value}
-	}
-
+	// Pieces are relative to the mount being exported, the mount
+	// and Consul KV base paths are prefixed when merging mounts
 	return entities.Entry{KVPath: piecePath, Value: value}
 }
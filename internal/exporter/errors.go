@@ -0,0 +1,38 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/util"
+
+	"errors"
+	"fmt"
+)
+
+// exportError is an error found while exporting our files. Instead of exiting on the first
+// one, they're all kept so a single run reports every broken file
+type exportError struct {
+	message string
+	code    int
+}
+
+// Error ...
+func (err exportError) Error() string {
+	return err.message
+}
+
+// addError keeps track of an error found while exporting, along with the exit code it deserves
+func (e *exporter) addError(code int, message string) {
+	e.errors = append(e.errors, exportError{message: message, code: code})
+}
+
+// exitOnErrors prints every error found while exporting, if any, and exits with the
+// code of the first one
+func (e *exporter) exitOnErrors() {
+	if len(e.errors) == 0 {
+		return
+	}
+
+	for _, err := range e.errors {
+		e.logger.PrintError(err.message)
+	}
+	util.ExitError(errors.New(fmt.Sprintf("EXPORTER: %d errors found", len(e.errors))), e.errors[0].code, e.logger)
+}
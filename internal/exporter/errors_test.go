@@ -0,0 +1,80 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+	"github.com/miniclip/gonsul/internal/util"
+	"github.com/miniclip/gonsul/tests/mocks"
+
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// exportDefaults completes the given configuration with what walking a whole directory
+// depends on, expectations a test set first taking precedence over these
+func exportDefaults(cfg *mocks.IConfig) *mocks.IConfig {
+	cfg.On("GetNullPolicy").Return("")
+	cfg.On("IsExpandStrict").Return(false)
+	cfg.On("GetExpandDepth").Return(0)
+	cfg.On("GetValidExtensions").Return([]string{"json", "yaml", "txt"})
+	cfg.On("IsSchema", mock.Anything).Return(false)
+	cfg.On("GetSchemas", mock.Anything).Return(nil)
+	cfg.On("ShouldExpand", mock.Anything).Return(func(format string) bool { return format == config.FormatYAML })
+	cfg.On("GetArrayMode", mock.Anything).Return(config.ArraysJSON)
+	cfg.On("GetOutputFormat", mock.Anything).Return("")
+	cfg.On("KeepFileExt").Return(false)
+	cfg.On("DoSecrets").Return(false)
+	cfg.On("GetTemplateExt").Return("")
+	cfg.On("DoReferences").Return(false)
+	cfg.On("GetOverlayBase").Return("")
+	cfg.On("RewriteKey", mock.Anything).Return(func(key string) string { return key })
+	cfg.On("ValidateKey", mock.Anything).Return(nil)
+
+	return cfg
+}
+
+func TestParseDirCollectsErrors(t *testing.T) {
+	RegisterTestingT(t)
+
+	memory := newMemSource()
+	memory.addFile("a/broken.json", []byte("{\n  \"key\": \"value\",\n}"))
+	memory.addFile("a/fine.json", []byte(`{"key": "value"}`))
+	memory.addFile("b/broken.yaml", []byte("key: [value\n"))
+	memory.addFile("c/pointer.txt", []byte("version https://git-lfs.github.com/spec/v1\noid sha256:"+
+		"4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\nsize 12345\n"))
+	source := newLFSSource(memory, config.Mount{RepoLFS: config.LFSFail}, util.NewLogger(0))
+
+	e := &exporter{config: exportDefaults(&mocks.IConfig{}), logger: util.NewLogger(0)}
+	localData := map[string]string{}
+	e.parseDir(source, ".", localData)
+
+	// Valid files are still exported, every broken one is reported
+	Expect(localData).To(Equal(map[string]string{"a/fine": `{"key": "value"}`}))
+	Expect(e.errors).To(HaveLen(3))
+	Expect(e.errors[0].message).To(Equal("error parsing JSON file: a/broken with Message: line 3, column 1: invalid character '}' looking for beginning of object key string"))
+	Expect(e.errors[1].message).To(ContainSubstring("error parsing YAML file: b/broken with Message: yaml: line 1"))
+	Expect(e.errors[2].code).To(Equal(util.ErrorFailedLFS))
+
+	// And we exit once, with the first error code
+	Expect(e.exitOnErrors).To(PanicWith(util.GonsulError{Code: util.ErrorFailedJsonDecode}))
+}
+
+func TestStartFailsOnMissingBasePath(t *testing.T) {
+	RegisterTestingT(t)
+
+	root, err := ioutil.TempDir("", "gonsul-base-path")
+	Expect(err).To(BeNil())
+	defer os.RemoveAll(root)
+	Expect(ioutil.WriteFile(root+"/app.json", []byte(`{"key": "value"}`), 0644)).To(BeNil())
+
+	// A base path we can't read is an error, not an empty export deleting every key
+	e := NewExporter(blameConfig(config.Mount{Name: "default", RepoRootDir: root, RepoBasePath: "missing"}), util.NewLogger(0))
+	Expect(func() { e.Start() }).To(PanicWith(util.GonsulError{Code: util.ErrorFailedReadingSource}))
+
+	// While an existing one is exported
+	e = NewExporter(blameConfig(config.Mount{Name: "default", RepoRootDir: root, RepoBasePath: "/"}), util.NewLogger(0))
+	Expect(e.Start()).To(Equal(map[string]string{"app": `{"key": "value"}`}))
+}
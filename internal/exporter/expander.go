@@ -1,45 +1,161 @@
 package exporter
 
 import (
+	"github.com/miniclip/gonsul/internal/config"
+	"github.com/miniclip/gonsul/internal/util"
+
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 // traverseJSON ...
-func (e *exporter) traverseMap(path string, arbitraryJSON map[string]interface{}, localData map[string]string) {
+func (e *exporter) traverseMap(path string, arbitraryJSON map[string]interface{}, arrayMode string, localData map[string]string) {
 	for key, value := range arbitraryJSON {
 		// Append key to path
-		newPath := path + "/" + key
+		e.traverseValue(path+"/"+key, value, arrayMode, localData)
+	}
+}
 
-		switch value.(type) {
-		case string:
-			// We have a string value, create piece and add to collection
-			piece := e.createPiece(newPath, value.(string))
-			localData[piece.KVPath] = piece.Value
+// traverseValue adds the given value to our collection, recursing into objects and arrays
+func (e *exporter) traverseValue(path string, value interface{}, arrayMode string, localData map[string]string) {
+	switch value.(type) {
+	case []interface{}:
+		// We have an array - ohoh, arrays inside consul are... well are not!
+		e.traverseArray(path, value.([]interface{}), arrayMode, localData)
 
-		case bool:
-			// We have a string value, create piece and add to collection
-			piece := e.createPiece(newPath, strconv.FormatBool(value.(bool)))
-			localData[piece.KVPath] = piece.Value
+	case map[string]interface{}:
+		// we have an object, recurse casting the value
+		e.traverseMap(path, value.(map[string]interface{}), arrayMode, localData)
 
-		case float64:
-			// We have a "Javascript number" -> always floating point. Create piece and add to collection
-			piece := e.createPiece(newPath, fmt.Sprint(value.(float64)))
-			localData[piece.KVPath] = piece.Value
+	case blob:
+		// We have a subtree not to be expanded, add it as a whole
+		piece := e.createPiece(path, value.(blob).encoded)
+		localData[piece.KVPath] = piece.Value
+		e.markDocument(piece.KVPath, value.(blob).format.Name())
 
-		case int:
-			piece := e.createPiece(newPath, fmt.Sprint(value.(int)))
-			localData[piece.KVPath] = piece.Value
+	case nil:
+		// We have a null, follow our null policy
+		e.traverseNull(path, localData)
 
-		case []interface{}:
-			// We have an array - ohoh
-			// Array inside consul are... well are not! Insert as string for now
-			piece := e.createPiece(newPath, fmt.Sprint(value.([]interface{})))
+	default:
+		// We have a scalar value, create piece and add to collection
+		if scalar, ok := formatScalar(value); ok {
+			piece := e.createPiece(path, scalar)
 			localData[piece.KVPath] = piece.Value
+		}
+	}
+}
+
+// traverseNull handles a null value following our null policy
+func (e *exporter) traverseNull(path string, localData map[string]string) {
+	switch e.config.GetNullPolicy() {
+	case config.NullsEmpty:
+		// Written empty on purpose, which our importer would skip otherwise
+		piece := e.createPiece(path, "")
+		localData[piece.KVPath] = piece.Value
+		e.empty[piece.KVPath] = true
+
+	case config.NullsSkip:
+		// Not exported, but whatever is in Consul is left untouched
+		e.skipped[path] = true
+
+	default:
+		// Not exported at all, so it's deleted from Consul
+		e.logger.PrintDebug("EXPORTER: null value not exported: " + path)
+	}
+}
+
+// traverseArray adds the given array to our collection, following the given array expansion mode
+func (e *exporter) traverseArray(path string, array []interface{}, arrayMode string, localData map[string]string) {
+	switch arrayMode {
+	case config.ArraysIndexed:
+		// Each item is a child key named after its index, objects and arrays are recursed
+		for index, item := range array {
+			e.traverseValue(path+"/"+strconv.Itoa(index), item, arrayMode, localData)
+		}
 
-		case map[string]interface{}:
-			// we have an object, recurse casting the value
-			e.traverseMap(newPath, value.(map[string]interface{}), localData)
+	case config.ArraysCSV:
+		// Scalars are written as is, any nested object or array as JSON
+		items := make([]string, 0, len(array))
+		for _, item := range array {
+			scalar, ok := formatScalar(item)
+			if !ok && item != nil {
+				scalar = e.encodeJSON(path, item)
+			}
+			items = append(items, scalar)
 		}
+		piece := e.createPiece(path, encodeCSV(items))
+		localData[piece.KVPath] = piece.Value
+		e.markDocument(piece.KVPath, documentCSV)
+
+	default:
+		piece := e.createPiece(path, e.encodeJSON(path, array))
+		localData[piece.KVPath] = piece.Value
+		e.markDocument(piece.KVPath, config.FormatJSON)
+	}
+}
+
+// encodeCSV writes the given items as a single CSV record, quoting the items holding
+// commas, quotes or new lines so they're read back as they are
+func encodeCSV(items []string) string {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	_ = writer.Write(items)
+	writer.Flush()
+
+	return strings.TrimSuffix(buffer.String(), "\n")
+}
+
+// formatScalar returns the given scalar value as a Consul value, telling if it's a scalar at all
+func formatScalar(value interface{}) (string, bool) {
+	switch value.(type) {
+	case string:
+		return value.(string), true
+	case bool:
+		return strconv.FormatBool(value.(bool)), true
+	case json.Number:
+		// JSON numbers are kept exactly as written
+		return value.(json.Number).String(), true
+	case float64:
+		return strconv.FormatFloat(value.(float64), 'f', -1, 64), true
+	case int:
+		return strconv.Itoa(value.(int)), true
+	case int64:
+		return strconv.FormatInt(value.(int64), 10), true
+	case uint64:
+		return strconv.FormatUint(value.(uint64), 10), true
+	}
+
+	return "", false
+}
+
+// encodeJSON encodes the given value as a compact JSON string
+func (e *exporter) encodeJSON(path string, value interface{}) string {
+	encoded, err := marshalJSON(value)
+	if err != nil {
+		util.ExitError(
+			errors.New(fmt.Sprintf("error encoding %s as JSON with Message: %s", path, err.Error())),
+			util.ErrorFailedJsonEncode,
+			e.logger,
+		)
+	}
+
+	return encoded
+}
+
+// marshalJSON encodes the given value as a compact JSON string, as is (no HTML escaping)
+func marshalJSON(value interface{}) (string, error) {
+	buffer := &bytes.Buffer{}
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return "", err
 	}
+
+	return strings.TrimSuffix(buffer.String(), "\n"), nil
 }
@@ -0,0 +1,119 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/util"
+
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// blobMarker is the reserved key marking a nested object to be stored as a single value
+const blobMarker = "_gonsul_blob"
+
+// blob is a subtree stored as a single value, encoded in the format of the file it comes from
+type blob struct {
+	format  IFormat
+	encoded string
+	value   interface{}
+}
+
+// MarshalJSON encodes our subtree whenever it sits inside an array written as JSON
+func (b blob) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.value)
+}
+
+// reachedDepth tells if values at the given depth (top level keys being 1) must not be expanded any further
+func (e *exporter) reachedDepth(depth int) bool {
+	return e.config.GetExpandDepth() > 0 && depth >= e.config.GetExpandDepth()
+}
+
+// collapse replaces the subtrees we should not expand, either marked or too deep, by blobs
+func (e *exporter) collapse(format IFormat, path string, value interface{}, depth int) interface{} {
+	switch value.(type) {
+	case map[string]interface{}:
+		object := value.(map[string]interface{})
+		if object[blobMarker] == true || e.reachedDepth(depth) {
+			stripBlobMarkers(object)
+			return e.encodeBlob(format, path, object)
+		}
+		// Objects marked false are expanded as usual, without their marker
+		delete(object, blobMarker)
+		for key, child := range object {
+			object[key] = e.collapse(format, path, child, depth+1)
+		}
+
+	case []interface{}:
+		array := value.([]interface{})
+		if e.reachedDepth(depth) {
+			stripBlobMarkers(array)
+			return e.encodeBlob(format, path, array)
+		}
+		for index, child := range array {
+			array[index] = e.collapse(format, path, child, depth+1)
+		}
+	}
+
+	return value
+}
+
+// checkBlobMarkers reports every blob marker of the given subtree which is not a boolean, as we
+// can't tell whether it should be kept as a whole. It tells whether all of them are booleans
+func (e *exporter) checkBlobMarkers(format IFormat, path string, value interface{}) bool {
+	valid := true
+	switch value.(type) {
+	case map[string]interface{}:
+		object := value.(map[string]interface{})
+		if marker, ok := object[blobMarker]; ok {
+			if _, isBool := marker.(bool); !isBool {
+				e.addError(
+					util.ErrorFailedJsonDecode,
+					fmt.Sprintf("error parsing %s file: %s with Message: %s must be true or false, not %v", strings.ToUpper(format.Name()), path, blobMarker, marker),
+				)
+				valid = false
+			}
+		}
+		for _, child := range object {
+			valid = e.checkBlobMarkers(format, path, child) && valid
+		}
+
+	case []interface{}:
+		for _, child := range value.([]interface{}) {
+			valid = e.checkBlobMarkers(format, path, child) && valid
+		}
+	}
+
+	return valid
+}
+
+// stripBlobMarkers removes every blob marker from the given subtree, they're meaningless inside a blob
+func stripBlobMarkers(value interface{}) {
+	switch value.(type) {
+	case map[string]interface{}:
+		object := value.(map[string]interface{})
+		delete(object, blobMarker)
+		for _, child := range object {
+			stripBlobMarkers(child)
+		}
+
+	case []interface{}:
+		for _, child := range value.([]interface{}) {
+			stripBlobMarkers(child)
+		}
+	}
+}
+
+// encodeBlob encodes the given subtree in the given format
+func (e *exporter) encodeBlob(format IFormat, path string, value interface{}) blob {
+	encoded, err := format.Encode(value)
+	if err != nil {
+		util.ExitError(
+			errors.New(fmt.Sprintf("error encoding %s as %s with Message: %s", path, strings.ToUpper(format.Name()), err.Error())),
+			util.ErrorFailedJsonEncode,
+			e.logger,
+		)
+	}
+
+	return blob{format: format, encoded: encoded, value: value}
+}
@@ -0,0 +1,161 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+	"github.com/miniclip/gonsul/internal/util"
+	"github.com/miniclip/gonsul/tests/mocks"
+
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestTraverseMapArrayModes(t *testing.T) {
+	RegisterTestingT(t)
+
+	e := &exporter{}
+	document, _, _ := jsonFormat{}.Decode(`{"hosts": ["a", "b"], "tags": ["x,y", "say \"hi\""], "pools": [{"name": "x", "size": 10}], "big": 1000000, "ratio": 0.25}`)
+
+	// JSON mode writes valid JSON, keeping nested objects
+	localData := map[string]string{}
+	e.traverseMap("app", document, config.ArraysJSON, localData)
+	Expect(localData).To(Equal(map[string]string{
+		"app/hosts": `["a","b"]`,
+		"app/tags":  `["x,y","say \"hi\""]`,
+		"app/pools": `[{"name":"x","size":10}]`,
+		"app/big":   "1000000",
+		"app/ratio": "0.25",
+	}))
+
+	// Indexed mode creates a child key per item, recursing into objects
+	localData = map[string]string{}
+	e.traverseMap("app", document, config.ArraysIndexed, localData)
+	Expect(localData).To(HaveKeyWithValue("app/hosts/0", "a"))
+	Expect(localData).To(HaveKeyWithValue("app/hosts/1", "b"))
+	Expect(localData).To(HaveKeyWithValue("app/pools/0/name", "x"))
+	Expect(localData).To(HaveKeyWithValue("app/pools/0/size", "10"))
+	Expect(localData).To(Not(HaveKey("app/hosts")))
+
+	// CSV mode joins scalars, writing nested objects as JSON, quoting items as CSV does
+	localData = map[string]string{}
+	e.traverseMap("app", document, config.ArraysCSV, localData)
+	Expect(localData).To(HaveKeyWithValue("app/hosts", "a,b"))
+	Expect(localData).To(HaveKeyWithValue("app/tags", `"x,y","say ""hi"""`))
+	Expect(localData).To(HaveKeyWithValue("app/pools", `"{""name"":""x"",""size"":10}"`))
+}
+
+// expandConfig is the configuration our document expansion depends on
+func expandConfig(nullPolicy string, strict bool, depth int) *mocks.IConfig {
+	cfg := &mocks.IConfig{}
+	cfg.On("GetNullPolicy").Return(nullPolicy)
+	cfg.On("IsExpandStrict").Return(strict)
+	cfg.On("GetExpandDepth").Return(depth)
+
+	return cfg
+}
+
+func TestExpandYAMLTypes(t *testing.T) {
+	RegisterTestingT(t)
+
+	document := `
+defaults: &defaults
+  pool: 10
+  ratio: 1.0
+app:
+  <<: *defaults
+  ratio: 2.50
+  big: 123456789012345678901234
+  hex: 0x1F
+  date: 2021-01-02
+  enabled: yes
+  off: false
+  limit: .inf
+  empty: ~
+  1: numeric key
+  hosts: [a, ~]
+  ref: !Ref other
+`
+	e := &exporter{config: expandConfig(config.NullsEmpty, false, 0), logger: util.NewLogger(0), skipped: map[string]bool{}, empty: map[string]bool{}}
+	localData := map[string]string{}
+	e.expandDocument(yamlFormat{}, yamlFormat{}, "file", document, config.ArraysJSON, localData)
+
+	Expect(localData).To(Equal(map[string]string{
+		"file/defaults/pool":  "10",
+		"file/defaults/ratio": "1.0",
+		"file/app/pool":       "10",
+		"file/app/ratio":      "2.50",
+		"file/app/big":        "123456789012345678901234",
+		"file/app/hex":        "31",
+		"file/app/date":       "2021-01-02",
+		"file/app/enabled":    "yes",
+		"file/app/off":        "false",
+		"file/app/limit":      ".inf",
+		"file/app/empty":      "",
+		"file/app/1":          "numeric key",
+		"file/app/hosts":      `["a",null]`,
+	}))
+	Expect(e.empty).To(Equal(map[string]bool{"file/app/empty": true}), "Assert null values are written empty on purpose")
+
+	// Null policies
+	e.config = expandConfig(config.NullsSkip, false, 0)
+	localData = map[string]string{}
+	e.traverseMap("file", map[string]interface{}{"empty": nil}, config.ArraysIndexed, localData)
+	Expect(localData).To(BeEmpty())
+	Expect(e.skipped).To(Equal(map[string]bool{"file/empty": true}))
+
+	e.config = expandConfig(config.NullsDelete, false, 0)
+	localData = map[string]string{}
+	e.traverseMap("file", map[string]interface{}{"empty": nil}, config.ArraysIndexed, localData)
+	Expect(localData).To(BeEmpty())
+
+	// Strict mode refuses unsupported constructs
+	e.config = expandConfig(config.NullsDelete, true, 0)
+	localData = map[string]string{}
+	e.expandDocument(yamlFormat{}, yamlFormat{}, "file", "ref: !Ref other\nname: a\n", config.ArraysJSON, localData)
+	Expect(localData).To(BeEmpty())
+	Expect(e.errors).To(HaveLen(1))
+	Expect(e.errors[0].code).To(Equal(util.ErrorFailedJsonDecode))
+}
+
+func TestExpandBlobs(t *testing.T) {
+	RegisterTestingT(t)
+
+	e := &exporter{config: expandConfig(config.NullsDelete, false, 0), logger: util.NewLogger(0)}
+
+	// Marked objects are kept as a whole, in their file format
+	localData := map[string]string{}
+	e.expandDocument(jsonFormat{}, jsonFormat{}, "file", `{"db": {"host": "a"}, "routes": {"_gonsul_blob": true, "a": {"b": 1}}}`, config.ArraysIndexed, localData)
+	Expect(localData).To(Equal(map[string]string{
+		"file/db/host": "a",
+		"file/routes":  `{"a":{"b":1}}`,
+	}))
+
+	localData = map[string]string{}
+	e.expandDocument(yamlFormat{}, yamlFormat{}, "file", "base: &base {b: 1.0}\nroutes:\n  _gonsul_blob: true\n  a: *base\ndb:\n  host: a\n", config.ArraysIndexed, localData)
+	Expect(localData).To(HaveKeyWithValue("file/routes", "a:\n  b: 1.0\n"))
+	Expect(localData).To(HaveKeyWithValue("file/db/host", "a"))
+	Expect(localData).To(HaveLen(3))
+
+	// Markers set to false are expanded as usual, while any other marker fails the file
+	localData = map[string]string{}
+	e.expandDocument(jsonFormat{}, jsonFormat{}, "file", `{"routes": {"_gonsul_blob": false, "a": {"b": 1}}}`, config.ArraysIndexed, localData)
+	Expect(localData).To(Equal(map[string]string{"file/routes/a/b": "1"}))
+
+	localData = map[string]string{}
+	e.expandDocument(yamlFormat{}, yamlFormat{}, "file", "routes:\n  a:\n    _gonsul_blob: \"yes\"\n    b: 1\n", config.ArraysIndexed, localData)
+	Expect(localData).To(BeEmpty())
+	Expect(e.errors).To(HaveLen(1))
+	Expect(e.errors[0].code).To(Equal(util.ErrorFailedJsonDecode))
+	Expect(e.errors[0].message).To(ContainSubstring("_gonsul_blob must be true or false, not yes"))
+
+	// Anything deeper than our depth is kept as a whole, arrays included
+	e.config = expandConfig(config.NullsDelete, false, 2)
+	localData = map[string]string{}
+	e.expandDocument(jsonFormat{}, jsonFormat{}, "file", `{"db": {"host": "a", "pools": [{"size": 1}], "tls": {"on": true}}, "port": 1}`, config.ArraysIndexed, localData)
+	Expect(localData).To(Equal(map[string]string{
+		"file/db/host":  "a",
+		"file/db/pools": `[{"size":1}]`,
+		"file/db/tls":   `{"on":true}`,
+		"file/port":     "1",
+	}))
+}
@@ -2,45 +2,296 @@ package exporter
 
 import (
 	"github.com/miniclip/gonsul/internal/config"
+	"github.com/miniclip/gonsul/internal/entities"
 	"github.com/miniclip/gonsul/internal/util"
 
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+
+	"errors"
+	"fmt"
 	"path"
+	"sort"
+	"strings"
+	"time"
 )
 
 // IExporter ...
 type IExporter interface {
 	Start() map[string]string
+	GetCommits() []entities.CommitInfo
+	GetSkippedKeys() map[string]bool
+	GetEmptyKeys() map[string]bool
+	Blame(kvPath string) []entities.KeyOrigin
+	SetSyncedCommits(commits []entities.CommitInfo)
 }
 
 // exporter ...
 type exporter struct {
-	config config.IConfig
-	logger util.ILogger
+	config   config.IConfig
+	logger   util.ILogger
+	verified map[string]plumbing.Hash
+	synced   map[string]plumbing.Hash
+	commits  []entities.CommitInfo
+	skipped  map[string]bool
+	empty    map[string]bool
+	errors   []exportError
+	files    []string
+	// documents holds the format of the values written as whole documents, and referencing
+	// the files whose schemas are validated once references are resolved
+	documents   map[string]string
+	referencing []referencingFile
 }
 
 // NewExporter ...
 func NewExporter(config config.IConfig, logger util.ILogger) IExporter {
-	return &exporter{config: config, logger: logger}
+	return &exporter{
+		config:   config,
+		logger:   logger,
+		verified: map[string]plumbing.Hash{},
+		skipped:  map[string]bool{},
+		empty:    map[string]bool{},
+	}
 }
 
 // Start ...
 func (e *exporter) Start() map[string]string {
-	// Instantiate our local data map
+	// Instantiate our local data map, and who exported each of its keys
 	var localData = map[string]string{}
+	var owners = map[string]string{}
+	var conflicts []string
+
+	// Forget about the commits, errors and files of any previous run, along with the null
+	// keys left untouched or written empty
+	e.commits = nil
+	e.errors = nil
+	e.files = nil
+	e.referencing = nil
+	skipped, empty, documents := map[string]bool{}, map[string]bool{}, map[string]string{}
+	var sources mountSources
+
+	// Secrets may have changed since, and are read from the files of this run
+	if e.config.DoSecrets() {
+		e.config.GetSecrets().Reset()
+	}
+
+	for _, mount := range e.config.GetMounts() {
+		// Open the source we're going to read our files from, never reading LFS pointers as they are
+		source := newLFSSource(e.openSource(mount), mount, e.logger)
+		sources = append(sources, source)
+		if e.config.DoSecrets() {
+			e.config.GetSecrets().SetFiles(source)
+		}
+
+		// Traverse our source, filling up the mount data structure and its own null keys
+		mountData := map[string]string{}
+		e.skipped, e.empty, e.documents = map[string]bool{}, map[string]bool{}, map[string]string{}
+		e.parseDir(source, ".", mountData)
+		mountData = e.mapSubmodulePrefixes(mount, mountData)
+
+		// Add it to our final data structure, under its Consul KV path
+		conflicts = append(conflicts, e.mergeMount(mount, mountData, localData, owners)...)
+		e.mergeMountKeys(mount, e.skipped, skipped)
+		e.mergeMountKeys(mount, e.empty, empty)
+		e.mergeMountDocuments(mount, e.documents, documents)
+	}
+	e.skipped, e.empty, e.documents = skipped, empty, documents
+
+	// Rendering secrets once exported, values are no longer tied to the mount they're from
+	if e.config.DoSecrets() {
+		e.config.GetSecrets().SetFiles(sources)
+	}
+
+	// Values may refer to any other key, whichever mount it's exported from
+	if e.config.DoReferences() {
+		e.resolveReferences(localData)
+		e.validateReferencing(localData)
+	}
+
+	// Broken files, missing secrets, broken references and schema violations are all reported before we stop
+	e.checkUnusedSecrets()
+	e.exitOnErrors()
+
+	// Two mounts writing the same key would make the final value depend on the order
+	// we read them, refuse to go on and report them all
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		for _, conflict := range conflicts {
+			e.logger.PrintError("EXPORTER: key exported by multiple mounts: " + conflict)
+		}
+		util.ExitError(errors.New(fmt.Sprintf("EXPORTER: %d keys exported by multiple mounts", len(conflicts))), util.ErrorMountConflict, e.logger)
+	}
+
+	// Return our final data structure
+	return localData
+}
+
+// openSource returns the source Gonsul should start traversing files from
+// to add to Consul, already rooted at the mount repo base path
+func (e *exporter) openSource(mount config.Mount) ISource {
+	var repo *git.Repository
+	var err error
+
+	// Are we syncing a bundle built elsewhere
+	if mount.SourceArchive != "" {
+		e.logger.PrintInfo("EXPORTER: Reading from archive: " + mount.SourceArchive)
+		source, err := newArchiveSource(mount.SourceArchive)
+		if err != nil {
+			util.ExitError(errors.New("EXPORTER: "+err.Error()), util.ErrorFailedReadingSource, e.logger)
+		}
+
+		return newSubSource(source, mount.RepoBasePath)
+	}
 
 	// Should we clone the repo, or is it already done via 3rd party
-	if e.config.IsCloning() {
-		e.logger.PrintInfo("EXPORTER: Git cloning from configured remote repository")
-		e.downloadRepo()
+	if mount.IsCloning() {
+		e.logger.PrintInfo("EXPORTER: Git cloning from configured remote repository: " + mount.RepoURL)
+		repo = e.downloadRepo(mount)
 	} else {
-		e.logger.PrintInfo("EXPORTER: Skipping Git clone, using local path: " + e.config.GetRepoRootDir())
+		e.logger.PrintInfo("EXPORTER: Skipping Git clone, using local path: " + mount.RepoRootDir)
 	}
 
-	// Set the path where Gonsul should start traversing files to add to Consul
-	repoDir := path.Join(e.config.GetRepoRootDir(), e.config.GetRepoBasePath())
-	// Traverse our repo directory, filling up the data.EntryCollection structure
-	e.parseDir(repoDir, localData)
+	// Without a pinned commit or signatures to verify, we just read whatever is on the file system
+	if mount.RepoCommit == "" && !e.isVerifying() {
+		// Even so, keep track of the commit checked out (if any) for our sync state
+		if repo == nil {
+			repo, _ = git.PlainOpen(mount.RepoRootDir)
+		}
+		if repo != nil {
+			if head, err := repo.Head(); err == nil {
+				e.recordCommit(repo, head.Hash(), mount)
+			}
+		}
 
-	// Return our final data.EntryCollection structure
-	return localData
+		return newDirSource(path.Join(mount.RepoRootDir, mount.RepoBasePath))
+	}
+
+	if repo == nil {
+		repo, err = git.PlainOpen(mount.RepoRootDir)
+		e.checkRepoError(err)
+	}
+
+	// Find out which commit we're reading
+	commitHash := plumbing.NewHash(mount.RepoCommit)
+	if mount.RepoCommit == "" {
+		head, err := repo.Head()
+		e.checkRepoError(err)
+		commitHash = head.Hash()
+	}
+
+	// Make sure it's trusted, we then read from its Git objects so what
+	// we sync is exactly what was verified, whatever is on the worktree
+	if e.isVerifying() {
+		e.verifyCommits(repo, commitHash, mount)
+	}
+
+	e.recordCommit(repo, commitHash, mount)
+	e.logger.PrintInfo("EXPORTER: Reading from commit: " + commitHash.String())
+	source, err := newGitSource(repo, commitHash, mount.SubmoduleDepth() > 0)
+	e.checkRepoError(err)
+
+	return newSubSource(source, mount.RepoBasePath)
+}
+
+// SetSyncedCommits tells the commits of our last sync to Consul, so we verify every commit since
+func (e *exporter) SetSyncedCommits(commits []entities.CommitInfo) {
+	e.synced = map[string]plumbing.Hash{}
+	for _, commit := range commits {
+		e.synced[commit.Mount] = plumbing.NewHash(commit.SHA)
+	}
+}
+
+// GetCommits returns the commits exported on our last run, one per Git mount
+func (e *exporter) GetCommits() []entities.CommitInfo {
+	return e.commits
+}
+
+// GetSkippedKeys returns the keys our last run found, but should be left untouched in Consul
+func (e *exporter) GetSkippedKeys() map[string]bool {
+	return e.skipped
+}
+
+// GetEmptyKeys returns the keys our last run wrote empty on purpose, from null values
+func (e *exporter) GetEmptyKeys() map[string]bool {
+	return e.empty
+}
+
+// recordCommit keeps the details of the commit exported for the given mount
+func (e *exporter) recordCommit(repo *git.Repository, commitHash plumbing.Hash, mount config.Mount) {
+	commit, err := repo.CommitObject(commitHash)
+	if err != nil {
+		e.logger.PrintDebug(fmt.Sprintf("EXPORTER: could not read commit %s: %s", commitHash.String(), err.Error()))
+		return
+	}
+
+	e.commits = append(e.commits, newCommitInfo(mount, commit))
+}
+
+// newCommitInfo describes the given commit of the given mount
+func newCommitInfo(mount config.Mount, commit *object.Commit) entities.CommitInfo {
+	return entities.CommitInfo{
+		Mount:   mount.Name,
+		SHA:     commit.Hash.String(),
+		Author:  fmt.Sprintf("%s <%s>", commit.Author.Name, commit.Author.Email),
+		Date:    commit.Author.When.UTC().Format(time.RFC3339),
+		Message: strings.SplitN(strings.TrimSpace(commit.Message), "\n", 2)[0],
+	}
+}
+
+// mergeMount adds the data exported from a mount to our final data, prefixing every key
+// with the mount Consul KV path. It returns the keys already exported by another mount
+func (e *exporter) mergeMount(mount config.Mount, mountData map[string]string, localData map[string]string, owners map[string]string) []string {
+	var conflicts []string
+
+	for key, value := range mountData {
+		kvPath := e.mountKVPath(mount, key)
+
+		if owner, ok := owners[kvPath]; ok {
+			conflicts = append(conflicts, fmt.Sprintf("%s (%s, %s)", kvPath, owner, mount.Name))
+			continue
+		}
+
+		owners[kvPath] = mount.Name
+		localData[kvPath] = value
+	}
+
+	return conflicts
+}
+
+// mergeMountKeys adds the given keys of a mount, as found on its files, to the given final keys
+// under their Consul KV path, rewritten and mapped just like the mount data
+func (e *exporter) mergeMountKeys(mount config.Mount, mountKeys map[string]bool, keys map[string]bool) {
+	rewritten := map[string]string{}
+	for key := range mountKeys {
+		rewritten[e.config.RewriteKey(key)] = ""
+	}
+
+	for key := range e.mapSubmodulePrefixes(mount, rewritten) {
+		keys[e.mountKVPath(mount, key)] = true
+	}
+}
+
+// mergeMountDocuments adds the document formats of a mount keys to the given final ones, under
+// their Consul KV path, rewritten and mapped just like the mount data
+func (e *exporter) mergeMountDocuments(mount config.Mount, mountDocuments map[string]string, documents map[string]string) {
+	rewritten := map[string]string{}
+	for key, format := range mountDocuments {
+		rewritten[e.config.RewriteKey(key)] = format
+	}
+
+	for key, format := range e.mapSubmodulePrefixes(mount, rewritten) {
+		documents[e.mountKVPath(mount, key)] = format
+	}
+}
+
+// mountKVPath returns the final Consul KV path of a key exported from the given mount
+func (e *exporter) mountKVPath(mount config.Mount, key string) string {
+	// Mount KV paths are relative to our global Consul KV base path
+	prefix := path.Join(e.config.GetConsulBasePath(), mount.ConsulBasePath)
+	if prefix == "" {
+		return key
+	}
+
+	return path.Join(prefix, key)
 }
@@ -0,0 +1,195 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+	"github.com/miniclip/gonsul/internal/util"
+
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// IFormat is a structured file format, whose files are validated and can be expanded into keys
+type IFormat interface {
+	// Name is the format name, as given to --expand-formats
+	Name() string
+	// Extensions are the file extensions of this format, with their leading dot
+	Extensions() []string
+	// Decode validates a document and returns its "generic" structure, along with
+	// warnings about any construct it had to skip
+	Decode(content string) (map[string]interface{}, []string, error)
+	// Encode writes back a subtree of a decoded document, stored as a single value
+	Encode(value interface{}) (string, error)
+	// Escape escapes a secret or referenced value to be written at the given offset of a document
+	// of this format, failing if it can't be written there without changing it (such as new lines
+	// in a comment)
+	Escape(content string, offset int, value string) (string, error)
+}
+
+// Quoting contexts, where a secret placeholder is found within a document
+const (
+	quotingNone = iota
+	quotingDouble
+	quotingSingle
+	quotingMultiDouble
+	quotingMultiSingle
+	quotingBlock
+	quotingComment
+)
+
+// bareScalar matches the secrets that can be written outside of any string, such as numbers
+var bareScalar = regexp.MustCompile(`^[A-Za-z0-9_.:+-]+$`)
+
+// escapeBare writes secrets found outside of any string, as long as they're single scalars
+func escapeBare(value string) (string, error) {
+	if !bareScalar.MatchString(value) {
+		return "", errors.New("can't be written unquoted, quote its placeholder")
+	}
+
+	return value, nil
+}
+
+// escapeSingleLine writes secrets as they are, as long as they don't hold new lines
+func escapeSingleLine(value string, context string) (string, error) {
+	if strings.ContainsAny(value, "\r\n") {
+		return "", errors.New(fmt.Sprintf("holds new lines, it can't be written in %s", context))
+	}
+
+	return value, nil
+}
+
+// formats are all the structured file formats we know about
+var formats = []IFormat{
+	jsonFormat{},
+	yamlFormat{},
+	tomlFormat{},
+	hclFormat{},
+	propertiesFormat{},
+	envFormat{},
+	iniFormat{},
+}
+
+// findFormat returns the format of the given file extension, nil if it's not a structured one
+func findFormat(extension string) IFormat {
+	for _, format := range formats {
+		for _, formatExtension := range format.Extensions() {
+			if strings.EqualFold(extension, formatExtension) {
+				return format
+			}
+		}
+	}
+
+	return nil
+}
+
+// findFormatByName returns the format of the given name, nil if we don't know about it
+func findFormatByName(name string) IFormat {
+	for _, format := range formats {
+		if format.Name() == name {
+			return format
+		}
+	}
+
+	return nil
+}
+
+// outputFormat returns the format the values of the given file are written in, which
+// is the file own format unless an output format rule matches it
+func (e *exporter) outputFormat(filePath string, format IFormat) IFormat {
+	if output := findFormatByName(e.config.GetOutputFormat(filePath)); output != nil {
+		return output
+	}
+
+	return format
+}
+
+// validateDocument decodes the given document, keeping track of any error. It tells whether
+// the document is a valid one
+func (e *exporter) validateDocument(format IFormat, path string, content string) (map[string]interface{}, []string, bool) {
+	document, warnings, err := format.Decode(content)
+
+	// Decoded document ok?
+	if err != nil {
+		e.addError(
+			util.ErrorFailedJsonDecode,
+			fmt.Sprintf("error parsing %s file: %s with Message: %s", strings.ToUpper(format.Name()), path, err.Error()),
+		)
+		return nil, nil, false
+	}
+
+	return document, warnings, true
+}
+
+// checkWarnings reports the constructs we skipped while decoding a document, as errors
+// if we're strict about it. It tells whether the document can still be used
+func (e *exporter) checkWarnings(format IFormat, path string, warnings []string) bool {
+	for _, warning := range warnings {
+		if e.config.IsExpandStrict() {
+			e.addError(
+				util.ErrorFailedJsonDecode,
+				fmt.Sprintf("error parsing %s file: %s with Message: %s", strings.ToUpper(format.Name()), path, warning),
+			)
+			continue
+		}
+		e.logger.PrintError(fmt.Sprintf("EXPORTER: skipping unsupported construct on %s file: %s %s", strings.ToUpper(format.Name()), path, warning))
+	}
+
+	return !e.config.IsExpandStrict() || len(warnings) == 0
+}
+
+// expandDocument decodes the given document, adding each of its values to our collection.
+// The subtrees we don't expand are written in the given output format
+func (e *exporter) expandDocument(format IFormat, output IFormat, path string, content string, arrayMode string, localData map[string]string) {
+	document, warnings, ok := e.validateDocument(format, path, content)
+
+	// Constructs we can't write to Consul are skipped, unless we're strict about it
+	if !ok || !e.checkWarnings(format, path, warnings) || !e.checkBlobMarkers(format, path, document) {
+		return
+	}
+
+	// Keep the subtrees we should not expand in their format
+	for key, value := range document {
+		document[key] = e.collapse(output, path, value, 1)
+	}
+
+	// Iterate over our "generic" structure
+	e.traverseMap(path, document, arrayMode, localData)
+}
+
+// convertDocument decodes the given document, writing it back as a canonical document of the
+// given output format (sorted keys, stable indentation), so only semantic changes reach Consul.
+// It tells whether the document is a valid one
+func (e *exporter) convertDocument(format IFormat, output IFormat, path string, content string) (string, bool) {
+	document, warnings, ok := e.validateDocument(format, path, content)
+
+	// Constructs we can't write to Consul are skipped, unless we're strict about it
+	if !ok || !e.checkWarnings(format, path, warnings) {
+		return "", false
+	}
+
+	return e.encodeDocument(output, path, document), true
+}
+
+// encodeDocument writes back a whole decoded document in the given output format, JSON
+// documents being pretty formatted
+func (e *exporter) encodeDocument(output IFormat, path string, document map[string]interface{}) string {
+	encoded, err := output.Encode(document)
+	if err == nil && output.Name() == config.FormatJSON {
+		// Whole JSON documents are kept pretty formatted
+		buffer := &bytes.Buffer{}
+		err = json.Indent(buffer, []byte(encoded), "", "  ")
+		encoded = buffer.String()
+	}
+	if err != nil {
+		util.ExitError(
+			errors.New(fmt.Sprintf("error encoding %s as %s with Message: %s", path, strings.ToUpper(output.Name()), err.Error())),
+			util.ErrorFailedJsonEncode,
+			e.logger,
+		)
+	}
+
+	return encoded
+}
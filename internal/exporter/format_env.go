@@ -0,0 +1,175 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// envKey matches the variable names of .env files
+var envKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// envFormat is our .env IFormat implementation. Variables are never expanded, their
+// values are written as they are in the file
+type envFormat struct{}
+
+// Name ...
+func (f envFormat) Name() string {
+	return config.FormatEnv
+}
+
+// Extensions ...
+func (f envFormat) Extensions() []string {
+	return []string{".env"}
+}
+
+// Decode ...
+func (f envFormat) Decode(content string) (map[string]interface{}, []string, error) {
+	document := map[string]interface{}{}
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+
+	for i := 0; i < len(lines); i++ {
+		number := i + 1
+		line := strings.TrimSpace(lines[i])
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		parts := strings.SplitN(strings.TrimPrefix(line, "export "), "=", 2)
+		key := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || !envKey.MatchString(key) {
+			return nil, nil, errors.New(fmt.Sprintf("line %d: must be KEY=value", number))
+		}
+		value := strings.TrimLeft(parts[1], " \t")
+
+		switch {
+		case strings.HasPrefix(value, `"`) || strings.HasPrefix(value, `'`):
+			// Quoted values may span multiple lines
+			quote := value[:1]
+			value = value[1:]
+			for !hasClosingQuote(value, quote) && i+1 < len(lines) {
+				i++
+				value += "\n" + lines[i]
+			}
+			end := closingQuote(value, quote)
+			if end < 0 {
+				return nil, nil, errors.New(fmt.Sprintf("line %d: unterminated quoted value", number))
+			}
+			rest := strings.TrimSpace(value[end+1:])
+			if rest != "" && rest[0] != '#' {
+				return nil, nil, errors.New(fmt.Sprintf("line %d: unexpected characters after quoted value", number))
+			}
+			value = value[:end]
+			if quote == `"` {
+				value = unescapeEnv(value)
+			}
+
+		default:
+			// Unquoted values end on an inline comment
+			if comment := strings.Index(value, " #"); comment >= 0 {
+				value = value[:comment]
+			}
+			value = strings.TrimSpace(value)
+		}
+
+		document[key] = value
+	}
+
+	return document, nil, nil
+}
+
+// Encode ...
+func (f envFormat) Encode(value interface{}) (string, error) {
+	return marshalJSON(value)
+}
+
+// Escape writes secrets the way double quoted values escape them. Single quoted and unquoted
+// values have no escape sequences, they only get the secrets they can hold as they are
+func (f envFormat) Escape(content string, offset int, value string) (string, error) {
+	switch envQuoting(content, offset) {
+	case quotingSingle:
+		if strings.Contains(value, "'") {
+			return "", errors.New("holds a single quote, it can't be written in a single quoted value, use double quotes")
+		}
+		return value, nil
+	case quotingComment:
+		return escapeSingleLine(value, "a comment")
+	case quotingNone:
+		if value != strings.TrimSpace(value) || strings.ContainsAny(value, "\r\n#\"'") {
+			return "", errors.New("can't be written in an unquoted value as it is, put its placeholder within double quotes")
+		}
+		return value, nil
+	}
+
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(value), nil
+}
+
+// envQuoting returns the quoting context of the given offset of a .env file: double and single
+// quoted values, which may span multiple lines, and comments
+func envQuoting(content string, offset int) int {
+	quoting := quotingNone
+	inKey, valueStart := true, false
+	for i := 0; i < offset && i < len(content); i++ {
+		switch {
+		case quoting == quotingDouble:
+			if content[i] == '\\' {
+				i++
+			} else if content[i] == '"' {
+				quoting = quotingNone
+			}
+		case quoting == quotingSingle:
+			if content[i] == '\'' {
+				quoting = quotingNone
+			}
+		case content[i] == '\n':
+			quoting, inKey, valueStart = quotingNone, true, false
+		case quoting == quotingComment:
+		case inKey && content[i] == '#':
+			quoting = quotingComment
+		case inKey && content[i] == '=':
+			inKey, valueStart = false, true
+		case valueStart && (content[i] == ' ' || content[i] == '\t'):
+		case valueStart && content[i] == '"':
+			quoting, valueStart = quotingDouble, false
+		case valueStart && content[i] == '\'':
+			quoting, valueStart = quotingSingle, false
+		case !inKey && content[i] == '#' && content[i-1] == ' ':
+			quoting, valueStart = quotingComment, false
+		default:
+			valueStart = false
+		}
+	}
+
+	return quoting
+}
+
+// hasClosingQuote tells if the given quoted value has its closing quote
+func hasClosingQuote(value string, quote string) bool {
+	return closingQuote(value, quote) >= 0
+}
+
+// closingQuote returns the index of the closing quote of the given value, -1 if there's none.
+// Double quotes may be escaped, single quoted values are literal
+func closingQuote(value string, quote string) int {
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && quote == `"` {
+			i++
+			continue
+		}
+		if value[i] == quote[0] {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// unescapeEnv resolves the escape sequences of a double quoted value
+func unescapeEnv(value string) string {
+	replacer := strings.NewReplacer(`\n`, "\n", `\r`, "\r", `\t`, "\t", `\"`, `"`, `\\`, `\`)
+
+	return replacer.Replace(value)
+}
@@ -0,0 +1,152 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+
+	"github.com/hashicorp/hcl"
+
+	"strings"
+)
+
+// hclFormat is our HCL IFormat implementation
+type hclFormat struct{}
+
+// Name ...
+func (f hclFormat) Name() string {
+	return config.FormatHCL
+}
+
+// Extensions ...
+func (f hclFormat) Extensions() []string {
+	return []string{".hcl"}
+}
+
+// Decode ...
+func (f hclFormat) Decode(content string) (map[string]interface{}, []string, error) {
+	var document map[string]interface{}
+	if err := hcl.Unmarshal([]byte(content), &document); err != nil {
+		return nil, nil, err
+	}
+	if document == nil {
+		document = map[string]interface{}{}
+	}
+
+	return normalizeHCL(document).(map[string]interface{}), nil, nil
+}
+
+// Encode writes HCL subtrees as JSON, which is valid HCL as well
+func (f hclFormat) Encode(value interface{}) (string, error) {
+	return marshalJSON(value)
+}
+
+// Escape writes secrets the way HCL strings escape them, which are JSON compatible. Outside
+// of strings, only single scalars (numbers, booleans) are written
+func (f hclFormat) Escape(content string, offset int, value string) (string, error) {
+	switch hclQuoting(content, offset) {
+	case quotingDouble:
+		return escapeJSONString(value), nil
+	case quotingBlock:
+		return escapeSingleLine(value, "a heredoc")
+	case quotingComment:
+		return escapeSingleLine(value, "a comment")
+	}
+
+	return escapeBare(value)
+}
+
+// hclQuoting returns the quoting context of the given offset of an HCL document: strings,
+// heredocs (<<EOF) and comments (#, // and /* */)
+func hclQuoting(content string, offset int) int {
+	quoting := quotingNone
+	heredoc := ""
+	blockComment := false
+	for i := 0; i < offset && i < len(content); i++ {
+		switch {
+		case quoting == quotingDouble:
+			if content[i] == '\\' {
+				i++
+			} else if content[i] == '"' {
+				quoting = quotingNone
+			}
+		case blockComment:
+			if strings.HasPrefix(content[i:], "*/") {
+				quoting, blockComment = quotingNone, false
+				i++
+			}
+		case quoting == quotingComment:
+			if content[i] == '\n' {
+				quoting = quotingNone
+			}
+		case quoting == quotingBlock:
+			// Heredocs end on a line holding their identifier alone
+			if content[i] == '\n' {
+				end := strings.IndexByte(content[i+1:], '\n')
+				if end < 0 {
+					end = len(content) - i - 1
+				}
+				if strings.TrimSpace(content[i+1:i+1+end]) == heredoc {
+					quoting = quotingNone
+					i += end
+				}
+			}
+		case content[i] == '"':
+			quoting = quotingDouble
+		case content[i] == '#' || strings.HasPrefix(content[i:], "//"):
+			quoting = quotingComment
+		case strings.HasPrefix(content[i:], "/*"):
+			quoting, blockComment = quotingComment, true
+			i++
+		case strings.HasPrefix(content[i:], "<<"):
+			end := strings.IndexByte(content[i:], '\n')
+			if end < 0 {
+				return quotingBlock
+			}
+			quoting = quotingBlock
+			heredoc = strings.TrimSpace(strings.TrimPrefix(content[i+2:i+end], "-"))
+			i += end - 1
+		}
+	}
+
+	return quoting
+}
+
+// normalizeHCL merges the lists of objects HCL decodes blocks into, so `service "web" { port = 80 }`
+// becomes the same structure as its JSON counterpart {"service": {"web": {"port": 80}}}
+func normalizeHCL(value interface{}) interface{} {
+	switch value.(type) {
+	case []map[string]interface{}:
+		merged := map[string]interface{}{}
+		for _, object := range value.([]map[string]interface{}) {
+			for key, child := range object {
+				mergeHCL(merged, key, normalizeHCL(child))
+			}
+		}
+		return merged
+
+	case map[string]interface{}:
+		for key, child := range value.(map[string]interface{}) {
+			value.(map[string]interface{})[key] = normalizeHCL(child)
+		}
+
+	case []interface{}:
+		for index, child := range value.([]interface{}) {
+			value.([]interface{})[index] = normalizeHCL(child)
+		}
+	}
+
+	return value
+}
+
+// mergeHCL sets a key of a merged block, merging it with any previous block of the same key
+func mergeHCL(merged map[string]interface{}, key string, value interface{}) {
+	previous, previousIsObject := merged[key].(map[string]interface{})
+	object, isObject := value.(map[string]interface{})
+	if !previousIsObject || !isObject {
+		merged[key] = value
+		return
+	}
+
+	for childKey, child := range object {
+		mergeHCL(previous, childKey, child)
+	}
+}
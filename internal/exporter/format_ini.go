@@ -0,0 +1,70 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// iniFormat is our INI IFormat implementation, each section being an object
+type iniFormat struct{}
+
+// Name ...
+func (f iniFormat) Name() string {
+	return config.FormatINI
+}
+
+// Extensions ...
+func (f iniFormat) Extensions() []string {
+	return []string{".ini"}
+}
+
+// Decode ...
+func (f iniFormat) Decode(content string) (map[string]interface{}, []string, error) {
+	document := map[string]interface{}{}
+	// Keys before any section are top level ones
+	section := document
+
+	for i, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' {
+			if !strings.HasSuffix(line, "]") {
+				return nil, nil, errors.New(fmt.Sprintf("line %d: unterminated section name", i+1))
+			}
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if existing, ok := document[name].(map[string]interface{}); ok {
+				section = existing
+			} else {
+				section = map[string]interface{}{}
+				document[name] = section
+			}
+			continue
+		}
+
+		// Keys without a value (flags) are empty ones
+		separator := strings.IndexAny(line, "=:")
+		if separator < 0 {
+			section[line] = ""
+			continue
+		}
+		section[strings.TrimSpace(line[:separator])] = strings.TrimSpace(line[separator+1:])
+	}
+
+	return document, nil, nil
+}
+
+// Encode ...
+func (f iniFormat) Encode(value interface{}) (string, error) {
+	return marshalJSON(value)
+}
+
+// Escape writes secrets as is, INI values have no escape sequences so they can't hold new lines
+func (f iniFormat) Escape(content string, offset int, value string) (string, error) {
+	return escapeSingleLine(value, "an INI file")
+}
@@ -0,0 +1,123 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// jsonFormat is our JSON IFormat implementation
+type jsonFormat struct{}
+
+// Name ...
+func (f jsonFormat) Name() string {
+	return config.FormatJSON
+}
+
+// Extensions ...
+func (f jsonFormat) Extensions() []string {
+	return []string{".json"}
+}
+
+// Decode ...
+func (f jsonFormat) Decode(content string) (map[string]interface{}, []string, error) {
+	// Create "generic" json struct
+	var arbitraryJSON map[string]interface{}
+
+	// Decode data into "generic", keeping numbers exactly as written
+	decoder := json.NewDecoder(strings.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&arbitraryJSON); err != nil {
+		return nil, nil, jsonPositionError(content, err)
+	}
+	offset := decoder.InputOffset()
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, nil, errors.New(fmt.Sprintf("%s: invalid data after top-level value", jsonPosition(content, offset)))
+	}
+
+	return arbitraryJSON, nil, nil
+}
+
+// Encode ...
+func (f jsonFormat) Encode(value interface{}) (string, error) {
+	return marshalJSON(value)
+}
+
+// Escape writes secrets as JSON string content within strings, and only single scalars
+// (numbers, booleans) anywhere else
+func (f jsonFormat) Escape(content string, offset int, value string) (string, error) {
+	if jsonQuoting(content, offset) == quotingDouble {
+		return escapeJSONString(value), nil
+	}
+
+	return escapeBare(value)
+}
+
+// jsonQuoting tells whether the given offset of a JSON document is within a string
+func jsonQuoting(content string, offset int) int {
+	quoting := quotingNone
+	for i := 0; i < offset && i < len(content); i++ {
+		switch {
+		case quoting == quotingDouble && content[i] == '\\':
+			i++
+		case content[i] == '"' && quoting == quotingDouble:
+			quoting = quotingNone
+		case content[i] == '"':
+			quoting = quotingDouble
+		}
+	}
+
+	return quoting
+}
+
+// escapeJSONString escapes the given value to be written within a JSON (double quoted) string
+func escapeJSONString(value string) string {
+	encoded, _ := marshalJSON(value)
+
+	return encoded[1 : len(encoded)-1]
+}
+
+// jsonPositionError adds the line and column a JSON decoding error happened at
+func jsonPositionError(content string, err error) error {
+	var offset int64
+	switch err.(type) {
+	case *json.SyntaxError:
+		// Syntax errors are found once the offending byte is read, pointing right after it
+		offset = err.(*json.SyntaxError).Offset - 1
+	case *json.UnmarshalTypeError:
+		offset = err.(*json.UnmarshalTypeError).Offset
+	default:
+		if err != io.ErrUnexpectedEOF {
+			return err
+		}
+		offset = int64(len(content))
+	}
+
+	return errors.New(fmt.Sprintf("%s: %s", jsonPosition(content, offset), err.Error()))
+}
+
+// jsonPosition returns the line and column of the given byte offset of a JSON document
+func jsonPosition(content string, offset int64) string {
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	line, column := 1, 1
+	for _, char := range content[:offset] {
+		if char == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+
+	return fmt.Sprintf("line %d, column %d", line, column)
+}
@@ -0,0 +1,134 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// propertiesFormat is our Java .properties IFormat implementation, its keys are used as written
+type propertiesFormat struct{}
+
+// Name ...
+func (f propertiesFormat) Name() string {
+	return config.FormatProperties
+}
+
+// Extensions ...
+func (f propertiesFormat) Extensions() []string {
+	return []string{".properties"}
+}
+
+// Decode ...
+func (f propertiesFormat) Decode(content string) (map[string]interface{}, []string, error) {
+	document := map[string]interface{}{}
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+
+	for i := 0; i < len(lines); i++ {
+		number := i + 1
+		line := strings.TrimLeft(lines[i], " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+
+		// Lines ending with an odd number of backslashes go on on the next line
+		for continuesLine(line) && i+1 < len(lines) {
+			i++
+			line = line[:len(line)-1] + strings.TrimLeft(lines[i], " \t\f")
+		}
+
+		key, value := splitProperty(line)
+		key, err := unescapeProperty(key)
+		if err != nil {
+			return nil, nil, errors.New(fmt.Sprintf("line %d: %s", number, err.Error()))
+		}
+		value, err = unescapeProperty(value)
+		if err != nil {
+			return nil, nil, errors.New(fmt.Sprintf("line %d: %s", number, err.Error()))
+		}
+		document[key] = value
+	}
+
+	return document, nil, nil
+}
+
+// Encode ...
+func (f propertiesFormat) Encode(value interface{}) (string, error) {
+	return marshalJSON(value)
+}
+
+// Escape writes secrets the way properties values escape them, which are never quoted
+func (f propertiesFormat) Escape(content string, offset int, value string) (string, error) {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(value), nil
+}
+
+// continuesLine tells if the given line ends with an unescaped backslash
+func continuesLine(line string) bool {
+	backslashes := len(line) - len(strings.TrimRight(line, "\\"))
+
+	return backslashes%2 == 1
+}
+
+// splitProperty splits a logical line on its first unescaped '=', ':' or white space
+func splitProperty(line string) (string, string) {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '=', ':':
+			return line[:i], strings.TrimLeft(line[i+1:], " \t\f")
+		case ' ', '\t', '\f':
+			value := strings.TrimLeft(line[i:], " \t\f")
+			if value != "" && (value[0] == '=' || value[0] == ':') {
+				value = strings.TrimLeft(value[1:], " \t\f")
+			}
+			return line[:i], value
+		}
+	}
+
+	return line, ""
+}
+
+// unescapeProperty resolves the escape sequences of a key or value
+func unescapeProperty(escaped string) (string, error) {
+	if !strings.Contains(escaped, "\\") {
+		return escaped, nil
+	}
+
+	builder := strings.Builder{}
+	for i := 0; i < len(escaped); i++ {
+		if escaped[i] != '\\' || i+1 == len(escaped) {
+			builder.WriteByte(escaped[i])
+			continue
+		}
+
+		i++
+		switch escaped[i] {
+		case 't':
+			builder.WriteByte('\t')
+		case 'n':
+			builder.WriteByte('\n')
+		case 'r':
+			builder.WriteByte('\r')
+		case 'f':
+			builder.WriteByte('\f')
+		case 'u':
+			if i+5 > len(escaped) {
+				return "", errors.New("malformed \\uxxxx encoding")
+			}
+			code, err := strconv.ParseUint(escaped[i+1:i+5], 16, 16)
+			if err != nil {
+				return "", errors.New("malformed \\uxxxx encoding")
+			}
+			builder.WriteRune(rune(code))
+			i += 4
+		default:
+			builder.WriteByte(escaped[i])
+		}
+	}
+
+	return builder.String(), nil
+}
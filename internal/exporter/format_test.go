@@ -0,0 +1,145 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/util"
+
+	. "github.com/onsi/gomega"
+
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestFormatsDecode(t *testing.T) {
+	RegisterTestingT(t)
+
+	// Every format is found by its extensions
+	Expect(findFormat(".yml")).To(Equal(yamlFormat{}))
+	Expect(findFormat(".TOML")).To(Equal(tomlFormat{}))
+	Expect(findFormat(".txt")).To(BeNil())
+
+	cases := []struct {
+		format   IFormat
+		content  string
+		expected map[string]interface{}
+	}{
+		{tomlFormat{}, "port = 80\n[db]\nhost = \"a\"\nwhen = 2021-01-02\n", map[string]interface{}{
+			"port": int64(80),
+			"db":   map[string]interface{}{"host": "a", "when": "2021-01-02"},
+		}},
+		{hclFormat{}, "port = 80\nservice \"web\" {\n  tls = true\n}\nservice \"api\" {\n  tls = false\n}\n", map[string]interface{}{
+			"port":    80,
+			"service": map[string]interface{}{"web": map[string]interface{}{"tls": true}, "api": map[string]interface{}{"tls": false}},
+		}},
+		{propertiesFormat{}, "# comment\ndb.host = a\ndb.name:b\ndb.pool 10\nmulti = one \\\n    two\nescaped\\ key = \\u0041\\t\n", map[string]interface{}{
+			"db.host": "a", "db.name": "b", "db.pool": "10", "multi": "one two", "escaped key": "A\t",
+		}},
+		{envFormat{}, "# comment\nexport HOST=a # inline\nNAME=\"b \\\"quoted\\\"\"\nRAW='$HOME'\nCERT=\"line1\nline2\"\nEMPTY=\n", map[string]interface{}{
+			"HOST": "a", "NAME": `b "quoted"`, "RAW": "$HOME", "CERT": "line1\nline2", "EMPTY": "",
+		}},
+		{iniFormat{}, "top = 1\n; comment\n[db]\nhost = a\nskip-networking\n[db]\nname: b\n", map[string]interface{}{
+			"top": "1",
+			"db":  map[string]interface{}{"host": "a", "skip-networking": "", "name": "b"},
+		}},
+		{jsonFormat{}, `{"a": 1.50}`, map[string]interface{}{"a": json.Number("1.50")}},
+	}
+	for _, c := range cases {
+		document, warnings, err := c.format.Decode(c.content)
+		Expect(err).To(BeNil(), c.format.Name())
+		Expect(warnings).To(BeEmpty(), c.format.Name())
+		Expect(document).To(Equal(c.expected), c.format.Name())
+	}
+
+	// Invalid documents are refused
+	invalid := []struct {
+		format  IFormat
+		content string
+	}{
+		{jsonFormat{}, `{"a": 1} {}`},
+		{yamlFormat{}, "- a\n- b\n"},
+		{tomlFormat{}, "a = \n"},
+		{hclFormat{}, "a = {\n"},
+		{propertiesFormat{}, "a = \\u00"},
+		{envFormat{}, "not a variable\n"},
+		{envFormat{}, "A=\"unterminated\n"},
+		{iniFormat{}, "[section\n"},
+	}
+	for _, c := range invalid {
+		_, _, err := c.format.Decode(c.content)
+		Expect(err).To(Not(BeNil()), c.format.Name()+": "+c.content)
+	}
+}
+
+func TestConvertDocument(t *testing.T) {
+	RegisterTestingT(t)
+
+	e := &exporter{config: expandConfig("", false, 0), logger: util.NewLogger(0)}
+	convert := func(format IFormat, output IFormat, content string) string {
+		converted, ok := e.convertDocument(format, output, "file", content)
+		Expect(ok).To(BeTrue())
+		return converted
+	}
+
+	// YAML stored as canonical JSON, numbers kept as written
+	yaml := "name: web\nratio: 1.0\nhosts:\n  - b\n  - a\ndb: {port: 5432, host: db}\n"
+	Expect(convert(yamlFormat{}, jsonFormat{}, yaml)).To(Equal(
+		"{\n  \"db\": {\n    \"host\": \"db\",\n    \"port\": 5432\n  },\n  \"hosts\": [\n    \"b\",\n    \"a\"\n  ],\n  \"name\": \"web\",\n  \"ratio\": 1.0\n}",
+	))
+
+	// Semantically identical edits produce the same value
+	reordered := "{\"ratio\": 1.0, \"name\": \"web\", \"db\": {\"host\": \"db\", \"port\": 5432},\n\"hosts\": [\"b\", \"a\"]}"
+	Expect(convert(jsonFormat{}, jsonFormat{}, reordered)).To(Equal(convert(yamlFormat{}, jsonFormat{}, yaml)))
+
+	// JSON stored as canonical YAML
+	Expect(convert(jsonFormat{}, yamlFormat{}, `{"b": [1, "x"], "a": {"c": null}}`)).To(Equal("a:\n  c: null\nb:\n  - 1\n  - x\n"))
+}
+
+func TestFormatsEscape(t *testing.T) {
+	RegisterTestingT(t)
+
+	// Secrets are escaped for wherever their placeholder is, or refused if they can't be written there
+	cases := []struct {
+		format   IFormat
+		content  string
+		value    string
+		expected string
+	}{
+		{jsonFormat{}, `{"password": "{{s}}"}`, `p"a\ss`, `p\"a\\ss`},
+		{jsonFormat{}, `{"port": {{s}}, "name": "}"}`, `5432`, `5432`},
+		{jsonFormat{}, `{"port": {{s}}}`, `1, "admin": true`, ""},
+		{yamlFormat{}, "user: {{s}}\n", "admin", "admin"},
+		{yamlFormat{}, "user: {{s}}\n", "admin # root", ""},
+		{yamlFormat{}, "user: {{s}}\n", "- admin", ""},
+		{yamlFormat{}, "user: \"{{s}}\"\n", "a\"b\nc", `a\"b\nc`},
+		{yamlFormat{}, "user: it's {{s}}\n", "a", "a"},
+		{yamlFormat{}, "user: '{{s}}'\n", "it's", "it''s"},
+		{yamlFormat{}, "user: 'x\n  {{s}}'\n", "a\nb", ""},
+		{yamlFormat{}, "cert: |\n  {{s}}\nnext: 1\n", "line1\nline2", ""},
+		{yamlFormat{}, "cert: |\n  a\nnext: {{s}}\n", "1", "1"},
+		{yamlFormat{}, "# {{s}}\n", "a\nkey: b", ""},
+		{tomlFormat{}, "password = \"{{s}}\"\n", `p"a\ss`, `p\"a\\ss`},
+		{tomlFormat{}, "password = '{{s}}'\n", `p\ss`, `p\ss`},
+		{tomlFormat{}, "password = '{{s}}'\n", `it's`, ""},
+		{tomlFormat{}, "password = '''\n{{s}}'''\n", "it's\nok", "it's\nok"},
+		{tomlFormat{}, "port = {{s}}\n", "5432", "5432"},
+		{tomlFormat{}, "port = {{s}}\n", "5432\nadmin = true", ""},
+		{hclFormat{}, "password = \"{{s}}\"\n", `p"a`, `p\"a`},
+		{hclFormat{}, "cert = <<EOF\n{{s}}\nEOF\n", "a\nEOF", ""},
+		{hclFormat{}, "cert = <<EOF\na\nEOF\nport = {{s}}\n", "80", "80"},
+		{envFormat{}, "PASSWORD=\"{{s}}\"\n", `p"a`, `p\"a`},
+		{envFormat{}, "PASSWORD='{{s}}'\n", `p"a`, `p"a`},
+		{envFormat{}, "PASSWORD='{{s}}'\n", `it's`, ""},
+		{envFormat{}, "PASSWORD={{s}}\n", `p #a`, ""},
+		{propertiesFormat{}, "password = {{s}}\n", "a\nb", `a\nb`},
+		{iniFormat{}, "password = {{s}}\n", "a\n[admin]", ""},
+	}
+	for _, c := range cases {
+		escaped, err := c.format.Escape(c.content, strings.Index(c.content, "{{s}}"), c.value)
+		if c.expected == "" {
+			Expect(err).To(Not(BeNil()), c.content)
+			continue
+		}
+		Expect(err).To(BeNil(), c.content)
+		Expect(escaped).To(Equal(c.expected), c.content)
+	}
+}
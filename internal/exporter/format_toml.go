@@ -0,0 +1,161 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+
+	"github.com/BurntSushi/toml"
+
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// tomlFormat is our TOML IFormat implementation
+type tomlFormat struct{}
+
+// Name ...
+func (f tomlFormat) Name() string {
+	return config.FormatTOML
+}
+
+// Extensions ...
+func (f tomlFormat) Extensions() []string {
+	return []string{".toml"}
+}
+
+// Decode ...
+func (f tomlFormat) Decode(content string) (map[string]interface{}, []string, error) {
+	document := map[string]interface{}{}
+	if _, err := toml.Decode(content, &document); err != nil {
+		return nil, nil, err
+	}
+
+	return normalizeTOML(document).(map[string]interface{}), nil, nil
+}
+
+// Encode writes TOML subtrees as JSON, as TOML has no way to write a standalone array
+func (f tomlFormat) Encode(value interface{}) (string, error) {
+	return marshalJSON(value)
+}
+
+// Escape writes secrets the way TOML basic strings escape them, which are JSON compatible.
+// Literal strings have no escape sequences, they only get the secrets they can hold as they are
+func (f tomlFormat) Escape(content string, offset int, value string) (string, error) {
+	switch tomlQuoting(content, offset) {
+	case quotingDouble, quotingMultiDouble:
+		return escapeJSONString(value), nil
+	case quotingSingle:
+		if strings.Contains(value, "'") {
+			return "", errors.New("holds a single quote, it can't be written in a literal string, use a basic string (\"...\")")
+		}
+		return escapeSingleLine(value, "a literal string, use a basic string (\"...\")")
+	case quotingMultiSingle:
+		if strings.Contains(value, "'''") {
+			return "", errors.New("holds ''', it can't be written in a multi-line literal string, use a basic string (\"...\")")
+		}
+		return value, nil
+	case quotingComment:
+		return escapeSingleLine(value, "a comment")
+	}
+
+	return escapeBare(value)
+}
+
+// tomlQuoting returns the quoting context of the given offset of a TOML document: basic
+// and literal strings, either single or multi-line, and comments
+func tomlQuoting(content string, offset int) int {
+	quoting := quotingNone
+	for i := 0; i < offset && i < len(content); i++ {
+		switch quoting {
+		case quotingDouble:
+			if content[i] == '\\' {
+				i++
+			} else if content[i] == '"' || content[i] == '\n' {
+				quoting = quotingNone
+			}
+		case quotingSingle:
+			if content[i] == '\'' || content[i] == '\n' {
+				quoting = quotingNone
+			}
+		case quotingMultiDouble:
+			if content[i] == '\\' {
+				i++
+			} else if strings.HasPrefix(content[i:], `"""`) {
+				quoting = quotingNone
+				i += 2
+			}
+		case quotingMultiSingle:
+			if strings.HasPrefix(content[i:], "'''") {
+				quoting = quotingNone
+				i += 2
+			}
+		case quotingComment:
+			if content[i] == '\n' {
+				quoting = quotingNone
+			}
+		default:
+			switch {
+			case strings.HasPrefix(content[i:], `"""`):
+				quoting = quotingMultiDouble
+				i += 2
+			case strings.HasPrefix(content[i:], "'''"):
+				quoting = quotingMultiSingle
+				i += 2
+			case content[i] == '"':
+				quoting = quotingDouble
+			case content[i] == '\'':
+				quoting = quotingSingle
+			case content[i] == '#':
+				quoting = quotingComment
+			}
+		}
+	}
+
+	return quoting
+}
+
+// tomlLocalFormats are the layouts of TOML dates and times without a time zone
+var tomlLocalFormats = map[string]string{
+	"datetime-local": "2006-01-02T15:04:05.999999999",
+	"date-local":     "2006-01-02",
+	"time-local":     "15:04:05.999999999",
+}
+
+// normalizeTOML converts the TOML dates and special floats to the strings we write to Consul,
+// and arrays of tables to plain arrays
+func normalizeTOML(value interface{}) interface{} {
+	switch value.(type) {
+	case []map[string]interface{}:
+		array := make([]interface{}, 0, len(value.([]map[string]interface{})))
+		for _, table := range value.([]map[string]interface{}) {
+			array = append(array, normalizeTOML(table))
+		}
+		return array
+
+	case map[string]interface{}:
+		for key, child := range value.(map[string]interface{}) {
+			value.(map[string]interface{})[key] = normalizeTOML(child)
+		}
+
+	case []interface{}:
+		for index, child := range value.([]interface{}) {
+			value.([]interface{})[index] = normalizeTOML(child)
+		}
+
+	case time.Time:
+		date := value.(time.Time)
+		if layout, ok := tomlLocalFormats[date.Location().String()]; ok {
+			return date.Format(layout)
+		}
+		return date.Format(time.RFC3339Nano)
+
+	case float64:
+		if math.IsInf(value.(float64), 0) || math.IsNaN(value.(float64)) {
+			return fmt.Sprint(value)
+		}
+	}
+
+	return value
+}
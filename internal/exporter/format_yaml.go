@@ -0,0 +1,384 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// jsonNumber matches the YAML numbers we can keep exactly as written
+var jsonNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// yamlFormat is our YAML IFormat implementation
+type yamlFormat struct{}
+
+// Name ...
+func (f yamlFormat) Name() string {
+	return config.FormatYAML
+}
+
+// Extensions ...
+func (f yamlFormat) Extensions() []string {
+	return []string{".yaml", ".yml"}
+}
+
+// Decode ...
+func (f yamlFormat) Decode(content string) (map[string]interface{}, []string, error) {
+	// Decode data into a YAML node tree, so we get our values as written
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &document); err != nil {
+		return nil, nil, err
+	}
+
+	// Empty files are empty documents
+	if len(document.Content) == 0 {
+		return map[string]interface{}{}, nil, nil
+	}
+
+	// Create "generic" yaml struct
+	root := resolveAlias(document.Content[0])
+	if root.Kind != yaml.MappingNode {
+		return nil, nil, errors.New(fmt.Sprintf("line %d: document must be a mapping", root.Line))
+	}
+
+	decoder := &yamlDecoder{}
+	mapping := decoder.mapping(root)
+
+	return mapping, decoder.warnings, nil
+}
+
+// Encode ...
+func (f yamlFormat) Encode(value interface{}) (string, error) {
+	buffer := &bytes.Buffer{}
+	encoder := yaml.NewEncoder(buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(yamlNode(value)); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+
+	return buffer.String(), nil
+}
+
+// Escape writes secrets the way double quoted YAML strings escape them, and single quoted ones
+// double their quotes. Plain scalars have no escape sequences, they only get the secrets
+// they can hold as they are
+func (f yamlFormat) Escape(content string, offset int, value string) (string, error) {
+	switch yamlQuoting(content, offset) {
+	case quotingDouble:
+		return escapeJSONString(value), nil
+	case quotingSingle:
+		escaped, err := escapeSingleLine(value, "a single quoted string, use double quotes")
+		return strings.ReplaceAll(escaped, "'", "''"), err
+	case quotingBlock:
+		return escapeSingleLine(value, "a block scalar, use double quotes")
+	case quotingComment:
+		return escapeSingleLine(value, "a comment")
+	}
+
+	if !yamlPlainScalar(value) {
+		return "", errors.New("can't be written in a plain scalar as it is, put its placeholder within double quotes")
+	}
+
+	return value, nil
+}
+
+// yamlBlockIndicator matches the lines starting a block scalar (| or >), held by their next,
+// more indented, lines
+var yamlBlockIndicator = regexp.MustCompile(`(^\s*|[:-]\s+)[|>][-+1-9]*\s*(\s#.*)?$`)
+
+// yamlQuoting returns the quoting context of the given offset of a YAML document: double and
+// single quoted scalars, block scalars and comments, anything else being a plain scalar
+func yamlQuoting(content string, offset int) int {
+	quoting := quotingNone
+	blockIndent := -1
+	for start := 0; start <= offset && start <= len(content); {
+		end := strings.IndexByte(content[start:], '\n')
+		if end < 0 {
+			end = len(content)
+		} else {
+			end += start
+		}
+		line := content[start:end]
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		within := offset <= end
+
+		// Block scalars hold every blank or more indented line following them
+		if blockIndent >= 0 {
+			if strings.TrimSpace(line) == "" || indent > blockIndent {
+				if within {
+					return quotingBlock
+				}
+				start = end + 1
+				continue
+			}
+			blockIndent = -1
+		}
+
+		limit := len(line)
+		if within {
+			limit = offset - start
+		}
+		for i := 0; i < limit; i++ {
+			switch quoting {
+			case quotingDouble:
+				if line[i] == '\\' {
+					i++
+				} else if line[i] == '"' {
+					quoting = quotingNone
+				}
+			case quotingSingle:
+				if line[i] == '\'' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+				} else if line[i] == '\'' {
+					quoting = quotingNone
+				}
+			default:
+				if line[i] == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+					if within {
+						return quotingComment
+					}
+					i = limit
+				} else if (line[i] == '"' || line[i] == '\'') && yamlScalarStart(line[:i]) {
+					quoting = quotingDouble
+					if line[i] == '\'' {
+						quoting = quotingSingle
+					}
+				}
+			}
+		}
+		if within {
+			return quoting
+		}
+
+		if quoting == quotingNone && yamlBlockIndicator.MatchString(line) {
+			blockIndent = indent
+		}
+		start = end + 1
+	}
+
+	return quoting
+}
+
+// yamlScalarStart tells if a scalar starts after the given beginning of a line, so a quote
+// found there starts a quoted scalar instead of being part of a plain one
+func yamlScalarStart(prefix string) bool {
+	trimmed := strings.TrimRight(prefix, " \t")
+	if trimmed == "" {
+		return true
+	}
+
+	switch trimmed[len(trimmed)-1] {
+	case '[', '{', ',':
+		return true
+	case ':', '-', '?':
+		// Mapping values, sequence items and keys are separated from their indicator
+		return len(trimmed) < len(prefix)
+	}
+
+	return false
+}
+
+// yamlPlainScalar tells if the given secret can be written as a plain scalar as it is: on a
+// single line, with no leading indicator, comment, mapping or flow collection characters
+func yamlPlainScalar(value string) bool {
+	if value == "" {
+		return true
+	}
+	if value != strings.TrimSpace(value) || strings.ContainsAny(value, "\r\n#,[]{}") {
+		return false
+	}
+	if strings.Contains(value, ": ") || strings.HasSuffix(value, ":") {
+		return false
+	}
+	if strings.ContainsRune("!&*|>'\"%@`", rune(value[0])) {
+		return false
+	}
+
+	return !strings.ContainsRune("-?:", rune(value[0])) || (len(value) > 1 && value[1] != ' ')
+}
+
+// yamlDecoder converts YAML nodes to the "generic" structure we traverse, where numbers
+// and dates are kept as written instead of going through Go types
+type yamlDecoder struct {
+	warnings []string
+}
+
+// value converts any YAML node, telling if it's one we can write to Consul
+func (d *yamlDecoder) value(node *yaml.Node) (interface{}, bool) {
+	node = resolveAlias(node)
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		return d.mapping(node), true
+
+	case yaml.SequenceNode:
+		array := make([]interface{}, 0, len(node.Content))
+		for _, item := range node.Content {
+			if value, ok := d.value(item); ok {
+				array = append(array, value)
+			}
+		}
+		return array, true
+
+	case yaml.ScalarNode:
+		// Custom tags mean something to some other tool only
+		if !strings.HasPrefix(node.ShortTag(), "!!") {
+			d.unsupported(node, fmt.Sprintf("custom tag %s is not supported", node.ShortTag()))
+			return nil, false
+		}
+
+		switch node.ShortTag() {
+		case "!!null":
+			return nil, true
+		case "!!str", "!!timestamp":
+			return node.Value, true
+		case "!!int", "!!float":
+			if jsonNumber.MatchString(node.Value) {
+				return json.Number(node.Value), true
+			}
+		}
+
+		// Any other scalar (booleans, hex numbers, binaries...) is decoded the YAML way
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			d.unsupported(node, err.Error())
+			return nil, false
+		}
+		if number, ok := value.(float64); ok && (math.IsInf(number, 0) || math.IsNaN(number)) {
+			// Neither Consul nor JSON have a way to write these, keep them as written
+			return node.Value, true
+		}
+		if _, ok := formatScalar(value); !ok {
+			d.unsupported(node, fmt.Sprintf("%s values are not supported", node.ShortTag()))
+			return nil, false
+		}
+		return value, true
+	}
+
+	d.unsupported(node, "unknown YAML construct")
+
+	return nil, false
+}
+
+// mapping converts a YAML mapping node, applying any merge keys
+func (d *yamlDecoder) mapping(node *yaml.Node) map[string]interface{} {
+	mapping := map[string]interface{}{}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := resolveAlias(node.Content[i]), node.Content[i+1]
+
+		// Merge keys (<<: *anchor) bring their mapping keys, explicit keys always win
+		if key.Kind == yaml.ScalarNode && key.ShortTag() == "!!merge" {
+			merged := []*yaml.Node{value}
+			if resolveAlias(value).Kind == yaml.SequenceNode {
+				merged = resolveAlias(value).Content
+			}
+			for _, mergedNode := range merged {
+				if resolveAlias(mergedNode).Kind != yaml.MappingNode {
+					d.unsupported(mergedNode, "merge keys must point to mappings")
+					continue
+				}
+				for mergedKey, mergedValue := range d.mapping(resolveAlias(mergedNode)) {
+					if _, ok := mapping[mergedKey]; !ok {
+						mapping[mergedKey] = mergedValue
+					}
+				}
+			}
+			continue
+		}
+
+		// Non string keys (numbers, booleans...) are used as written, complex ones can't be a KV path
+		if key.Kind != yaml.ScalarNode {
+			d.unsupported(key, "mapping keys must be scalars")
+			continue
+		}
+
+		if converted, ok := d.value(value); ok {
+			mapping[key.Value] = converted
+		}
+	}
+
+	return mapping
+}
+
+// unsupported keeps track of a YAML construct we can't write to Consul
+func (d *yamlDecoder) unsupported(node *yaml.Node, reason string) {
+	d.warnings = append(d.warnings, fmt.Sprintf("line %d: %s", node.Line, reason))
+}
+
+// resolveAlias returns the node an alias points to, or the node itself
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+
+	return node
+}
+
+// yamlNode builds the YAML node of a "generic" value, with its mapping keys sorted
+func yamlNode(value interface{}) *yaml.Node {
+	switch value.(type) {
+	case blob:
+		return yamlNode(value.(blob).value)
+
+	case map[string]interface{}:
+		mapping := value.(map[string]interface{})
+		keys := make([]string, 0, len(mapping))
+		for key := range mapping {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, key := range keys {
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, yamlNode(mapping[key]))
+		}
+		return node
+
+	case []interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range value.([]interface{}) {
+			node.Content = append(node.Content, yamlNode(item))
+		}
+		return node
+
+	case nil:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(value.(json.Number).String(), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value.(json.Number).String()}
+
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: fmt.Sprint(value)}
+
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value.(string)}
+	}
+
+	// Any other number YAML decoded for us
+	scalar, _ := formatScalar(value)
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: scalar}
+	if _, ok := value.(float64); ok {
+		node.Tag = "!!float"
+	} else {
+		node.Tag = "!!int"
+	}
+
+	return node
+}
@@ -0,0 +1,65 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/util"
+
+	"fmt"
+	"sort"
+)
+
+// keyOwner is the file, and the key of this file before our key rules, an exported key comes from
+type keyOwner struct {
+	file string
+	key  string
+}
+
+// applyKeyRules rewrites the keys of a file with our key rules, adding them to the given local
+// data. Keys our rules refuse, or rewritten as another key of the file, are reported. It returns
+// the key each added key was rewritten from
+func (e *exporter) applyKeyRules(filePath string, fileData map[string]string, localData map[string]string) map[string]string {
+	keys := make([]string, 0, len(fileData))
+	for key := range fileData {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	rewritten := map[string]string{}
+	for _, key := range keys {
+		newKey := e.config.RewriteKey(key)
+		if err := e.config.ValidateKey(newKey); err != nil {
+			e.addError(util.ErrorInvalidKey, fmt.Sprintf("EXPORTER: %s: invalid key %s: %s", filePath, newKey, err.Error()))
+			continue
+		}
+		if original, exists := rewritten[newKey]; exists {
+			e.addError(util.ErrorInvalidKey, fmt.Sprintf("EXPORTER: %s: keys %s and %s are both rewritten as %s", filePath, original, key, newKey))
+			continue
+		}
+
+		rewritten[newKey] = key
+		localData[newKey] = fileData[key]
+	}
+
+	return rewritten
+}
+
+// mergeFileKeys adds the keys of a file to the given local data of its mount. A key already
+// exported by another file is reported when either was rewritten by our key rules, as such
+// keys are only found once rewritten
+func (e *exporter) mergeFileKeys(filePath string, fileData map[string]string, originals map[string]string, localData map[string]string, owners map[string]keyOwner) {
+	keys := make([]string, 0, len(fileData))
+	for key := range fileData {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		original := originals[key]
+		if owner, exists := owners[key]; exists && (owner.key != key || original != key) {
+			e.addError(util.ErrorInvalidKey, fmt.Sprintf("EXPORTER: %s: key %s and key %s of %s are both rewritten as %s", filePath, original, owner.key, owner.file, key))
+			continue
+		}
+
+		owners[key] = keyOwner{file: filePath, key: original}
+		localData[key] = fileData[key]
+	}
+}
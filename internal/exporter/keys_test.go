@@ -0,0 +1,55 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+	"github.com/miniclip/gonsul/internal/util"
+	"github.com/miniclip/gonsul/tests/mocks"
+
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+
+	"errors"
+	"strings"
+	"testing"
+)
+
+// keysConfig is the configuration our key rules depend on
+func keysConfig() *mocks.IConfig {
+	cfg := &mocks.IConfig{}
+	cfg.On("ShouldExpand", mock.Anything).Return(func(format string) bool { return format == config.FormatJSON })
+	cfg.On("RewriteKey", mock.Anything).Return(strings.ToLower)
+	cfg.On("ValidateKey", mock.Anything).Return(func(key string) error {
+		if strings.Contains(key, " ") {
+			return errors.New("character ' ' is not allowed")
+		}
+		return nil
+	})
+
+	return exportDefaults(cfg)
+}
+
+func TestParseDirAppliesKeyRules(t *testing.T) {
+	RegisterTestingT(t)
+
+	memory := newMemSource()
+	memory.addFile("App/db.json", []byte(`{"Host": "db.internal", "Port": 5432}`))
+	memory.addFile("app/bad name.txt", []byte("value"))
+	memory.addFile("app/clash.json", []byte(`{"key": "a", "KEY": "b"}`))
+	memory.addFile("app/db/host.txt", []byte("db.other"))
+	memory.addFile("app/db/user.txt", []byte("admin"))
+
+	e := &exporter{config: keysConfig(), logger: util.NewLogger(0)}
+	localData := map[string]string{}
+	e.parseDir(memory, ".", localData)
+
+	// Keys are rewritten, and the ones our rules refuse are reported per file
+	Expect(localData).To(Equal(map[string]string{"app/db/host": "db.internal", "app/db/port": "5432", "app/db/user": "admin", "app/clash/key": "b"}))
+	Expect(e.errors).To(HaveLen(3))
+	Expect(e.errors[0].message).To(Equal("EXPORTER: app/bad name.txt: invalid key app/bad name: character ' ' is not allowed"))
+	Expect(e.errors[1].message).To(Equal("EXPORTER: app/clash.json: keys app/clash/KEY and app/clash/key are both rewritten as app/clash/key"))
+	Expect(e.errors[1].code).To(Equal(util.ErrorInvalidKey))
+
+	// Files of a mount rewritten as the same key are reported with both files
+	Expect(e.errors[2].message).To(Equal("EXPORTER: app/db/host.txt: key app/db/host and key App/db/Host of App/db.json are both rewritten as app/db/host"))
+	Expect(e.errors[2].code).To(Equal(util.ErrorInvalidKey))
+}
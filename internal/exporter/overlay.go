@@ -0,0 +1,144 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// sourceFile is a rendered file of our source, along with the path it's exported as
+type sourceFile struct {
+	path    string
+	content string
+	// from holds the base file, and the overlay one if any, an overlay file is resolved from
+	from []string
+}
+
+// applyOverlays resolves our overlays: base files are not exported themselves, each overlay
+// directory getting every base file instead, overridden by its own file of the same path (deep
+// merged for JSON and YAML files), along with its own extra files. Any other file is left as is
+func (e *exporter) applyOverlays(files []sourceFile) []sourceFile {
+	base := e.config.GetOverlayBase()
+	if base == "" {
+		return files
+	}
+
+	var baseFiles []sourceFile
+	overlayFiles := map[string]map[string]sourceFile{}
+	var resolved []sourceFile
+	for _, file := range files {
+		if relative, ok := overlayPath(base, file.path); ok {
+			baseFiles = append(baseFiles, sourceFile{path: relative, content: file.content})
+			continue
+		}
+		overlay, relative, ok := e.findOverlay(file.path)
+		if !ok {
+			resolved = append(resolved, file)
+			continue
+		}
+		if overlayFiles[overlay] == nil {
+			overlayFiles[overlay] = map[string]sourceFile{}
+		}
+		overlayFiles[overlay][relative] = file
+	}
+
+	for _, overlay := range e.config.GetOverlays() {
+		overrides := overlayFiles[overlay]
+
+		// Every base file, overridden by the overlay own one
+		for _, baseFile := range baseFiles {
+			file := sourceFile{path: path.Join(overlay, baseFile.path), content: baseFile.content, from: []string{path.Join(base, baseFile.path)}}
+			if override, exists := overrides[baseFile.path]; exists {
+				file.content = e.mergeOverlay(file.path, baseFile.content, override.content)
+				file.from = append(file.from, override.path)
+				delete(overrides, baseFile.path)
+			}
+			resolved = append(resolved, file)
+		}
+
+		// Followed by the overlay extra files
+		var extra []string
+		for relative := range overrides {
+			extra = append(extra, relative)
+		}
+		sort.Strings(extra)
+		for _, relative := range extra {
+			resolved = append(resolved, overrides[relative])
+		}
+	}
+
+	return resolved
+}
+
+// findOverlay returns the overlay directory holding the given file, along with its path relative
+// to that directory. It tells whether the file belongs to any overlay
+func (e *exporter) findOverlay(filePath string) (string, string, bool) {
+	for _, overlay := range e.config.GetOverlays() {
+		if relative, ok := overlayPath(overlay, filePath); ok {
+			return overlay, relative, true
+		}
+	}
+
+	return "", "", false
+}
+
+// overlayPath returns the path of a file relative to the given directory, telling whether
+// the file is within that directory at all
+func overlayPath(directory string, filePath string) (string, bool) {
+	filePath = strings.TrimPrefix(path.Clean(filePath), "/")
+	if !strings.HasPrefix(filePath, directory+"/") {
+		return "", false
+	}
+
+	return strings.TrimPrefix(filePath, directory+"/"), true
+}
+
+// mergeOverlay merges an overlay file over its base file. JSON and YAML documents are deep
+// merged (maps are merged, anything else is replaced and null values remove keys), any other
+// file being replaced as a whole
+func (e *exporter) mergeOverlay(filePath string, base string, override string) string {
+	format := findFormat(filepath.Ext(filePath))
+	if format == nil || (format.Name() != config.FormatJSON && format.Name() != config.FormatYAML) {
+		return override
+	}
+
+	baseDocument, baseWarnings, ok := e.validateDocument(format, filePath, base)
+	if !ok || !e.checkWarnings(format, filePath, baseWarnings) {
+		return override
+	}
+	// Broken overrides are reported once parsed as they are
+	document, warnings, err := format.Decode(override)
+	if err != nil || !e.checkWarnings(format, filePath, warnings) {
+		return override
+	}
+
+	return e.encodeDocument(format, filePath, mergeMaps(baseDocument, document))
+}
+
+// mergeMaps deep merges the given override map over the base one, following JSON merge patch
+// semantics (RFC 7386)
+func mergeMaps(base map[string]interface{}, override map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for key, value := range base {
+		merged[key] = value
+	}
+
+	for key, value := range override {
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+		// Maps are merged, removing their own null values even if there's nothing to merge with
+		if overrideMap, isMap := value.(map[string]interface{}); isMap {
+			baseMap, _ := merged[key].(map[string]interface{})
+			merged[key] = mergeMaps(baseMap, overrideMap)
+			continue
+		}
+		merged[key] = value
+	}
+
+	return merged
+}
@@ -0,0 +1,46 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/util"
+	"github.com/miniclip/gonsul/tests/mocks"
+
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+// overlayConfig is the configuration resolving overlays depends on
+func overlayConfig() *mocks.IConfig {
+	cfg := &mocks.IConfig{}
+	cfg.On("GetOverlayBase").Return("base")
+	cfg.On("GetOverlays").Return([]string{"dev", "prod"})
+
+	return exportDefaults(cfg)
+}
+
+func TestParseDirAppliesOverlays(t *testing.T) {
+	RegisterTestingT(t)
+
+	memory := newMemSource()
+	memory.addFile("base/app.json", []byte(`{"db": {"host": "db.internal", "port": 5432}, "debug": false, "tags": ["a", "b"]}`))
+	memory.addFile("base/notes.txt", []byte("base notes"))
+	memory.addFile("dev/app.json", []byte(`{"db": {"host": "localhost", "port": null}, "debug": true, "tags": ["dev"]}`))
+	memory.addFile("dev/extra.txt", []byte("dev only"))
+	memory.addFile("prod/notes.txt", []byte("prod notes"))
+	memory.addFile("shared/other.txt", []byte("as is"))
+
+	e := &exporter{config: overlayConfig(), logger: util.NewLogger(0)}
+	localData := map[string]string{}
+	e.parseDir(memory, ".", localData)
+
+	// Each overlay gets the whole base, documents being deep merged and blobs replaced
+	Expect(e.errors).To(BeEmpty())
+	Expect(localData).To(Equal(map[string]string{
+		"dev/app":      "{\n  \"db\": {\n    \"host\": \"localhost\"\n  },\n  \"debug\": true,\n  \"tags\": [\n    \"dev\"\n  ]\n}",
+		"dev/notes":    "base notes",
+		"dev/extra":    "dev only",
+		"prod/app":     `{"db": {"host": "db.internal", "port": 5432}, "debug": false, "tags": ["a", "b"]}`,
+		"prod/notes":   "prod notes",
+		"shared/other": "as is",
+	}))
+}
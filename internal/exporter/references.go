@@ -0,0 +1,232 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/util"
+
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// documentCSV marks the values written as a CSV record, arrays of the csv mode, which have no IFormat
+const documentCSV = "csv"
+
+// referencingFile is a file with references, validated against its schemas once they're resolved
+type referencingFile struct {
+	source  ISource
+	file    sourceFile
+	schemas map[string]*schema
+}
+
+// referencePattern matches our {{ref key}} references, the key being quoted or not
+var referencePattern = regexp.MustCompile(`\{\{\s*ref\s+(?:"([^"]*)"|'([^']*)'|([^\s"'}]+))\s*\}\}`)
+
+// includePattern matches our {{include file}} snippets, the file being quoted or not
+var includePattern = regexp.MustCompile(`\{\{\s*include\s+(?:"([^"]*)"|'([^']*)'|([^\s"'}]+))\s*\}\}`)
+
+// referenceTarget returns the key or file of a matched reference or include
+func referenceTarget(match []string) string {
+	for _, group := range match[1:] {
+		if group != "" {
+			return group
+		}
+	}
+
+	return ""
+}
+
+// resolveIncludes replaces the {{include file}} snippets of a file with the content of those files,
+// themselves resolved. The given chain holds the files being included, the last one being the
+// file we resolve, so cycles are detected. It tells whether every snippet could be included
+func (e *exporter) resolveIncludes(source ISource, chain []string, content string) (string, bool) {
+	ok := true
+	resolved := includePattern.ReplaceAllStringFunc(content, func(tag string) string {
+		if !ok {
+			return tag
+		}
+		name := referenceTarget(includePattern.FindStringSubmatch(tag))
+		included := path.Clean(strings.TrimPrefix(name, "/"))
+
+		for index, file := range chain {
+			if file == included {
+				e.addError(util.ErrorFailedReference, fmt.Sprintf("EXPORTER: %s: include cycle: %s", chain[0], strings.Join(append(chain[index:], included), " -> ")))
+				ok = false
+				return tag
+			}
+		}
+
+		snippet, err := includeFile(source, name)
+		if err != nil {
+			e.addError(util.ErrorFailedReference, fmt.Sprintf("EXPORTER: %s: %s", chain[0], err.Error()))
+			ok = false
+			return tag
+		}
+
+		snippet, ok = e.resolveIncludes(source, append(append([]string{}, chain...), included), snippet)
+		return snippet
+	})
+
+	return resolved, ok
+}
+
+// resolveReferences replaces the {{ref key}} references of our values with the value of the
+// referenced keys, relative to our Consul KV base path, once every key is exported
+func (e *exporter) resolveReferences(localData map[string]string) {
+	keys := make([]string, 0, len(localData))
+	for key := range localData {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	resolved := map[string]bool{}
+	for _, key := range keys {
+		e.resolveReference(key, localData, resolved, nil)
+	}
+}
+
+// resolveReference resolves the references of a single key, referenced keys first. The given
+// chain holds the keys referencing this one, so cycles are detected. It tells whether the key
+// could be resolved
+func (e *exporter) resolveReference(key string, localData map[string]string, resolved map[string]bool, chain []string) bool {
+	if ok, done := resolved[key]; done {
+		return ok
+	}
+	for index, referencing := range chain {
+		if referencing == key {
+			e.addError(util.ErrorFailedReference, fmt.Sprintf("EXPORTER: reference cycle: %s", strings.Join(append(chain[index:], key), " -> ")))
+			return false
+		}
+	}
+	chain = append(chain, key)
+
+	format := e.documents[key]
+	value, ok := e.substituteReferences(key, localData[key], format, func(target string) (string, bool) {
+		// Keys left untouched by our null policy are not exported, so they can't be referenced
+		if _, exists := localData[target]; !exists {
+			e.addError(util.ErrorFailedReference, fmt.Sprintf("EXPORTER: %s: reference to unknown key: %s", key, target))
+			return "", false
+		}
+		if !e.resolveReference(target, localData, resolved, chain) {
+			return "", false
+		}
+
+		return localData[target], true
+	})
+
+	// Documents must still be valid ones once their references are resolved
+	if ok && value != localData[key] && findFormatByName(format) != nil {
+		if _, _, err := findFormatByName(format).Decode(value); err != nil {
+			e.addError(util.ErrorFailedReference, fmt.Sprintf("EXPORTER: %s: invalid %s once references are resolved: %s", key, strings.ToUpper(format), err.Error()))
+			ok = false
+		}
+	}
+	localData[key] = value
+	resolved[key] = ok
+
+	return ok
+}
+
+// substituteReferences replaces the references of the given content, written in the given format
+// ("" for plain values), with the values of their target keys, escaped for where they are written.
+// The given function returns the value of a target key, telling whether it has one. It tells
+// whether every reference was replaced, the others being left as they are
+func (e *exporter) substituteReferences(name string, content string, format string, value func(target string) (string, bool)) (string, bool) {
+	ok := true
+	var substituted strings.Builder
+	last := 0
+	for _, match := range referencePattern.FindAllStringSubmatchIndex(content, -1) {
+		tag := content[match[0]:match[1]]
+		substituted.WriteString(content[last:match[0]])
+		last = match[1]
+
+		target := path.Join(e.config.GetConsulBasePath(), referenceTarget(referencePattern.FindStringSubmatch(tag)))
+		targetValue, found := value(target)
+		if found && format != "" {
+			escaped, err := escapeReference(format, content, match[0], targetValue)
+			if err != nil {
+				e.addError(util.ErrorFailedReference, fmt.Sprintf("EXPORTER: %s: reference to %s: %s", name, target, err.Error()))
+			}
+			targetValue, found = escaped, err == nil
+		}
+		if !found {
+			ok = false
+			targetValue = tag
+		}
+		substituted.WriteString(targetValue)
+	}
+	substituted.WriteString(content[last:])
+
+	return substituted.String(), ok
+}
+
+// escapeReference escapes a referenced value written at the given offset of a document
+func escapeReference(format string, content string, offset int, value string) (string, error) {
+	if format == documentCSV {
+		return escapeCSVItem(content, offset, value)
+	}
+
+	return findFormatByName(format).Escape(content, offset, value)
+}
+
+// escapeCSVItem escapes a value written within a CSV record, doubling its quotes within quoted
+// items. Unquoted items can only get values that don't need any quoting
+func escapeCSVItem(content string, offset int, value string) (string, error) {
+	if strings.Count(content[:offset], `"`)%2 == 1 {
+		return strings.Replace(value, `"`, `""`, -1), nil
+	}
+	if strings.ContainsAny(value, ",\"\r\n") {
+		return "", errors.New("can't be written in an unquoted CSV item")
+	}
+
+	return value, nil
+}
+
+// markDocument records the format of a value written as a whole document, so the values it
+// references are escaped for it
+func (e *exporter) markDocument(key string, format string) {
+	if e.documents == nil {
+		e.documents = map[string]string{}
+	}
+	e.documents[key] = format
+}
+
+// validateReferencing validates the files with references against their schemas, once the
+// values they reference are resolved and written in them
+func (e *exporter) validateReferencing(localData map[string]string) {
+	for _, referencing := range e.referencing {
+		format := ""
+		if fileFormat := findFormat(filepath.Ext(referencing.file.path)); fileFormat != nil {
+			format = fileFormat.Name()
+		}
+
+		// Broken references are already reported along with their keys
+		content, ok := e.substituteReferences(referencing.file.path, referencing.file.content, format, func(target string) (string, bool) {
+			targetValue, exists := localData[target]
+			return targetValue, exists
+		})
+		if ok {
+			e.validateSchemas(referencing.source, referencing.file.path, content, referencing.schemas)
+		}
+	}
+}
+
+// protectReferences replaces our references with markers mustache leaves alone, as they're only
+// resolved once every key is exported. It returns the function restoring them
+func protectReferences(content string) (string, func(string) string) {
+	var references []string
+	protected := referencePattern.ReplaceAllStringFunc(content, func(tag string) string {
+		references = append(references, tag)
+		return fmt.Sprintf("\x00gonsul:ref:%d\x00", len(references)-1)
+	})
+
+	return protected, func(rendered string) string {
+		for index, reference := range references {
+			rendered = strings.Replace(rendered, fmt.Sprintf("\x00gonsul:ref:%d\x00", index), reference, 1)
+		}
+		return rendered
+	}
+}
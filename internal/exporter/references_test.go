@@ -0,0 +1,114 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/util"
+	"github.com/miniclip/gonsul/tests/mocks"
+
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+// referencesConfig is the configuration resolving references depends on
+func referencesConfig() *mocks.IConfig {
+	cfg := &mocks.IConfig{}
+	cfg.On("DoReferences").Return(true)
+	cfg.On("GetConsulBasePath").Return("base")
+
+	return exportDefaults(cfg)
+}
+
+func TestResolveReferences(t *testing.T) {
+	RegisterTestingT(t)
+
+	e := &exporter{config: referencesConfig(), logger: util.NewLogger(0)}
+	localData := map[string]string{
+		"base/prod/shared/db-host": "db.internal",
+		"base/prod/app/url":        `postgres://{{ref "prod/shared/db-host"}}:{{ref prod/app/port}}`,
+		"base/prod/app/port":       "5432",
+		"base/prod/app/dsn":        "{{ref 'prod/app/url'}}/app",
+	}
+	e.resolveReferences(localData)
+	Expect(e.errors).To(BeEmpty())
+	Expect(localData["base/prod/app/url"]).To(Equal("postgres://db.internal:5432"))
+	Expect(localData["base/prod/app/dsn"]).To(Equal("postgres://db.internal:5432/app"))
+
+	// Cycles and unknown keys are reported
+	localData = map[string]string{
+		"base/a": "{{ref b}}",
+		"base/b": "{{ref c}}",
+		"base/c": "{{ref a}}",
+		"base/d": "{{ref missing}}",
+	}
+	e.resolveReferences(localData)
+	Expect(e.errors).To(HaveLen(2))
+	Expect(e.errors[0].message).To(Equal("EXPORTER: reference cycle: base/a -> base/b -> base/c -> base/a"))
+	Expect(e.errors[1].message).To(Equal("EXPORTER: base/d: reference to unknown key: base/missing"))
+}
+
+func TestParseDirResolvesIncludes(t *testing.T) {
+	RegisterTestingT(t)
+
+	memory := newMemSource()
+	memory.addFile("app/db.json", []byte(`{"host": "{{include shared/host.snippet}}", "url": "{{ref app/url}}"}`))
+	memory.addFile("shared/host.snippet", []byte(`{{include "shared/domain.snippet"}}`))
+	memory.addFile("shared/domain.snippet", []byte(`db.internal`))
+	memory.addFile("loop/a.txt", []byte(`{{include loop/b.txt}}`))
+	memory.addFile("loop/b.txt", []byte(`{{include loop/a.txt}}`))
+
+	e := &exporter{config: referencesConfig(), logger: util.NewLogger(0)}
+	localData := map[string]string{}
+	e.parseDir(memory, ".", localData)
+
+	// References are left for later, snippets are included
+	Expect(localData).To(Equal(map[string]string{"app/db": `{"host": "db.internal", "url": "{{ref app/url}}"}`}))
+	Expect(e.errors).To(HaveLen(2))
+	Expect(e.errors[0].message).To(Equal("EXPORTER: loop/a.txt: include cycle: loop/a.txt -> loop/b.txt -> loop/a.txt"))
+	Expect(e.errors[1].code).To(Equal(util.ErrorFailedReference))
+}
+
+func TestResolveReferencesInDocuments(t *testing.T) {
+	RegisterTestingT(t)
+
+	memory := newMemSource()
+	memory.addFile("shared/password.txt", []byte(`p"a\ss`))
+	memory.addFile("app/db.json", []byte(`{"password": "{{ref shared/password}}"}`))
+	memory.addFile("app/conf.yaml", []byte(`password: "{{ref shared/password}}"`))
+	memory.addFile("schemas/db.json", []byte(`{"properties": {"password": {"maxLength": 4}}}`))
+
+	cfg := &mocks.IConfig{}
+	cfg.On("DoReferences").Return(true)
+	cfg.On("GetConsulBasePath").Return("")
+	cfg.On("IsSchema", "schemas/db.json").Return(true)
+	cfg.On("GetSchemas", "app/db.json").Return([]string{"schemas/db.json"})
+	e := &exporter{config: exportDefaults(cfg), logger: util.NewLogger(0)}
+	localData := map[string]string{}
+	e.parseDir(memory, ".", localData)
+	Expect(e.errors).To(BeEmpty(), "Assert schemas are not validated against references")
+
+	// Referenced values are escaped for the documents they're written in, expanded keys get them as they are
+	e.resolveReferences(localData)
+	Expect(e.errors).To(BeEmpty())
+	Expect(localData["app/db"]).To(Equal(`{"password": "p\"a\\ss"}`))
+	Expect(localData["app/conf/password"]).To(Equal(`p"a\ss`))
+
+	// And files are validated against their schemas with the values they reference
+	e.validateReferencing(localData)
+	Expect(e.errors).To(HaveLen(1))
+	Expect(e.errors[0].message).To(Equal("EXPORTER: schema violation: app/db.json (schemas/db.json): /password: must be at most 4 characters long"))
+
+	// CSV records quote referenced values, which can't be written in unquoted items
+	e = &exporter{config: referencesConfig(), logger: util.NewLogger(0)}
+	localData = map[string]string{
+		"base/quote":  `say "hi"`,
+		"base/list":   `a,"{{ref quote}}"`,
+		"base/hosts":  "x,y",
+		"base/broken": "{{ref hosts}},z",
+	}
+	e.markDocument("base/list", documentCSV)
+	e.markDocument("base/broken", documentCSV)
+	e.resolveReferences(localData)
+	Expect(localData["base/list"]).To(Equal(`a,"say ""hi"""`))
+	Expect(e.errors).To(HaveLen(1))
+	Expect(e.errors[0].message).To(Equal("EXPORTER: base/broken: reference to base/hosts: can't be written in an unquoted CSV item"))
+}
@@ -1,6 +1,7 @@
 package exporter
 
 import (
+	"github.com/miniclip/gonsul/internal/config"
 	"github.com/miniclip/gonsul/internal/util"
 
 	"gopkg.in/src-d/go-git.v4"
@@ -9,16 +10,18 @@ import (
 
 	"errors"
 	"fmt"
+	"path"
+	"strings"
 )
 
 // downloadRepo ...
-func (e *exporter) downloadRepo() {
+func (e *exporter) downloadRepo(mount config.Mount) *git.Repository {
 	// Get some variables
 	var (
-		fileSystemPath = e.config.GetRepoRootDir()
-		url            = e.config.GetRepoURL()
-		sshUser        = e.config.GetRepoSSHUser()
-		sshKey         = e.config.GetRepoSSHKey()
+		fileSystemPath = mount.RepoRootDir
+		url            = mount.RepoURL
+		sshUser        = mount.RepoSSHUser
+		sshKey         = mount.RepoSSHKey
 		auth           ssh.AuthMethod
 	)
 
@@ -30,15 +33,19 @@ func (e *exporter) downloadRepo() {
 	// Clone given repository
 	repo, err := git.PlainClone(fileSystemPath, false, &git.CloneOptions{
 		URL:               url,
-		RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
+		RecurseSubmodules: git.SubmoduleRescursivity(mount.SubmoduleDepth()),
 		Auth:              auth,
+		// Shallow clones only care about our branch, as recent as possible
+		ReferenceName: plumbing.ReferenceName("refs/heads/" + mount.RepoBranch),
+		SingleBranch:  mount.RepoDepth > 0,
+		Depth:         mount.RepoDepth,
 	})
 
 	if err != nil {
 		e.logger.PrintDebug(fmt.Sprintf("REPO: failed clone (%s), trying to open directory", err.Error()))
 
 		// Cloning failed, most probably due to directory already cloned, moving to Open Dir
-		repo, err = git.PlainOpen(e.config.GetRepoRootDir())
+		repo, err = git.PlainOpen(fileSystemPath)
 
 		if err != nil {
 			util.ExitError(
@@ -48,15 +55,17 @@ func (e *exporter) downloadRepo() {
 			)
 		}
 
-		e.logger.PrintDebug(fmt.Sprintf("REPO: git directory opened: %s", e.config.GetRepoRootDir()))
+		e.logger.PrintDebug(fmt.Sprintf("REPO: git directory opened: %s", fileSystemPath))
 	}
 
 	// We're still here, let's try to checkout required branch
-	e.tryCheckout(repo, &auth)
+	e.tryCheckout(repo, &auth, mount)
+
+	return repo
 }
 
 // tryCheckout ...
-func (e *exporter) tryCheckout(repo *git.Repository, auth *ssh.AuthMethod) {
+func (e *exporter) tryCheckout(repo *git.Repository, auth *ssh.AuthMethod, mount config.Mount) {
 	// Initiate our worktree
 	workTree, err := repo.Worktree()
 	e.checkRepoError(err)
@@ -66,44 +75,90 @@ func (e *exporter) tryCheckout(repo *git.Repository, auth *ssh.AuthMethod) {
 	e.checkRepoError(err)
 
 	// Check if remote is valid (the same as ours
-	if !e.checkIfRemoteValid(remotes) {
+	if !e.checkIfRemoteValid(remotes, mount.RepoURL) {
 		util.ExitError(
-			errors.New(fmt.Sprintf("REPO: remote url is not equal to provided: %s", e.config.GetRepoURL())),
+			errors.New(fmt.Sprintf("REPO: remote url is not equal to provided: %s", mount.RepoURL)),
 			util.ErrorFailedCloning,
 			e.logger,
 		)
 	}
 
-	e.logger.PrintDebug(fmt.Sprintf("REPO: pulling changes: %s", e.config.GetRepoBranch()))
-	// We shall ignore error here, as Pull return messages such as "non-fast-forward update" as an error
-	err = workTree.Pull(&git.PullOptions{
-		RemoteName: e.config.GetRepoRemoteName(),
-		Auth:       *auth,
-	})
-	// TODO: Even though the comment just above is true, we should handle this cases in a better way
-	if err != nil {
-		e.logger.PrintDebug(fmt.Sprintf("REPO: pull complete: %s", err.Error()))
+	// Shallow clones only need the new commits objects of our branch
+	if mount.RepoDepth > 0 {
+		e.logger.PrintDebug(fmt.Sprintf("REPO: fetching changes: %s", mount.RepoBranch))
+		err = e.shallowFetch(repo, *auth, mount)
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			e.checkRepoError(err)
+		}
+		e.logger.PrintDebug("REPO: fetch complete")
 	} else {
-		e.logger.PrintDebug("REPO: pull complete")
+		e.logger.PrintDebug(fmt.Sprintf("REPO: pulling changes: %s", mount.RepoBranch))
+		// We shall ignore error here, as Pull return messages such as "non-fast-forward update" as an error
+		err = workTree.Pull(&git.PullOptions{
+			RemoteName:        mount.RepoRemoteName,
+			Auth:              *auth,
+			RecurseSubmodules: git.SubmoduleRescursivity(mount.SubmoduleDepth()),
+		})
+		// TODO: Even though the comment just above is true, we should handle this cases in a better way
+		if err != nil {
+			e.logger.PrintDebug(fmt.Sprintf("REPO: pull complete: %s", err.Error()))
+		} else {
+			e.logger.PrintDebug("REPO: pull complete")
+		}
 	}
 
-	e.logger.PrintDebug(fmt.Sprintf("REPO: checking out: %s", e.config.GetRepoBranch()))
+	e.logger.PrintDebug(fmt.Sprintf("REPO: checking out: %s", mount.RepoBranch))
 	err = workTree.Checkout(&git.CheckoutOptions{
-		Branch: plumbing.ReferenceName(fmt.Sprintf("refs/remotes/%s/%s", e.config.GetRepoRemoteName(), e.config.GetRepoBranch())),
+		Branch: plumbing.ReferenceName(fmt.Sprintf("refs/remotes/%s/%s", mount.RepoRemoteName, mount.RepoBranch)),
 		Create: false,
 		Force:  true,
 	})
 	e.checkRepoError(err)
 }
 
+// mapSubmodulePrefixes moves every key exported from a mapped submodule to its configured
+// Consul KV prefix (relative to the mount one), instead of its path inside the repository
+func (e *exporter) mapSubmodulePrefixes(mount config.Mount, mountData map[string]string) map[string]string {
+	if len(mount.SubmodulePrefixes) == 0 {
+		return mountData
+	}
+
+	// Submodule paths are relative to the repository root, while our keys are relative to the base path
+	basePath := cleanSourcePath(mount.RepoBasePath)
+	prefixes := map[string]string{}
+	for submodule, prefix := range mount.SubmodulePrefixes {
+		submodule = cleanSourcePath(submodule)
+		if basePath != "." {
+			if !strings.HasPrefix(submodule, basePath+"/") {
+				continue
+			}
+			submodule = strings.TrimPrefix(submodule, basePath+"/")
+		}
+		prefixes[submodule] = prefix
+	}
+
+	mapped := map[string]string{}
+	for key, value := range mountData {
+		for submodule, prefix := range prefixes {
+			if key == submodule || strings.HasPrefix(key, submodule+"/") {
+				key = path.Join(prefix, strings.TrimPrefix(key, submodule))
+				break
+			}
+		}
+		mapped[key] = value
+	}
+
+	return mapped
+}
+
 // checkIfRemoteValid ...
-func (e *exporter) checkIfRemoteValid(remotes []*git.Remote) bool {
+func (e *exporter) checkIfRemoteValid(remotes []*git.Remote, repoURL string) bool {
 	// Iterate over remotes
 	for _, remote := range remotes {
 		// Iterate over URLs
 		for _, url := range remote.Config().URLs {
 			// Compare current url with ours
-			if url == e.config.GetRepoURL() {
+			if url == repoURL {
 				return true
 			}
 		}
@@ -0,0 +1,126 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/capability"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/sideband"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// shallowFetch incrementally fetches our branch into a shallow repository. go-git regular
+// fetch walks the local history to negotiate with the remote, which fails as soon as it
+// reaches the shallow boundary, so we negotiate with our branch tip only
+func (e *exporter) shallowFetch(repo *git.Repository, auth transport.AuthMethod, mount config.Mount) error {
+	remote, err := repo.Remote(mount.RepoRemoteName)
+	if err != nil {
+		return err
+	}
+
+	endpoint, err := transport.NewEndpoint(remote.Config().URLs[0])
+	if err != nil {
+		return err
+	}
+
+	gitClient, err := client.NewClient(endpoint)
+	if err != nil {
+		return err
+	}
+
+	session, err := gitClient.NewUploadPackSession(endpoint, auth)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = session.Close() }()
+
+	advertised, err := session.AdvertisedReferences()
+	if err != nil {
+		return err
+	}
+
+	remoteRefs, err := advertised.AllReferences()
+	if err != nil {
+		return err
+	}
+
+	branch, ok := remoteRefs[plumbing.ReferenceName("refs/heads/"+mount.RepoBranch)]
+	if !ok {
+		return errors.New(fmt.Sprintf("remote branch not found: %s", mount.RepoBranch))
+	}
+
+	// Nothing to do if we already have our branch tip
+	localName := plumbing.ReferenceName(fmt.Sprintf("refs/remotes/%s/%s", mount.RepoRemoteName, mount.RepoBranch))
+	local, err := repo.Reference(localName, true)
+	if err == nil && local.Hash() == branch.Hash() {
+		return git.NoErrAlreadyUpToDate
+	}
+
+	request := packp.NewUploadPackRequestFromCapabilities(advertised.Capabilities)
+	request.Wants = []plumbing.Hash{branch.Hash()}
+	request.Depth = packp.DepthCommits(mount.RepoDepth)
+	if err := request.Capabilities.Set(capability.Shallow); err != nil {
+		return err
+	}
+	if advertised.Capabilities.Supports(capability.NoProgress) {
+		_ = request.Capabilities.Set(capability.NoProgress)
+	}
+	if local != nil {
+		request.Haves = []plumbing.Hash{local.Hash()}
+	}
+	if request.Shallows, err = repo.Storer.Shallow(); err != nil {
+		return err
+	}
+
+	response, err := session.UploadPack(context.Background(), request)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = response.Close() }()
+
+	// Store the new objects, our new shallow boundary and finally our updated branch
+	var pack io.Reader = response
+	if request.Capabilities.Supports(capability.Sideband64k) {
+		pack = sideband.NewDemuxer(sideband.Sideband64k, response)
+	} else if request.Capabilities.Supports(capability.Sideband) {
+		pack = sideband.NewDemuxer(sideband.Sideband, response)
+	}
+	if err := packfile.UpdateObjectStorage(repo.Storer, pack); err != nil {
+		return err
+	}
+
+	if len(response.Shallows) > 0 || len(response.Unshallows) > 0 {
+		if err := repo.Storer.SetShallow(updateShallows(request.Shallows, response.ShallowUpdate)); err != nil {
+			return err
+		}
+	}
+
+	return repo.Storer.SetReference(plumbing.NewHashReference(localName, branch.Hash()))
+}
+
+// updateShallows returns our new shallow boundary. Fetching deeper than our boundary moves it,
+// so the remote tells us the commits that are no longer shallow as well as the new ones
+func updateShallows(shallows []plumbing.Hash, update packp.ShallowUpdate) []plumbing.Hash {
+	unshallows := map[plumbing.Hash]bool{}
+	for _, hash := range update.Unshallows {
+		unshallows[hash] = true
+	}
+
+	updated := []plumbing.Hash{}
+	for _, hash := range append(shallows, update.Shallows...) {
+		if !unshallows[hash] {
+			updated = append(updated, hash)
+		}
+	}
+
+	return updated
+}
@@ -0,0 +1,142 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+	"github.com/miniclip/gonsul/internal/util"
+
+	. "github.com/onsi/gomega"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestMapSubmodulePrefixes(t *testing.T) {
+	RegisterTestingT(t)
+
+	e := &exporter{}
+	mount := config.Mount{
+		RepoBasePath: "/config",
+		SubmodulePrefixes: map[string]string{
+			"config/vendor/shared": "shared",
+			"outside/base":         "ignored",
+		},
+	}
+	mountData := map[string]string{
+		"app1/config":              "1",
+		"vendor/shared/db/host":    "2",
+		"vendor/shared-other/host": "3",
+	}
+
+	Expect(e.mapSubmodulePrefixes(mount, mountData)).To(Equal(map[string]string{
+		"app1/config":              "1",
+		"shared/db/host":           "2",
+		"vendor/shared-other/host": "3",
+	}))
+}
+
+func TestShallowFetch(t *testing.T) {
+	RegisterTestingT(t)
+
+	upstreamDir, err := ioutil.TempDir("", "gonsul-upstream")
+	Expect(err).To(BeNil())
+	defer os.RemoveAll(upstreamDir)
+	cloneDir, err := ioutil.TempDir("", "gonsul-clone")
+	Expect(err).To(BeNil())
+	defer os.RemoveAll(cloneDir)
+
+	upstream, err := git.PlainInit(upstreamDir, false)
+	Expect(err).To(BeNil())
+	commitFile(upstream, upstreamDir, "config/app.json", `{"version": 1}`, "First")
+	commitFile(upstream, upstreamDir, "config/app.json", `{"version": 2}`, "Second")
+
+	repo, err := git.PlainClone(cloneDir, false, &git.CloneOptions{
+		URL:           "file://" + upstreamDir,
+		ReferenceName: plumbing.ReferenceName("refs/heads/master"),
+		SingleBranch:  true,
+		Depth:         1,
+		NoCheckout:    true,
+	})
+	Expect(err).To(BeNil())
+
+	e := &exporter{logger: util.NewLogger(0)}
+	mount := config.Mount{RepoRemoteName: "origin", RepoBranch: "master", RepoDepth: 1}
+
+	// Nothing is fetched while our branch tip is the remote one
+	Expect(e.shallowFetch(repo, nil, mount)).To(Equal(git.NoErrAlreadyUpToDate))
+
+	// New commits are fetched from our branch tip, within our depth
+	commitFile(upstream, upstreamDir, "config/app.json", `{"version": 3}`, "Third")
+	head := commitFile(upstream, upstreamDir, "config/app.json", `{"version": 4}`, "Fourth")
+	Expect(e.shallowFetch(repo, nil, mount)).To(Succeed())
+
+	branch, err := repo.Reference(plumbing.ReferenceName("refs/remotes/origin/master"), true)
+	Expect(err).To(BeNil())
+	Expect(branch.Hash()).To(Equal(head))
+	commit, err := repo.CommitObject(head)
+	Expect(err).To(BeNil())
+	file, err := commit.File("config/app.json")
+	Expect(err).To(BeNil())
+	Expect(file.Contents()).To(Equal(`{"version": 4}`))
+
+	shallows, err := repo.Storer.Shallow()
+	Expect(err).To(BeNil())
+	Expect(shallows).To(ContainElement(head), "Assert our new shallow boundary is kept")
+
+	// Unknown branches are reported
+	mount.RepoBranch = "missing"
+	Expect(e.shallowFetch(repo, nil, mount)).To(MatchError("remote branch not found: missing"))
+}
+
+func TestShallowFetch_Deepen(t *testing.T) {
+	RegisterTestingT(t)
+
+	upstreamDir, err := ioutil.TempDir("", "gonsul-upstream")
+	Expect(err).To(BeNil())
+	defer os.RemoveAll(upstreamDir)
+	cloneDir, err := ioutil.TempDir("", "gonsul-clone")
+	Expect(err).To(BeNil())
+	defer os.RemoveAll(cloneDir)
+
+	upstream, err := git.PlainInit(upstreamDir, false)
+	Expect(err).To(BeNil())
+	commitFile(upstream, upstreamDir, "config/app.json", `{"version": 1}`, "First")
+	second := commitFile(upstream, upstreamDir, "config/app.json", `{"version": 2}`, "Second")
+	commitFile(upstream, upstreamDir, "config/app.json", `{"version": 3}`, "Third")
+
+	repo, err := git.PlainClone(cloneDir, false, &git.CloneOptions{
+		URL:           "file://" + upstreamDir,
+		ReferenceName: plumbing.ReferenceName("refs/heads/master"),
+		SingleBranch:  true,
+		Depth:         1,
+		NoCheckout:    true,
+	})
+	Expect(err).To(BeNil())
+
+	// Fetching deeper than our first clone moves our shallow boundary to older commits
+	commitFile(upstream, upstreamDir, "config/app.json", `{"version": 4}`, "Fourth")
+	e := &exporter{logger: util.NewLogger(0)}
+	mount := config.Mount{RepoRemoteName: "origin", RepoBranch: "master", RepoDepth: 3}
+	Expect(e.shallowFetch(repo, nil, mount)).To(Succeed())
+
+	shallows, err := repo.Storer.Shallow()
+	Expect(err).To(BeNil())
+	Expect(shallows).To(Equal([]plumbing.Hash{second}), "Assert commits unshallowed by the remote leave our boundary")
+	_, err = repo.CommitObject(second)
+	Expect(err).To(BeNil())
+}
+
+func TestUpdateShallows(t *testing.T) {
+	RegisterTestingT(t)
+
+	first := plumbing.NewHash("1111111111111111111111111111111111111111")
+	second := plumbing.NewHash("2222222222222222222222222222222222222222")
+	third := plumbing.NewHash("3333333333333333333333333333333333333333")
+
+	update := packp.ShallowUpdate{Shallows: []plumbing.Hash{third}, Unshallows: []plumbing.Hash{first}}
+	Expect(updateShallows([]plumbing.Hash{first, second}, update)).To(Equal([]plumbing.Hash{second, third}))
+	Expect(updateShallows(nil, packp.ShallowUpdate{Unshallows: []plumbing.Hash{first}})).To(BeEmpty())
+}
@@ -0,0 +1,515 @@
+package exporter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSchemaRefs is how many $ref a schema may follow without going any deeper in a document,
+// a schema referencing itself that way would never end
+const maxSchemaRefs = 64
+
+// schema is a JSON Schema, as read from a schema file. It supports the validation keywords of the
+// drafts 4 to 7, while annotations (title, format...) and remote $ref are ignored
+type schema struct {
+	root     interface{}
+	patterns map[string]*regexp.Regexp
+}
+
+// schemaCheck is the state of a single document validation against a schema
+type schemaCheck struct {
+	schema     *schema
+	violations []string
+}
+
+// newSchema decodes a JSON Schema file
+func newSchema(content string) (*schema, error) {
+	var root interface{}
+	decoder := json.NewDecoder(strings.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&root); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("invalid data after top-level value")
+	}
+	switch root.(type) {
+	case map[string]interface{}, bool:
+	default:
+		return nil, errors.New("a schema must be an object or a boolean")
+	}
+
+	return &schema{root: root, patterns: map[string]*regexp.Regexp{}}, nil
+}
+
+// validate returns every violation of the given document, each one prefixed by the JSON pointer of the offending value
+func (s *schema) validate(document interface{}) []string {
+	check := &schemaCheck{schema: s}
+	check.value(s.root, document, "", 0)
+
+	return check.violations
+}
+
+// valid tells if a document is valid against a sub schema, without reporting anything
+func (c *schemaCheck) valid(node interface{}, value interface{}, pointer string, refs int) bool {
+	sub := &schemaCheck{schema: c.schema}
+	sub.value(node, value, pointer, refs)
+
+	return len(sub.violations) == 0
+}
+
+// fail reports a violation at the given JSON pointer
+func (c *schemaCheck) fail(pointer string, message string, args ...interface{}) {
+	if pointer == "" {
+		pointer = "/"
+	}
+	c.violations = append(c.violations, pointer+": "+fmt.Sprintf(message, args...))
+}
+
+// value validates a value against a (sub) schema
+func (c *schemaCheck) value(node interface{}, value interface{}, pointer string, refs int) {
+	switch node.(type) {
+	case bool:
+		if !node.(bool) {
+			c.fail(pointer, "no value is allowed here")
+		}
+		return
+	case map[string]interface{}:
+	default:
+		c.fail(pointer, "invalid schema, must be an object or a boolean")
+		return
+	}
+	keywords := node.(map[string]interface{})
+
+	if ref, ok := keywords["$ref"].(string); ok {
+		c.ref(ref, value, pointer, refs)
+	}
+
+	if types, ok := keywords["type"]; ok && !matchesType(types, value) {
+		c.fail(pointer, "must be of type %s, got %s", describeTypes(types), typeOf(value))
+		// Nothing else can be checked on a value of the wrong type
+		return
+	}
+	if enum, ok := keywords["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			found = found || jsonEqual(allowed, value)
+		}
+		if !found {
+			c.fail(pointer, "must be one of %s", encodeSchemaValue(enum))
+		}
+	}
+	if constant, ok := keywords["const"]; ok && !jsonEqual(constant, value) {
+		c.fail(pointer, "must be %s", encodeSchemaValue(constant))
+	}
+
+	c.combinators(keywords, value, pointer, refs)
+
+	switch value.(type) {
+	case map[string]interface{}:
+		c.object(keywords, value.(map[string]interface{}), pointer, refs)
+	case []interface{}:
+		c.array(keywords, value.([]interface{}), pointer, refs)
+	case string:
+		c.string(keywords, value.(string), pointer)
+	default:
+		if number, ok := toRat(value); ok {
+			c.number(keywords, number, pointer)
+		}
+	}
+}
+
+// ref follows a $ref, only references inside the schema itself are supported
+func (c *schemaCheck) ref(ref string, value interface{}, pointer string, refs int) {
+	if refs >= maxSchemaRefs {
+		c.fail(pointer, "too many nested $ref (%s)", ref)
+		return
+	}
+	if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		c.fail(pointer, "unsupported $ref (%s), only references inside the schema are", ref)
+		return
+	}
+
+	node := c.schema.root
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#"), "/")[1:] {
+		if unescaped, err := url.PathUnescape(token); err == nil {
+			token = unescaped
+		}
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+
+		switch node.(type) {
+		case map[string]interface{}:
+			node = node.(map[string]interface{})[token]
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(node.([]interface{})) {
+				node = nil
+			} else {
+				node = node.([]interface{})[index]
+			}
+		default:
+			node = nil
+		}
+		if node == nil {
+			c.fail(pointer, "invalid $ref (%s), not found", ref)
+			return
+		}
+	}
+
+	c.value(node, value, pointer, refs+1)
+}
+
+// combinators validates the schemas combining sub schemas
+func (c *schemaCheck) combinators(keywords map[string]interface{}, value interface{}, pointer string, refs int) {
+	if allOf, ok := keywords["allOf"].([]interface{}); ok {
+		for _, sub := range allOf {
+			c.value(sub, value, pointer, refs)
+		}
+	}
+	if anyOf, ok := keywords["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, sub := range anyOf {
+			matched = matched || c.valid(sub, value, pointer, refs)
+		}
+		if !matched {
+			c.fail(pointer, "must match at least one of the anyOf schemas")
+		}
+	}
+	if oneOf, ok := keywords["oneOf"].([]interface{}); ok {
+		matched := 0
+		for _, sub := range oneOf {
+			if c.valid(sub, value, pointer, refs) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			c.fail(pointer, "must match exactly one of the oneOf schemas, matches %d", matched)
+		}
+	}
+	if not, ok := keywords["not"]; ok && c.valid(not, value, pointer, refs) {
+		c.fail(pointer, "must not match the not schema")
+	}
+	if condition, ok := keywords["if"]; ok {
+		if c.valid(condition, value, pointer, refs) {
+			if then, ok := keywords["then"]; ok {
+				c.value(then, value, pointer, refs)
+			}
+		} else if otherwise, ok := keywords["else"]; ok {
+			c.value(otherwise, value, pointer, refs)
+		}
+	}
+}
+
+// object validates the object keywords
+func (c *schemaCheck) object(keywords map[string]interface{}, object map[string]interface{}, pointer string, refs int) {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if required, ok := keywords["required"].([]interface{}); ok {
+		for _, name := range required {
+			if _, ok := object[fmt.Sprint(name)]; !ok {
+				c.fail(pointer, "missing required property %s", name)
+			}
+		}
+	}
+	if limit, ok := schemaInt(keywords["minProperties"]); ok && len(object) < limit {
+		c.fail(pointer, "must have at least %d properties", limit)
+	}
+	if limit, ok := schemaInt(keywords["maxProperties"]); ok && len(object) > limit {
+		c.fail(pointer, "must have at most %d properties", limit)
+	}
+
+	properties, _ := keywords["properties"].(map[string]interface{})
+	patternProperties, _ := keywords["patternProperties"].(map[string]interface{})
+	additional, hasAdditional := keywords["additionalProperties"]
+	dependencies, _ := keywords["dependencies"].(map[string]interface{})
+	dependentRequired, _ := keywords["dependentRequired"].(map[string]interface{})
+	propertyNames, hasPropertyNames := keywords["propertyNames"]
+
+	for _, key := range keys {
+		child := object[key]
+		childPointer := pointer + "/" + strings.Replace(strings.Replace(key, "~", "~0", -1), "/", "~1", -1)
+
+		if hasPropertyNames && !c.valid(propertyNames, key, childPointer, refs) {
+			c.fail(childPointer, "property name does not match the propertyNames schema")
+		}
+
+		matched := false
+		if sub, ok := properties[key]; ok {
+			matched = true
+			c.value(sub, child, childPointer, refs)
+		}
+		for pattern, sub := range patternProperties {
+			if re := c.schema.regexp(pattern); re != nil && re.MatchString(key) {
+				matched = true
+				c.value(sub, child, childPointer, refs)
+			}
+		}
+		if !matched && hasAdditional {
+			if allowed, ok := additional.(bool); ok && !allowed {
+				c.fail(childPointer, "additional property %s is not allowed", key)
+			} else {
+				c.value(additional, child, childPointer, refs)
+			}
+		}
+
+		// Dependencies are either a list of required properties, or a schema the whole object must match
+		for _, dependency := range []interface{}{dependencies[key], dependentRequired[key]} {
+			switch dependency.(type) {
+			case []interface{}:
+				for _, name := range dependency.([]interface{}) {
+					if _, ok := object[fmt.Sprint(name)]; !ok {
+						c.fail(pointer, "missing property %s, required by %s", name, key)
+					}
+				}
+			case map[string]interface{}, bool:
+				c.value(dependency, object, pointer, refs)
+			}
+		}
+	}
+}
+
+// array validates the array keywords
+func (c *schemaCheck) array(keywords map[string]interface{}, array []interface{}, pointer string, refs int) {
+	if limit, ok := schemaInt(keywords["minItems"]); ok && len(array) < limit {
+		c.fail(pointer, "must have at least %d items", limit)
+	}
+	if limit, ok := schemaInt(keywords["maxItems"]); ok && len(array) > limit {
+		c.fail(pointer, "must have at most %d items", limit)
+	}
+	if unique, _ := keywords["uniqueItems"].(bool); unique {
+		for i := range array {
+			for j := i + 1; j < len(array); j++ {
+				if jsonEqual(array[i], array[j]) {
+					c.fail(pointer, "items %d and %d must be unique", i, j)
+				}
+			}
+		}
+	}
+
+	for index, item := range array {
+		itemPointer := pointer + "/" + strconv.Itoa(index)
+		switch items := keywords["items"].(type) {
+		case []interface{}:
+			// Tuple validation, items past the listed ones follow additionalItems
+			if index < len(items) {
+				c.value(items[index], item, itemPointer, refs)
+			} else if additional, ok := keywords["additionalItems"]; ok {
+				if allowed, ok := additional.(bool); ok && !allowed {
+					c.fail(itemPointer, "additional item is not allowed")
+				} else {
+					c.value(additional, item, itemPointer, refs)
+				}
+			}
+		case map[string]interface{}, bool:
+			c.value(items, item, itemPointer, refs)
+		}
+	}
+
+	if contains, ok := keywords["contains"]; ok {
+		found := false
+		for index, item := range array {
+			found = found || c.valid(contains, item, pointer+"/"+strconv.Itoa(index), refs)
+		}
+		if !found {
+			c.fail(pointer, "must contain an item matching the contains schema")
+		}
+	}
+}
+
+// string validates the string keywords
+func (c *schemaCheck) string(keywords map[string]interface{}, value string, pointer string) {
+	length := utf8.RuneCountInString(value)
+	if limit, ok := schemaInt(keywords["minLength"]); ok && length < limit {
+		c.fail(pointer, "must be at least %d characters long", limit)
+	}
+	if limit, ok := schemaInt(keywords["maxLength"]); ok && length > limit {
+		c.fail(pointer, "must be at most %d characters long", limit)
+	}
+	if pattern, ok := keywords["pattern"].(string); ok {
+		if re := c.schema.regexp(pattern); re == nil {
+			c.fail(pointer, "invalid schema pattern %s", pattern)
+		} else if !re.MatchString(value) {
+			c.fail(pointer, "must match pattern %s", pattern)
+		}
+	}
+}
+
+// number validates the numeric keywords, numbers being compared exactly
+func (c *schemaCheck) number(keywords map[string]interface{}, value *big.Rat, pointer string) {
+	// Draft 4 exclusive limits are booleans changing the minimum/maximum ones
+	exclusiveMinimum, _ := keywords["exclusiveMinimum"].(bool)
+	exclusiveMaximum, _ := keywords["exclusiveMaximum"].(bool)
+
+	if limit, ok := toRat(keywords["minimum"]); ok {
+		if exclusiveMinimum && value.Cmp(limit) <= 0 {
+			c.fail(pointer, "must be > %s", limit.RatString())
+		} else if value.Cmp(limit) < 0 {
+			c.fail(pointer, "must be >= %s", limit.RatString())
+		}
+	}
+	if limit, ok := toRat(keywords["maximum"]); ok {
+		if exclusiveMaximum && value.Cmp(limit) >= 0 {
+			c.fail(pointer, "must be < %s", limit.RatString())
+		} else if value.Cmp(limit) > 0 {
+			c.fail(pointer, "must be <= %s", limit.RatString())
+		}
+	}
+	if limit, ok := toRat(keywords["exclusiveMinimum"]); ok && value.Cmp(limit) <= 0 {
+		c.fail(pointer, "must be > %s", limit.RatString())
+	}
+	if limit, ok := toRat(keywords["exclusiveMaximum"]); ok && value.Cmp(limit) >= 0 {
+		c.fail(pointer, "must be < %s", limit.RatString())
+	}
+	if divisor, ok := toRat(keywords["multipleOf"]); ok && divisor.Sign() > 0 {
+		if !new(big.Rat).Quo(value, divisor).IsInt() {
+			c.fail(pointer, "must be a multiple of %s", divisor.RatString())
+		}
+	}
+}
+
+// regexp compiles (once) a schema pattern, nil if it's not a valid one
+func (s *schema) regexp(pattern string) *regexp.Regexp {
+	if re, ok := s.patterns[pattern]; ok {
+		return re
+	}
+	re, _ := regexp.Compile(pattern)
+	s.patterns[pattern] = re
+
+	return re
+}
+
+// toRat returns the exact value of a number, whatever the format it was decoded from
+func toRat(value interface{}) (*big.Rat, bool) {
+	switch value.(type) {
+	case json.Number:
+		return new(big.Rat).SetString(value.(json.Number).String())
+	case int, int64, uint64:
+		return new(big.Rat).SetString(fmt.Sprint(value))
+	case float64:
+		rat := new(big.Rat).SetFloat64(value.(float64))
+		return rat, rat != nil
+	}
+
+	return nil, false
+}
+
+// schemaInt returns the value of a schema non negative integer keyword
+func schemaInt(value interface{}) (int, bool) {
+	if number, ok := toRat(value); ok && number.IsInt() && number.Sign() >= 0 {
+		return int(number.Num().Int64()), true
+	}
+
+	return 0, false
+}
+
+// typeOf returns the JSON Schema type of a value
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	if number, ok := toRat(value); ok {
+		if number.IsInt() {
+			return "integer"
+		}
+		return "number"
+	}
+
+	return fmt.Sprintf("%T", value)
+}
+
+// matchesType tells if a value is of the given type, or one of the given types
+func matchesType(types interface{}, value interface{}) bool {
+	actual := typeOf(value)
+	names := []interface{}{types}
+	if list, ok := types.([]interface{}); ok {
+		names = list
+	}
+	for _, name := range names {
+		if name == actual || (name == "number" && actual == "integer") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// describeTypes returns the type, or types, of a type keyword
+func describeTypes(types interface{}) string {
+	if list, ok := types.([]interface{}); ok {
+		names := make([]string, 0, len(list))
+		for _, name := range list {
+			names = append(names, fmt.Sprint(name))
+		}
+		return strings.Join(names, " or ")
+	}
+
+	return fmt.Sprint(types)
+}
+
+// jsonEqual tells if two values are the same JSON value, numbers being compared by their value
+func jsonEqual(a interface{}, b interface{}) bool {
+	if aNumber, ok := toRat(a); ok {
+		bNumber, ok := toRat(b)
+		return ok && aNumber.Cmp(bNumber) == 0
+	}
+
+	switch a.(type) {
+	case map[string]interface{}:
+		bObject, ok := b.(map[string]interface{})
+		if !ok || len(bObject) != len(a.(map[string]interface{})) {
+			return false
+		}
+		for key, child := range a.(map[string]interface{}) {
+			if bChild, ok := bObject[key]; !ok || !jsonEqual(child, bChild) {
+				return false
+			}
+		}
+		return true
+
+	case []interface{}:
+		bArray, ok := b.([]interface{})
+		if !ok || len(bArray) != len(a.([]interface{})) {
+			return false
+		}
+		for index, child := range a.([]interface{}) {
+			if !jsonEqual(child, bArray[index]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return a == b
+}
+
+// encodeSchemaValue writes a schema value in violation messages
+func encodeSchemaValue(value interface{}) string {
+	encoded, err := marshalJSON(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+
+	return encoded
+}
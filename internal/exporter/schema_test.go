@@ -0,0 +1,61 @@
+package exporter
+
+import (
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	RegisterTestingT(t)
+
+	s, err := newSchema(`{
+		"type": "object",
+		"required": ["name", "db"],
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string", "pattern": "^[a-z]+$", "maxLength": 8},
+			"db": {"$ref": "#/definitions/db"},
+			"hosts": {"type": "array", "items": {"type": "string"}, "minItems": 1, "uniqueItems": true},
+			"mode": {"enum": ["a", "b"]},
+			"ratio": {"type": "number", "exclusiveMaximum": 1, "multipleOf": 0.25}
+		},
+		"definitions": {
+			"db": {
+				"type": "object",
+				"properties": {"port": {"type": "integer", "minimum": 1, "maximum": 65535}},
+				"oneOf": [{"required": ["host"]}, {"required": ["socket"]}]
+			}
+		}
+	}`)
+	Expect(err).To(BeNil())
+
+	valid, _, err := yamlFormat{}.Decode("name: web\ndb: {host: db, port: 5432}\nhosts: [a, b]\nmode: a\nratio: 0.50\n")
+	Expect(err).To(BeNil())
+	Expect(s.validate(valid)).To(BeEmpty())
+
+	invalid, _, err := jsonFormat{}.Decode(`{"name": "Web", "db": {"port": 70000.0, "host": "a", "socket": "b"}, "hosts": ["a", "a"], "ratio": 1, "extra": true}`)
+	Expect(err).To(BeNil())
+	Expect(s.validate(invalid)).To(ConsistOf(
+		"/db: must match exactly one of the oneOf schemas, matches 2",
+		"/db/port: must be <= 65535",
+		"/extra: additional property extra is not allowed",
+		"/hosts: items 0 and 1 must be unique",
+		"/name: must match pattern ^[a-z]+$",
+		"/ratio: must be < 1",
+	), "Assert every violation is reported")
+
+	missing, _, _ := tomlFormat{}.Decode("name = 1\n")
+	Expect(s.validate(missing)).To(ConsistOf(
+		"/: missing required property db",
+		"/name: must be of type string, got integer",
+	))
+
+	// Schemas referencing themselves forever are stopped
+	s, err = newSchema(`{"$ref": "#"}`)
+	Expect(err).To(BeNil())
+	Expect(s.validate(map[string]interface{}{})).To(HaveLen(1))
+
+	_, err = newSchema(`[]`)
+	Expect(err).To(Not(BeNil()))
+}
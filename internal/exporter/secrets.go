@@ -0,0 +1,98 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+	"github.com/miniclip/gonsul/internal/util"
+
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+// mountSources reads secret files from every mount, as in any of them
+type mountSources []ISource
+
+// shouldRenderSecrets tells if our secret placeholders are replaced on files, before parsing them
+func (e *exporter) shouldRenderSecrets() bool {
+	return e.config.DoSecrets() && e.config.GetSecretsStage() == config.SecretsStageExport
+}
+
+// renderSecrets replaces the secret placeholders of a file, escaping secrets for the file format
+// so they can't break its document. It tells whether the file could be rendered at all
+func (e *exporter) renderSecrets(filePath string, content string) (string, bool) {
+	secrets := e.config.GetSecrets()
+
+	// Our references are not mustache placeholders, they're resolved later on
+	restore := func(rendered string) string { return rendered }
+	if e.config.DoReferences() {
+		content, restore = protectReferences(content)
+	}
+	// Our rendered files are kept to find the secrets none of them use, if we're strict about it
+	if e.config.IsSecretsStrict() {
+		e.files = append(e.files, content)
+	}
+
+	// Placeholders we can't replace would be written empty, unless we're strict about it
+	if e.config.IsSecretsStrict() || e.config.IsValidating() {
+		missing, err := secrets.Missing(content)
+		for _, name := range missing {
+			e.addError(util.ErrorFailedMustache, fmt.Sprintf("EXPORTER: %s: unknown secret placeholder: %s", filePath, name))
+		}
+		if err == nil && len(missing) > 0 {
+			return "", false
+		}
+	}
+
+	// Structured files get their secrets escaped for wherever their placeholder is
+	var escape func(int, string) (string, error)
+	if format := findFormat(filepath.Ext(filePath)); format != nil {
+		escape = func(offset int, secret string) (string, error) {
+			return format.Escape(content, offset, secret)
+		}
+	}
+
+	rendered, err := secrets.RenderEscaped(content, escape)
+	if err != nil {
+		e.addError(util.ErrorFailedMustache, fmt.Sprintf("EXPORTER: %s: could not render secrets: %s", filePath, err.Error()))
+		return "", false
+	}
+
+	return restore(rendered), true
+}
+
+// checkUnusedSecrets reports the secrets none of our files refer to, if we're strict about it
+func (e *exporter) checkUnusedSecrets() {
+	if !e.shouldRenderSecrets() || !e.config.IsSecretsStrict() {
+		return
+	}
+
+	for _, name := range e.config.GetSecrets().Unused(e.files) {
+		e.addError(util.ErrorFailedMustache, fmt.Sprintf("EXPORTER: unused secret: %s", name))
+	}
+}
+
+// ReadFile reads the given file from the one mount that has it, refusing files on more than one
+func (m mountSources) ReadFile(name string) ([]byte, error) {
+	var content []byte
+	found := false
+	for _, source := range m {
+		mountContent, err := source.ReadFile(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			return nil, errors.New(fmt.Sprintf("%s is on more than one mount", name))
+		}
+		content, found = mountContent, true
+	}
+
+	if !found {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return content, nil
+}
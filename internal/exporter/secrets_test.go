@@ -0,0 +1,90 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+	"github.com/miniclip/gonsul/internal/secrets"
+	"github.com/miniclip/gonsul/internal/util"
+	"github.com/miniclip/gonsul/tests/mocks"
+
+	. "github.com/onsi/gomega"
+
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+// secretsConfig is the configuration rendering secrets on files depends on
+func secretsConfig(values secrets.ISecrets, strict bool) *mocks.IConfig {
+	cfg := &mocks.IConfig{}
+	cfg.On("DoSecrets").Return(true)
+	cfg.On("GetSecretsStage").Return(config.SecretsStageExport)
+	cfg.On("GetSecrets").Return(values)
+	cfg.On("IsSecretsStrict").Return(strict)
+	cfg.On("IsValidating").Return(false)
+
+	return exportDefaults(cfg)
+}
+
+func TestParseDirRendersSecrets(t *testing.T) {
+	RegisterTestingT(t)
+
+	values := map[string]string{"db.prod.password": `p"a\ss`, "db.prod.user": "admin", "unused": "x"}
+	memory := newMemSource()
+	memory.addFile("app/db.yaml", []byte("user: {{db.prod.user}}\npassword: \"{{db.prod.password}}\"\n"))
+	memory.addFile("app/conf.json", []byte(`{"password": "{{db.prod.password}}"}`))
+	memory.addFile("app/raw.txt", []byte(`{{{db.prod.password}}}`))
+
+	// Secrets are escaped for each file format, so expanded keys get the actual secret
+	e := &exporter{config: secretsConfig(secrets.NewSecrets(values, nil), false), logger: util.NewLogger(0)}
+	localData := map[string]string{}
+	e.parseDir(memory, ".", localData)
+	Expect(e.errors).To(BeEmpty())
+	Expect(localData).To(Equal(map[string]string{
+		"app/db/user":     "admin",
+		"app/db/password": `p"a\ss`,
+		"app/conf":        `{"password": "p\"a\\ss"}`,
+		"app/raw":         `p"a\ss`,
+	}))
+
+	// Secrets that can't be written where their placeholder is are refused, instead of changed
+	broken := newMemSource()
+	broken.addFile("app/plain.yaml", []byte("password: {{db.prod.password}}\n"))
+	broken.addFile("app/bare.json", []byte(`{"user": "{{db.prod.user}}", "password": {{db.prod.password}}}`))
+	brokenValues := map[string]string{"db.prod.password": "it's # not a comment", "db.prod.user": "admin"}
+	e = &exporter{config: secretsConfig(secrets.NewSecrets(brokenValues, nil), false), logger: util.NewLogger(0)}
+	e.parseDir(broken, ".", map[string]string{})
+	Expect(e.errors).To(HaveLen(2))
+	Expect(e.errors[0].message).To(ContainSubstring("app/bare.json: could not render secrets: secret db.prod.password: can't be written unquoted"))
+	Expect(e.errors[1].message).To(ContainSubstring("app/plain.yaml: could not render secrets: secret db.prod.password: can't be written in a plain scalar"))
+
+	// Strictly, unknown placeholders and unused secrets are reported per file
+	memory.addFile("app/typo.json", []byte(`{"password": "{{db.prod.pasword}}"}`))
+	e = &exporter{config: secretsConfig(secrets.NewSecrets(values, nil), true), logger: util.NewLogger(0)}
+	e.parseDir(memory, ".", map[string]string{})
+	e.checkUnusedSecrets()
+	Expect(e.errors).To(HaveLen(2))
+	Expect(e.errors[0].message).To(Equal("EXPORTER: app/typo.json: unknown secret placeholder: db.prod.pasword"))
+	Expect(e.errors[1].message).To(Equal("EXPORTER: unused secret: unused"))
+	Expect(e.exitOnErrors).To(PanicWith(util.GonsulError{Code: util.ErrorFailedMustache}))
+}
+
+func TestMountSources(t *testing.T) {
+	RegisterTestingT(t)
+
+	first, second := newMemSource(), newMemSource()
+	first.addFile("secrets/app.yaml", []byte("first"))
+	second.addFile("secrets/db.yaml", []byte("second"))
+	sources := mountSources{first, second}
+
+	// Secret files are read from the one mount having them
+	content, err := sources.ReadFile("secrets/db.yaml")
+	Expect(err).To(BeNil())
+	Expect(string(content)).To(Equal("second"))
+	_, err = sources.ReadFile("secrets/other.yaml")
+	Expect(errors.Is(err, fs.ErrNotExist)).To(BeTrue())
+
+	// Files on more than one mount are ambiguous
+	second.addFile("secrets/app.yaml", []byte("other"))
+	_, err = sources.ReadFile("secrets/app.yaml")
+	Expect(err).To(MatchError("secrets/app.yaml is on more than one mount"))
+}
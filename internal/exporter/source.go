@@ -0,0 +1,146 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/entities"
+
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ISource is a read only file tree the exporter parses. Paths are always slash separated
+// and relative to the source root, "." being the root itself
+type ISource interface {
+	ReadDir(dir string) ([]entities.SourceEntry, error)
+	ReadFile(name string) ([]byte, error)
+}
+
+// fsSource is our ISource implementation on top of any fs.FS
+type fsSource struct {
+	fsys fs.FS
+}
+
+// NewFSSource creates a source reading from the given fs.FS
+func NewFSSource(fsys fs.FS) ISource {
+	return &fsSource{fsys: fsys}
+}
+
+// newDirSource creates a source reading from a local file system directory
+func newDirSource(directory string) ISource {
+	return NewFSSource(os.DirFS(directory))
+}
+
+// ReadDir ...
+func (s *fsSource) ReadDir(dir string) ([]entities.SourceEntry, error) {
+	files, err := fs.ReadDir(s.fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []entities.SourceEntry
+	for _, file := range files {
+		entries = append(entries, entities.SourceEntry{Name: file.Name(), IsDir: file.IsDir()})
+	}
+
+	return entries, nil
+}
+
+// ReadFile ...
+func (s *fsSource) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(s.fsys, name)
+}
+
+// memSource is an in memory ISource, used for sources that have to be fully loaded
+// before we can walk them (such as a tar stream)
+type memSource struct {
+	files map[string][]byte
+	dirs  map[string]map[string]bool
+}
+
+// newMemSource creates an empty in memory source
+func newMemSource() *memSource {
+	return &memSource{
+		files: map[string][]byte{},
+		dirs:  map[string]map[string]bool{".": {}},
+	}
+}
+
+// addFile adds a file (and all its parent directories) to our in memory source
+func (s *memSource) addFile(name string, content []byte) {
+	name = cleanSourcePath(name)
+	s.files[name] = content
+
+	// Register the file and every parent directory on its parent listing
+	for child := name; child != "."; child = path.Dir(child) {
+		parent := path.Dir(child)
+		if _, ok := s.dirs[parent]; !ok {
+			s.dirs[parent] = map[string]bool{}
+		}
+		_, isFile := s.files[child]
+		s.dirs[parent][path.Base(child)] = !isFile
+	}
+}
+
+// ReadDir ...
+func (s *memSource) ReadDir(dir string) ([]entities.SourceEntry, error) {
+	children, ok := s.dirs[cleanSourcePath(dir)]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: dir, Err: fs.ErrNotExist}
+	}
+
+	var entries []entities.SourceEntry
+	for name, isDir := range children {
+		entries = append(entries, entities.SourceEntry{Name: name, IsDir: isDir})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	return entries, nil
+}
+
+// ReadFile ...
+func (s *memSource) ReadFile(name string) ([]byte, error) {
+	content, ok := s.files[cleanSourcePath(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return content, nil
+}
+
+// subSource restricts a source to one of its sub directories
+type subSource struct {
+	source ISource
+	prefix string
+}
+
+// newSubSource returns a source rooted at the given directory of the given source
+func newSubSource(source ISource, dir string) ISource {
+	dir = cleanSourcePath(dir)
+	if dir == "." {
+		return source
+	}
+
+	return &subSource{source: source, prefix: dir}
+}
+
+// ReadDir ...
+func (s *subSource) ReadDir(dir string) ([]entities.SourceEntry, error) {
+	return s.source.ReadDir(path.Join(s.prefix, dir))
+}
+
+// ReadFile ...
+func (s *subSource) ReadFile(name string) ([]byte, error) {
+	return s.source.ReadFile(path.Join(s.prefix, name))
+}
+
+// cleanSourcePath normalizes a path to the relative format every ISource expects
+func cleanSourcePath(name string) string {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+
+	return name
+}
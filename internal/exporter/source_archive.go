@@ -0,0 +1,84 @@
+package exporter
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// newArchiveSource loads the given archive file into memory as a source. The archive
+// format (zip, tar or gzipped tar) is detected from the file content
+func newArchiveSource(archivePath string) (ISource, error) {
+	content, err := ioutil.ReadFile(archivePath)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("could not open archive (%s): %s", archivePath, err.Error()))
+	}
+
+	var source ISource
+	if bytes.HasPrefix(content, []byte("PK\x03\x04")) {
+		source, err = readZipSource(content)
+	} else {
+		source, err = readTarSource(content)
+	}
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("could not read archive (%s): %s", archivePath, err.Error()))
+	}
+
+	return source, nil
+}
+
+// readZipSource wraps the given zip content as a source
+func readZipSource(content []byte) (ISource, error) {
+	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, err
+	}
+
+	return NewFSSource(reader), nil
+}
+
+// readTarSource reads a whole tar stream into an in memory source, transparently
+// handling gzip compressed streams
+func readTarSource(content []byte) (ISource, error) {
+	var stream io.Reader = bytes.NewReader(content)
+
+	// Check for the gzip magic number before assuming a plain tar
+	if bytes.HasPrefix(content, []byte{0x1f, 0x8b}) {
+		gzipReader, err := gzip.NewReader(stream)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = gzipReader.Close() }()
+		stream = gzipReader
+	}
+
+	source := newMemSource()
+	tarReader := tar.NewReader(stream)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// We only care about regular files, directories are implied by file paths
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		fileContent, err := ioutil.ReadAll(tarReader)
+		if err != nil {
+			return nil, err
+		}
+		source.addFile(header.Name, fileContent)
+	}
+
+	return source, nil
+}
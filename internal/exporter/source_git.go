@@ -0,0 +1,84 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/entities"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path"
+)
+
+// gitSource is our ISource implementation reading straight from a Git tree object,
+// which means it does not depend on what is (or is not) checked out on the worktree
+type gitSource struct {
+	tree *object.Tree
+	// submodules tells if the submodules of our tree should be exported, which we can't do
+	submodules bool
+}
+
+// newGitSource creates a source for the tree of the given commit. Submodules are only
+// commit pointers on a tree, so unless we ignore them any submodule is an error
+func newGitSource(repo *git.Repository, commitHash plumbing.Hash, submodules bool) (ISource, error) {
+	commit, err := repo.CommitObject(commitHash)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	return &gitSource{tree: tree, submodules: submodules}, nil
+}
+
+// ReadDir ...
+func (s *gitSource) ReadDir(dir string) ([]entities.SourceEntry, error) {
+	tree := s.tree
+	if dir = cleanSourcePath(dir); dir != "." {
+		var err error
+		if tree, err = s.tree.Tree(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	var entries []entities.SourceEntry
+	for _, entry := range tree.Entries {
+		// Submodules are only commit pointers on a tree, skipping them would drop their keys
+		if entry.Mode == filemode.Submodule {
+			if s.submodules {
+				return nil, errors.New(fmt.Sprintf("%s is a submodule, which can't be read from a commit", path.Join(dir, entry.Name)))
+			}
+			continue
+		}
+		entries = append(entries, entities.SourceEntry{Name: entry.Name, IsDir: entry.Mode == filemode.Dir})
+	}
+
+	return entries, nil
+}
+
+// ReadFile ...
+func (s *gitSource) ReadFile(name string) ([]byte, error) {
+	file, err := s.tree.File(cleanSourcePath(name))
+	if err == object.ErrFileNotFound {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := file.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = reader.Close() }()
+
+	return ioutil.ReadAll(reader)
+}
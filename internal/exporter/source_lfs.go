@@ -0,0 +1,119 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+	"github.com/miniclip/gonsul/internal/entities"
+	"github.com/miniclip/gonsul/internal/util"
+
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const lfsPointerVersion = "version https://git-lfs.github.com/spec/v1\n"
+
+// lfsOidRegex matches the object id of a Git LFS pointer file
+var lfsOidRegex = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// lfsSource wraps a source, making sure Git LFS pointer files are never handed to the
+// exporter as they are: they are either resolved from a local LFS store or refused
+type lfsSource struct {
+	source ISource
+	mode   string
+	store  string
+	logger util.ILogger
+}
+
+// newLFSSource wraps the given source with our mount LFS policy
+func newLFSSource(source ISource, mount config.Mount, logger util.ILogger) ISource {
+	store := mount.RepoLFSStore
+	if store == "" {
+		store = path.Join(mount.RepoRootDir, ".git", "lfs", "objects")
+	}
+
+	return &lfsSource{source: source, mode: mount.RepoLFS, store: store, logger: logger}
+}
+
+// ReadDir ...
+func (s *lfsSource) ReadDir(dir string) ([]entities.SourceEntry, error) {
+	return s.source.ReadDir(dir)
+}
+
+// ReadFile ...
+func (s *lfsSource) ReadFile(name string) ([]byte, error) {
+	content, err := s.source.ReadFile(name)
+	if err != nil || !bytes.HasPrefix(content, []byte(lfsPointerVersion)) {
+		return content, err
+	}
+
+	oid, size, ok := parseLFSPointer(content)
+	if !ok {
+		// It looks like a pointer, but it's not a valid one, treat it as a regular file
+		return content, nil
+	}
+
+	if s.mode != config.LFSResolve {
+		return nil, exportError{
+			message: fmt.Sprintf("LFS: refusing to sync Git LFS pointer file: %s", name),
+			code:    util.ErrorFailedLFS,
+		}
+	}
+
+	resolved, err := s.resolve(oid, size)
+	if err != nil {
+		return nil, exportError{
+			message: fmt.Sprintf("LFS: could not resolve Git LFS pointer file: %s (%s)", name, err.Error()),
+			code:    util.ErrorFailedLFS,
+		}
+	}
+	s.logger.PrintDebug(fmt.Sprintf("LFS: resolved %s from object %s", name, oid))
+
+	return resolved, nil
+}
+
+// parseLFSPointer extracts the object id and size of a Git LFS pointer file
+func parseLFSPointer(content []byte) (string, string, bool) {
+	keys := map[string]string{}
+	for _, line := range strings.Split(strings.TrimRight(string(content), "\n"), "\n") {
+		pair := strings.SplitN(line, " ", 2)
+		if len(pair) != 2 {
+			return "", "", false
+		}
+		keys[pair[0]] = pair[1]
+	}
+
+	if !lfsOidRegex.MatchString(keys["oid"]) {
+		return "", "", false
+	}
+	if _, err := strconv.ParseUint(keys["size"], 10, 64); err != nil {
+		return "", "", false
+	}
+
+	return strings.TrimPrefix(keys["oid"], "sha256:"), keys["size"], true
+}
+
+// resolve reads an LFS object from our local store, checking it matches its pointer
+func (s *lfsSource) resolve(oid string, size string) ([]byte, error) {
+	content, err := ioutil.ReadFile(path.Join(s.store, oid[0:2], oid[2:4], oid))
+	if err != nil {
+		return nil, err
+	}
+
+	if strconv.Itoa(len(content)) != size {
+		return nil, errors.New("object size does not match its pointer")
+	}
+
+	sum := sha256.Sum256(content)
+	if hex.EncodeToString(sum[:]) != oid {
+		return nil, errors.New("object checksum does not match its pointer")
+	}
+
+	return content, nil
+}
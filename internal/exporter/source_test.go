@@ -0,0 +1,108 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/entities"
+
+	. "github.com/onsi/gomega"
+	"gopkg.in/src-d/go-git.v4"
+
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestReadTarSource(t *testing.T) {
+	RegisterTestingT(t)
+
+	// Build a gzipped tar bundle in memory
+	files := map[string]string{
+		"bundle/dev/app1/config.json":  `{"key": "value"}`,
+		"bundle/dev/app1/db-pass.txt":  "pass",
+		"bundle/prod/app1/db-pass.txt": "prod-pass",
+	}
+	var buffer bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, content := range files {
+		_ = tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		_, _ = tarWriter.Write([]byte(content))
+	}
+	_ = tarWriter.Close()
+	_ = gzipWriter.Close()
+
+	source, err := readTarSource(buffer.Bytes())
+	Expect(err).To(BeNil(), "Assert tar is read")
+
+	// Root our source the same way --repo-base-path does
+	source = newSubSource(source, "/bundle/")
+
+	entries, err := source.ReadDir(".")
+	Expect(err).To(BeNil(), "Assert root listing")
+	Expect(entries).To(Equal([]entities.SourceEntry{{Name: "dev", IsDir: true}, {Name: "prod", IsDir: true}}))
+
+	entries, err = source.ReadDir("dev/app1")
+	Expect(err).To(BeNil(), "Assert sub directory listing")
+	Expect(entries).To(Equal([]entities.SourceEntry{{Name: "config.json"}, {Name: "db-pass.txt"}}))
+
+	content, err := source.ReadFile("prod/app1/db-pass.txt")
+	Expect(err).To(BeNil(), "Assert file read")
+	Expect(string(content)).To(Equal("prod-pass"))
+
+	_, err = source.ReadDir("stg")
+	Expect(err).To(Not(BeNil()), "Assert missing directory")
+}
+
+func TestGitSource_ReadFile(t *testing.T) {
+	RegisterTestingT(t)
+
+	root, err := ioutil.TempDir("", "gonsul-git-source")
+	Expect(err).To(BeNil())
+	defer os.RemoveAll(root)
+	repo, err := git.PlainInit(root, false)
+	Expect(err).To(BeNil())
+	commit := commitFile(repo, root, "config/app.json", `{"version": 1}`, "First")
+
+	source, err := newGitSource(repo, commit, true)
+	Expect(err).To(BeNil())
+	content, err := source.ReadFile("config/app.json")
+	Expect(err).To(BeNil())
+	Expect(string(content)).To(Equal(`{"version": 1}`))
+
+	// Missing files are reported the way every other source does
+	_, err = source.ReadFile("config/other.json")
+	Expect(errors.Is(err, fs.ErrNotExist)).To(BeTrue())
+	_, err = source.ReadFile("missing/app.json")
+	Expect(errors.Is(err, fs.ErrNotExist)).To(BeTrue())
+}
+
+func TestGitSource_Submodules(t *testing.T) {
+	RegisterTestingT(t)
+
+	root, err := ioutil.TempDir("", "gonsul-git-submodules")
+	Expect(err).To(BeNil())
+	defer os.RemoveAll(root)
+	repo, err := git.PlainInit(root, false)
+	Expect(err).To(BeNil())
+	first := commitFile(repo, root, "config/app.json", `{"version": 1}`, "First")
+
+	// A submodule is only a commit pointer on our tree
+	runCommand(root, nil, "git", "update-index", "--add", "--cacheinfo", "160000,"+first.String()+",config/shared")
+	commit := gitCommit(root, nil, "Submodule")
+
+	// Its keys can't be read from a commit, which is an error unless we ignore submodules
+	source, err := newGitSource(repo, commit, true)
+	Expect(err).To(BeNil())
+	_, err = source.ReadDir("config")
+	Expect(err).To(MatchError("config/shared is a submodule, which can't be read from a commit"))
+
+	source, err = newGitSource(repo, commit, false)
+	Expect(err).To(BeNil())
+	entries, err := source.ReadDir("config")
+	Expect(err).To(BeNil())
+	Expect(entries).To(Equal([]entities.SourceEntry{{Name: "app.json"}}))
+}
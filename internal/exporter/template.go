@@ -0,0 +1,138 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/util"
+
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+// templateData is what our templates are executed with, as "."
+type templateData struct {
+	// File is the path of the rendered file, relative to the repository base path
+	File string
+}
+
+// templateFile returns the path a file is exported as, without its template extension,
+// telling whether it's a template file at all
+func (e *exporter) templateFile(filePath string) (string, bool) {
+	templateExt := e.config.GetTemplateExt()
+	if templateExt == "" || !strings.HasSuffix(filePath, "."+templateExt) {
+		return filePath, false
+	}
+
+	return strings.TrimSuffix(filePath, "."+templateExt), true
+}
+
+// renderTemplate renders a template file with our function set, includes being read from the
+// given source. It tells whether the file could be rendered
+func (e *exporter) renderTemplate(source ISource, filePath string, content string) (string, bool) {
+	exportPath, _ := e.templateFile(filePath)
+
+	tmpl, err := template.New(filePath).Option("missingkey=error").Funcs(e.templateFuncs(source)).Parse(content)
+	if err == nil {
+		buffer := &bytes.Buffer{}
+		if err = tmpl.Execute(buffer, templateData{File: exportPath}); err == nil {
+			return buffer.String(), true
+		}
+	}
+
+	e.addError(util.ErrorFailedTemplate, fmt.Sprintf("EXPORTER: template error: %s", err.Error()))
+
+	return "", false
+}
+
+// templateFuncs returns the functions our templates can use, besides Go template builtins
+func (e *exporter) templateFuncs(source ISource) template.FuncMap {
+	return template.FuncMap{
+		// default returns the given value, or the fallback if it's empty: {{.Port | default 8080}}
+		"default": func(fallback interface{}, value interface{}) interface{} {
+			if isEmptyValue(value) {
+				return fallback
+			}
+			return value
+		},
+		// required fails the rendering with the given message if the value is empty
+		"required": func(message string, value interface{}) (interface{}, error) {
+			if isEmptyValue(value) {
+				return nil, errors.New(message)
+			}
+			return value, nil
+		},
+		// env returns an environment variable of the --secrets-env prefix, empty if not set
+		"env": func(name string) (string, error) {
+			value, _, err := e.config.GetSecrets().Lookup("env." + name)
+			return value, err
+		},
+		// secret returns one of our secrets, failing if there's no such secret
+		"secret": func(name string) (string, error) {
+			value, found, err := e.config.GetSecrets().Lookup(name)
+			if err == nil && !found {
+				err = errors.New("unknown secret: " + name)
+			}
+			return value, err
+		},
+		"b64enc": func(value string) string {
+			return base64.StdEncoding.EncodeToString([]byte(value))
+		},
+		"b64dec": func(value string) (string, error) {
+			decoded, err := base64.StdEncoding.DecodeString(value)
+			return string(decoded), err
+		},
+		// toJson encodes any value as JSON, strings being quoted and escaped
+		"toJson": func(value interface{}) (string, error) {
+			return marshalJSON(value)
+		},
+		// ref writes back a reference to another key, resolved once every key is exported
+		"ref": func(key string) string {
+			return "{{ref " + key + "}}"
+		},
+		// file includes the content of another file of the repository, as is
+		"file": func(name string) (string, error) {
+			return includeFile(source, name)
+		},
+	}
+}
+
+// includeFile reads a file of the given source, relative to the repository base path
+func includeFile(source ISource, name string) (string, error) {
+	if source == nil {
+		return "", errors.New("files can't be included here")
+	}
+
+	// Includes can't read anything outside of our source
+	cleaned := path.Clean(strings.TrimPrefix(name, "/"))
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", errors.New(fmt.Sprintf("invalid file to include: %s", name))
+	}
+
+	content, err := source.ReadFile(cleaned)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("could not include file %s: %s", name, err.Error()))
+	}
+
+	return string(content), nil
+}
+
+// isEmptyValue tells if the given template value is empty: nil, false, zero, or an empty string or collection
+func isEmptyValue(value interface{}) bool {
+	reflected := reflect.ValueOf(value)
+	if !reflected.IsValid() {
+		return true
+	}
+
+	switch reflected.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return reflected.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return reflected.IsNil()
+	}
+
+	return reflected.IsZero()
+}
@@ -0,0 +1,64 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/secrets"
+	"github.com/miniclip/gonsul/internal/util"
+	"github.com/miniclip/gonsul/tests/mocks"
+
+	. "github.com/onsi/gomega"
+
+	"os"
+	"testing"
+)
+
+// templateConfig is the configuration rendering template files depends on
+func templateConfig(values secrets.ISecrets) *mocks.IConfig {
+	cfg := &mocks.IConfig{}
+	cfg.On("GetTemplateExt").Return("tmpl")
+	cfg.On("GetSecrets").Return(values)
+
+	return exportDefaults(cfg)
+}
+
+func TestParseDirRendersTemplates(t *testing.T) {
+	RegisterTestingT(t)
+
+	Expect(os.Setenv("GONSUL_TEST_STAGE", "prod")).To(BeNil())
+	defer os.Unsetenv("GONSUL_TEST_STAGE")
+	values := map[string]string{"db.password": `p"ss`}
+	providers := map[string]secrets.IProvider{"env": secrets.NewEnvProvider("GONSUL_TEST_")}
+
+	memory := newMemSource()
+	memory.addFile("shared/host.txt", []byte("db.internal"))
+	memory.addFile("app/db.json.tmpl", []byte(`{
+  "host": {{file "shared/host.txt" | toJson}},
+  "port": {{env "PORT" | default 5432}},
+  "password": {{secret "db.password" | toJson}},
+  "auth": "{{printf "admin:%s" (secret "db.password") | b64enc}}",
+  "debug": {{if eq (env "STAGE") "prod"}}false{{else}}true{{end}},
+  "file": "{{.File}}"
+}`))
+	memory.addFile("app/broken.json.tmpl", []byte(`{"stage": "{{env "MISSING" | required "MISSING is required"}}"}`))
+	memory.addFile("app/escape.json.tmpl", []byte(`{{file "../../etc/passwd"}}`))
+
+	e := &exporter{config: templateConfig(secrets.NewSecrets(values, providers)), logger: util.NewLogger(0)}
+	localData := map[string]string{}
+	e.parseDir(memory, ".", localData)
+
+	// Templates are exported as the file they render, which is validated as any other file
+	Expect(localData).To(HaveLen(2))
+	Expect(localData["app/db"]).To(Equal(`{
+  "host": "db.internal",
+  "port": 5432,
+  "password": "p\"ss",
+  "auth": "YWRtaW46cCJzcw==",
+  "debug": false,
+  "file": "app/db.json"
+}`))
+	Expect(localData["shared/host"]).To(Equal("db.internal"))
+
+	Expect(e.errors).To(HaveLen(2))
+	Expect(e.errors[0].message).To(ContainSubstring("MISSING is required"))
+	Expect(e.errors[1].message).To(ContainSubstring("invalid file to include: ../../etc/passwd"))
+	Expect(e.exitOnErrors).To(PanicWith(util.GonsulError{Code: util.ErrorFailedTemplate}))
+}
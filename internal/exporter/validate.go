@@ -0,0 +1,59 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/util"
+
+	"fmt"
+	"path/filepath"
+)
+
+// validateSchemas validates a file against the JSON Schema files it's associated with, keeping
+// track of every violation so they're all reported at once. Schemas are read from the same
+// source as the file, and cached in the given map
+func (e *exporter) validateSchemas(source ISource, filePath string, content string, schemas map[string]*schema) {
+	schemaPaths := e.config.GetSchemas(filePath)
+	if len(schemaPaths) == 0 {
+		return
+	}
+
+	format := findFormat(filepath.Ext(filePath))
+	if format == nil {
+		e.addError(util.ErrorSchemaViolation, fmt.Sprintf("EXPORTER: schema violation: %s: not a structured file, it can't be validated", filePath))
+		return
+	}
+
+	// Syntax errors are reported while parsing the file
+	document, _, err := format.Decode(content)
+	if err != nil {
+		return
+	}
+
+	for _, schemaPath := range schemaPaths {
+		fileSchema := e.loadSchema(source, schemaPath, schemas)
+		if fileSchema == nil {
+			continue
+		}
+		for _, violation := range fileSchema.validate(document) {
+			e.addError(util.ErrorSchemaViolation, fmt.Sprintf("EXPORTER: schema violation: %s (%s): %s", filePath, schemaPath, violation))
+		}
+	}
+}
+
+// loadSchema reads a JSON Schema file from the given source, nil if it's not a valid one
+func (e *exporter) loadSchema(source ISource, schemaPath string, schemas map[string]*schema) *schema {
+	if fileSchema, ok := schemas[schemaPath]; ok {
+		return fileSchema
+	}
+
+	// Broken schemas are reported once, as a violation of their own
+	content, err := source.ReadFile(schemaPath)
+	if err == nil {
+		schemas[schemaPath], err = newSchema(string(content))
+	}
+	if err != nil {
+		schemas[schemaPath] = nil
+		e.addError(util.ErrorSchemaViolation, fmt.Sprintf("EXPORTER: schema violation: %s: invalid schema file: %s", schemaPath, err.Error()))
+	}
+
+	return schemas[schemaPath]
+}
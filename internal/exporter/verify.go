@@ -0,0 +1,416 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+	"github.com/miniclip/gonsul/internal/util"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const sshSignatureBegin = "-----BEGIN SSH SIGNATURE-----"
+const sshSignatureEnd = "-----END SSH SIGNATURE-----"
+const sshSignatureMagic = "SSHSIG"
+const sshSignatureNamespace = "git"
+
+// sshSignature is the SSHSIG blob wrapped inside an armored SSH signature
+type sshSignature struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// sshSignedData is what an SSH signature actually signs, prefixed by the SSHSIG magic
+type sshSignedData struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+// isVerifying tells if we must verify commit signatures before syncing
+func (e *exporter) isVerifying() bool {
+	return e.config.GetRepoGPGKeyring() != "" || e.config.GetRepoSSHAllowedSigners() != ""
+}
+
+// verifyCommits makes sure the commit we're about to sync (and, if configured, every
+// commit since the last one we trust for this mount) is signed by a trusted key
+func (e *exporter) verifyCommits(repo *git.Repository, commitHash plumbing.Hash, mount config.Mount) {
+	commit, err := repo.CommitObject(commitHash)
+	e.checkRepoError(err)
+
+	// By default, we only care about what we are about to sync
+	commits := []*object.Commit{commit}
+
+	if e.config.VerifyAllCommits() {
+		since, err := e.trustedSince(repo, mount)
+		if err == nil {
+			commits, err = e.commitsSince(repo, commit, since)
+		}
+		if err != nil {
+			util.ExitError(
+				errors.New(fmt.Sprintf("REPO: refusing to sync %s, could not verify its history: %s", mount.Name, err.Error())),
+				util.ErrorFailedVerification,
+				e.logger,
+			)
+		}
+
+		// Going back to (or before) a trusted commit, we still verify what we sync
+		if len(commits) == 0 {
+			commits = []*object.Commit{commit}
+		}
+	}
+
+	for _, c := range commits {
+		if err := e.verifyCommit(repo, c.Hash); err != nil {
+			util.ExitError(
+				errors.New(fmt.Sprintf("REPO: refusing to sync %s, commit %s is not trusted: %s", mount.Name, c.Hash.String(), err.Error())),
+				util.ErrorFailedVerification,
+				e.logger,
+			)
+		}
+		e.logger.PrintDebug(fmt.Sprintf("REPO: commit signature verified: %s", c.Hash.String()))
+	}
+
+	e.verified[mount.Name] = commitHash
+}
+
+// trustedSince returns the commit we verify a mount history from: the last one we verified, the
+// last one synced to Consul, or the configured trust anchor. A zero hash means the whole history
+func (e *exporter) trustedSince(repo *git.Repository, mount config.Mount) (plumbing.Hash, error) {
+	if last, ok := e.verified[mount.Name]; ok {
+		return last, nil
+	}
+
+	if mount.RepoTrustAnchor == "" {
+		return plumbing.ZeroHash, nil
+	}
+
+	anchor := plumbing.NewHash(mount.RepoTrustAnchor)
+	if _, err := repo.CommitObject(anchor); err != nil {
+		return plumbing.ZeroHash, errors.New(fmt.Sprintf("trust anchor %s: %s", mount.RepoTrustAnchor, err.Error()))
+	}
+
+	// Anyone able to write our sync state could name any commit, so we only trust a
+	// synced commit that is itself trusted and comes after our trust anchor
+	if synced, ok := e.synced[mount.Name]; ok && synced != anchor {
+		if e.isDescendant(repo, synced, anchor) && e.verifyCommit(repo, synced) == nil {
+			return synced, nil
+		}
+		e.logger.PrintInfo(fmt.Sprintf("REPO: last synced commit %s of %s is not trusted, verifying from its trust anchor", synced.String(), mount.Name))
+	}
+
+	return anchor, nil
+}
+
+// isDescendant tells if the given commit has the given ancestor on its history
+func (e *exporter) isDescendant(repo *git.Repository, commitHash plumbing.Hash, ancestor plumbing.Hash) bool {
+	commit, err := repo.CommitObject(commitHash)
+	if err != nil {
+		return false
+	}
+
+	found := false
+	_ = object.NewCommitPreorderIter(commit, nil, nil).ForEach(func(c *object.Commit) error {
+		if c.Hash == ancestor {
+			found = true
+			return storer.ErrStop
+		}
+		return nil
+	})
+
+	return found
+}
+
+// commitsSince returns every commit reachable from the given commit that is not
+// reachable from the last trusted one (every reachable commit, given a zero hash)
+func (e *exporter) commitsSince(repo *git.Repository, commit *object.Commit, last plumbing.Hash) ([]*object.Commit, error) {
+	// Collect everything we already trust, so we do not walk it again. Shallow clones
+	// miss the oldest of those, which we would not walk either way
+	seen := map[plumbing.Hash]bool{}
+	if lastCommit, err := repo.CommitObject(last); err == nil {
+		err = object.NewCommitPreorderIter(lastCommit, nil, nil).ForEach(func(c *object.Commit) error {
+			seen[c.Hash] = true
+			return nil
+		})
+		if err != nil && err != plumbing.ErrObjectNotFound {
+			return nil, err
+		}
+	}
+
+	var commits []*object.Commit
+	err := object.NewCommitPreorderIter(commit, seen, nil).ForEach(func(c *object.Commit) error {
+		commits = append(commits, c)
+		return nil
+	})
+
+	// Reaching the end of a shallow clone, there are commits we cannot verify
+	if err == plumbing.ErrObjectNotFound {
+		return nil, errors.New("history is missing commits, as in shallow clones not deep enough to reach the last trusted commit")
+	}
+
+	return commits, err
+}
+
+// verifyCommit checks the signature of a single commit against our trusted keys
+func (e *exporter) verifyCommit(repo *git.Repository, commitHash plumbing.Hash) error {
+	encoded, err := repo.Storer.EncodedObject(plumbing.CommitObject, commitHash)
+	if err != nil {
+		return err
+	}
+
+	reader, err := encoded.Reader()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = reader.Close() }()
+
+	raw, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	payload, signature := splitCommitSignature(raw)
+	switch {
+	case signature == "":
+		return errors.New("commit is not signed")
+	case strings.HasPrefix(signature, sshSignatureBegin):
+		commit, err := repo.CommitObject(commitHash)
+		if err != nil {
+			return err
+		}
+		return e.verifySSHSignature(payload, signature, commit.Committer)
+	default:
+		return e.verifyGPGSignature(payload, signature)
+	}
+}
+
+// verifyGPGSignature checks an armored PGP signature against our configured keyring
+func (e *exporter) verifyGPGSignature(payload []byte, signature string) error {
+	if e.config.GetRepoGPGKeyring() == "" {
+		return errors.New("commit is GPG signed and no GPG keyring is configured")
+	}
+
+	armoredKeyRing, err := ioutil.ReadFile(e.config.GetRepoGPGKeyring())
+	if err != nil {
+		return err
+	}
+
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(armoredKeyRing))
+	if err != nil {
+		return err
+	}
+
+	_, err = openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(payload), strings.NewReader(signature+"\n"), nil)
+
+	return err
+}
+
+// verifySSHSignature checks an armored SSH signature (as produced by "ssh-keygen -Y sign")
+// against our configured allowed signers, for the commit committer
+func (e *exporter) verifySSHSignature(payload []byte, signature string, committer object.Signature) error {
+	if e.config.GetRepoSSHAllowedSigners() == "" {
+		return errors.New("commit is SSH signed and no SSH allowed signers file is configured")
+	}
+
+	// Decode the armored SSHSIG blob
+	armored := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(strings.TrimPrefix(signature, sshSignatureBegin)), sshSignatureEnd))
+	blob, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(armored), ""))
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(blob, []byte(sshSignatureMagic)) {
+		return errors.New("invalid SSH signature")
+	}
+
+	var sshSig sshSignature
+	if err := ssh.Unmarshal(blob[len(sshSignatureMagic):], &sshSig); err != nil {
+		return err
+	}
+	if sshSig.Namespace != sshSignatureNamespace {
+		return errors.New("SSH signature namespace is not " + sshSignatureNamespace)
+	}
+
+	// Make sure the signing key is one we trust
+	publicKey, err := e.findAllowedSigner(sshSig.PublicKey, committer)
+	if err != nil {
+		return err
+	}
+
+	var hasher hash.Hash
+	switch sshSig.HashAlgorithm {
+	case "sha256":
+		hasher = sha256.New()
+	case "sha512":
+		hasher = sha512.New()
+	default:
+		return errors.New("unsupported SSH signature hash algorithm: " + sshSig.HashAlgorithm)
+	}
+	hasher.Write(payload)
+
+	var sig ssh.Signature
+	if err := ssh.Unmarshal(sshSig.Signature, &sig); err != nil {
+		return err
+	}
+
+	signed := append([]byte(sshSignatureMagic), ssh.Marshal(sshSignedData{
+		Namespace:     sshSig.Namespace,
+		Reserved:      sshSig.Reserved,
+		HashAlgorithm: sshSig.HashAlgorithm,
+		Hash:          hasher.Sum(nil),
+	})...)
+
+	return publicKey.Verify(signed, &sig)
+}
+
+// findAllowedSigner looks for the given wire encoded public key on our allowed signers file, as
+// "ssh-keygen -Y verify -n git" does: the key must be listed for one of the committer email
+// principals, and allowed to sign on the git namespace at the commit date
+func (e *exporter) findAllowedSigner(wireKey []byte, committer object.Signature) (ssh.PublicKey, error) {
+	content, err := ioutil.ReadFile(e.config.GetRepoSSHAllowedSigners())
+	if err != nil {
+		return nil, err
+	}
+
+	listed := false
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Lines are: principals [options] keytype key [comment]
+		fields := strings.Fields(line)
+		publicKey, _, options, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(strings.TrimPrefix(line, fields[0]))))
+		if err != nil || !bytes.Equal(publicKey.Marshal(), wireKey) {
+			continue
+		}
+		listed = true
+
+		if matchSSHPatterns(fields[0], committer.Email) && allowsSSHSignature(options, committer.When) {
+			return publicKey, nil
+		}
+	}
+
+	if listed {
+		return nil, errors.New(fmt.Sprintf("SSH signing key is not allowed to sign git commits for %s", committer.Email))
+	}
+
+	return nil, errors.New("SSH signing key is not an allowed signer")
+}
+
+// allowsSSHSignature tells if the given allowed signers options let a key sign our commits
+// at the given date. Certificate authorities are not supported, their keys never sign commits
+func allowsSSHSignature(options []string, when time.Time) bool {
+	for _, option := range options {
+		parts := strings.SplitN(option, "=", 2)
+		name, value := strings.ToLower(parts[0]), ""
+		if len(parts) == 2 {
+			value = strings.Trim(parts[1], `"`)
+		}
+
+		switch name {
+		case "cert-authority":
+			return false
+		case "namespaces":
+			if !matchSSHPatterns(value, sshSignatureNamespace) {
+				return false
+			}
+		case "valid-after", "valid-before":
+			limit, err := parseSSHTime(value)
+			if err != nil || (name == "valid-after" && when.Before(limit)) || (name == "valid-before" && when.After(limit)) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// matchSSHPatterns matches a value against a comma separated OpenSSH pattern list, where * and ?
+// are wildcards and a matching pattern starting with ! refuses the value whatever else matches
+func matchSSHPatterns(patterns string, value string) bool {
+	matched := false
+	for _, pattern := range strings.Split(patterns, ",") {
+		negated := strings.HasPrefix(pattern, "!")
+		expression := regexp.QuoteMeta(strings.TrimPrefix(pattern, "!"))
+		expression = strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(expression)
+		if regexp.MustCompile("^" + expression + "$").MatchString(value) {
+			if negated {
+				return false
+			}
+			matched = true
+		}
+	}
+
+	return matched
+}
+
+// parseSSHTime parses an allowed signers date: YYYYMMDD[HHMM[SS]], in UTC when ending in Z
+func parseSSHTime(value string) (time.Time, error) {
+	location := time.Local
+	if strings.HasSuffix(value, "Z") {
+		value, location = strings.TrimSuffix(value, "Z"), time.UTC
+	}
+
+	for _, layout := range []string{"20060102", "200601021504", "20060102150405"} {
+		if len(value) == len(layout) {
+			return time.ParseInLocation(layout, value, location)
+		}
+	}
+
+	return time.Time{}, errors.New("invalid SSH allowed signers date: " + value)
+}
+
+// splitCommitSignature splits a raw commit object into the signed payload (the
+// commit without its "gpgsig" header) and the signature itself
+func splitCommitSignature(raw []byte) ([]byte, string) {
+	var payload bytes.Buffer
+	var signature []string
+	inSignature, inHeaders := false, true
+
+	for _, line := range strings.SplitAfter(string(raw), "\n") {
+		if inHeaders {
+			// Signature continuation lines start with a single space
+			if inSignature && strings.HasPrefix(line, " ") {
+				signature = append(signature, strings.TrimSuffix(line[1:], "\n"))
+				continue
+			}
+			inSignature = false
+
+			if strings.HasPrefix(line, "gpgsig ") {
+				inSignature = true
+				signature = append(signature, strings.TrimSuffix(strings.TrimPrefix(line, "gpgsig "), "\n"))
+				continue
+			}
+
+			if line == "\n" {
+				inHeaders = false
+			}
+		}
+		payload.WriteString(line)
+	}
+
+	return payload.Bytes(), strings.Join(signature, "\n")
+}
@@ -0,0 +1,323 @@
+package exporter
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+	"github.com/miniclip/gonsul/internal/entities"
+	"github.com/miniclip/gonsul/internal/util"
+	"github.com/miniclip/gonsul/tests/mocks"
+
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitCommitSignature(t *testing.T) {
+	RegisterTestingT(t)
+
+	raw := "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"author dev <dev@example.com> 1700000000 +0000\n" +
+		"committer dev <dev@example.com> 1700000000 +0000\n" +
+		"gpgsig -----BEGIN SSH SIGNATURE-----\n" +
+		" U1NIU0lH\n" +
+		" \n" +
+		" -----END SSH SIGNATURE-----\n" +
+		"\n" +
+		"message\n" +
+		" indented message line\n"
+
+	payload, signature := splitCommitSignature([]byte(raw))
+
+	expected := "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"author dev <dev@example.com> 1700000000 +0000\n" +
+		"committer dev <dev@example.com> 1700000000 +0000\n" +
+		"\n" +
+		"message\n" +
+		" indented message line\n"
+	Expect(string(payload)).To(Equal(expected), "Assert payload has no signature")
+	Expect(signature).To(Equal("-----BEGIN SSH SIGNATURE-----\nU1NIU0lH\n\n-----END SSH SIGNATURE-----"), "Assert signature")
+
+	// Unsigned commits have an empty signature and an untouched payload
+	payload, signature = splitCommitSignature([]byte("tree abc\n\nmessage\n"))
+	Expect(string(payload)).To(Equal("tree abc\n\nmessage\n"))
+	Expect(signature).To(BeEmpty())
+}
+
+func TestVerifyCommit_GPG(t *testing.T) {
+	RegisterTestingT(t)
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "gonsul-gpg")
+	Expect(err).To(BeNil())
+	defer os.RemoveAll(dir)
+
+	// Create our signing key, trusting it through an armored keyring
+	home := path.Join(dir, "gnupg")
+	Expect(os.Mkdir(home, 0700)).To(BeNil())
+	env := []string{"GNUPGHOME=" + home}
+	defer func() { _ = exec.Command("gpgconf", "--homedir", home, "--kill", "gpg-agent").Run() }()
+	runCommand(dir, env, "gpg", "--batch", "--pinentry-mode", "loopback", "--passphrase", "", "--quick-gen-key", "Gonsul <gonsul@example.com>", "rsa2048", "sign", "never")
+	keyring := path.Join(dir, "keyring.asc")
+	Expect(ioutil.WriteFile(keyring, []byte(runCommand(dir, env, "gpg", "--armor", "--export", "gonsul@example.com")), 0600)).To(BeNil())
+
+	repoDir := path.Join(dir, "repo")
+	runCommand(dir, env, "git", "init", "-q", repoDir)
+	unsigned := gitCommit(repoDir, env, "Unsigned")
+	signed := gitCommit(repoDir, env, "Signed", "-c", "user.signingkey=gonsul@example.com", "-c", "gpg.program=gpg", "commit", "-S")
+	repo, err := git.PlainOpen(repoDir)
+	Expect(err).To(BeNil())
+
+	e := &exporter{config: verifyConfig(keyring, "", false)}
+	Expect(e.verifyCommit(repo, signed)).To(BeNil(), "Assert signed commit is trusted")
+	Expect(e.verifyCommit(repo, tamperCommit(repo, signed))).To(Not(BeNil()), "Assert tampered commit is refused")
+	Expect(e.verifyCommit(repo, unsigned)).To(MatchError("commit is not signed"))
+
+	// Without a keyring, GPG signatures are not trusted at all
+	e = &exporter{config: verifyConfig("", path.Join(dir, "allowed_signers"), false)}
+	Expect(e.verifyCommit(repo, signed)).To(MatchError("commit is GPG signed and no GPG keyring is configured"))
+}
+
+func TestVerifyCommit_SSH(t *testing.T) {
+	RegisterTestingT(t)
+	dir, repo, signers := sshSignedRepo(t)
+	defer os.RemoveAll(dir)
+
+	repoDir := path.Join(dir, "repo")
+	unsigned := gitCommit(repoDir, nil, "Unsigned")
+	signed := gitCommit(repoDir, nil, "Signed", "-c", "gpg.format=ssh", "-c", "user.signingkey="+path.Join(dir, "key"), "commit", "-S")
+	untrusted := gitCommit(repoDir, nil, "Untrusted", "-c", "gpg.format=ssh", "-c", "user.signingkey="+path.Join(dir, "other"), "commit", "-S")
+
+	e := &exporter{config: verifyConfig("", signers, false)}
+	Expect(e.verifyCommit(repo, signed)).To(BeNil(), "Assert signed commit is trusted")
+	Expect(e.verifyCommit(repo, tamperCommit(repo, signed))).To(Not(BeNil()), "Assert tampered commit is refused")
+	Expect(e.verifyCommit(repo, untrusted)).To(MatchError("SSH signing key is not an allowed signer"))
+	Expect(e.verifyCommit(repo, unsigned)).To(MatchError("commit is not signed"))
+
+	// Without allowed signers, SSH signatures are not trusted at all
+	e = &exporter{config: verifyConfig(path.Join(dir, "keyring.asc"), "", false)}
+	Expect(e.verifyCommit(repo, signed)).To(MatchError("commit is SSH signed and no SSH allowed signers file is configured"))
+}
+
+func TestVerifyCommits_History(t *testing.T) {
+	RegisterTestingT(t)
+	dir, repo, signers := sshSignedRepo(t)
+	defer os.RemoveAll(dir)
+
+	// An unsigned commit, before we started signing, followed by signed ones
+	repoDir := path.Join(dir, "repo")
+	sign := []string{"-c", "gpg.format=ssh", "-c", "user.signingkey=" + path.Join(dir, "key"), "commit", "-S"}
+	anchor := gitCommit(repoDir, nil, "Before signing")
+	gitCommit(repoDir, nil, "First signed", sign...)
+	head := gitCommit(repoDir, nil, "Second signed", sign...)
+
+	logger := &mocks.ILogger{}
+	logger.On("PrintDebug", mock.Anything).Return()
+	logger.On("PrintInfo", mock.Anything).Return()
+	logger.On("PrintError", mock.Anything).Return()
+	refused := PanicWith(util.GonsulError{Code: util.ErrorFailedVerification})
+	verify := func(e *exporter, mount config.Mount) func() {
+		return func() { e.verifyCommits(repo, head, mount) }
+	}
+	newExporter := func(synced string) *exporter {
+		e := &exporter{config: verifyConfig("", signers, true), logger: logger, verified: map[string]plumbing.Hash{}}
+		if synced != "" {
+			e.SetSyncedCommits([]entities.CommitInfo{{Mount: "default", SHA: synced}})
+		}
+		return e
+	}
+	mount := config.Mount{Name: "default"}
+	anchored := config.Mount{Name: "default", RepoTrustAnchor: anchor.String()}
+
+	// Without anything to trust, the whole history is verified
+	Expect(verify(newExporter(""), mount)).To(refused)
+
+	// From our trust anchor, only later commits are
+	e := newExporter("")
+	Expect(verify(e, anchored)).To(Not(Panic()))
+	Expect(e.verified["default"]).To(Equal(head))
+
+	// An anchor we cannot find is never trusted
+	Expect(verify(newExporter(""), config.Mount{Name: "default", RepoTrustAnchor: plumbing.ZeroHash.String()})).To(refused)
+
+	// Once verified, new unsigned commits are refused
+	unsigned := gitCommit(repoDir, nil, "Unsigned")
+	head = unsigned
+	Expect(verify(e, anchored)).To(refused)
+
+	// Our last synced commit is trusted, if signed and after our trust anchor
+	synced := gitCommit(repoDir, nil, "Signed after unsigned", sign...)
+	head = gitCommit(repoDir, nil, "Latest", sign...)
+	Expect(verify(newExporter(synced.String()), anchored)).To(Not(Panic()))
+
+	// Otherwise, anyone able to write our sync state could skip verification
+	Expect(verify(newExporter(synced.String()), mount)).To(refused)
+	Expect(verify(newExporter(unsigned.String()), anchored)).To(refused)
+	Expect(verify(newExporter("45a81b9041cfaff50b8da101579dd3cf15f6b3c2"), anchored)).To(refused)
+	Expect(verify(newExporter(synced.String()), config.Mount{Name: "default", RepoTrustAnchor: head.String()})).To(Not(Panic()), "Assert synced commits before the anchor are not used")
+}
+
+func TestCommitsSince_Shallow(t *testing.T) {
+	RegisterTestingT(t)
+
+	upstreamDir, err := ioutil.TempDir("", "gonsul-upstream")
+	Expect(err).To(BeNil())
+	defer os.RemoveAll(upstreamDir)
+	cloneDir, err := ioutil.TempDir("", "gonsul-clone")
+	Expect(err).To(BeNil())
+	defer os.RemoveAll(cloneDir)
+
+	upstream, err := git.PlainInit(upstreamDir, false)
+	Expect(err).To(BeNil())
+	first := commitFile(upstream, upstreamDir, "config/app.json", `{"version": 1}`, "First")
+	head := commitFile(upstream, upstreamDir, "config/app.json", `{"version": 2}`, "Second")
+
+	repo, err := git.PlainClone(cloneDir, false, &git.CloneOptions{URL: "file://" + upstreamDir, Depth: 1})
+	Expect(err).To(BeNil())
+	commit, err := repo.CommitObject(head)
+	Expect(err).To(BeNil())
+
+	// Trusting a commit within our clone, there is nothing else to verify
+	e := &exporter{}
+	commits, err := e.commitsSince(repo, commit, head)
+	Expect(err).To(BeNil())
+	Expect(commits).To(BeEmpty())
+
+	// But trusting one before it, or none, we cannot verify what we did not fetch
+	_, err = e.commitsSince(repo, commit, first)
+	Expect(err).To(MatchError(ContainSubstring("shallow clones")))
+	_, err = e.commitsSince(repo, commit, plumbing.ZeroHash)
+	Expect(err).To(MatchError(ContainSubstring("shallow clones")))
+}
+
+func TestFindAllowedSigner(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "gonsul-signers")
+	Expect(err).To(BeNil())
+	defer os.RemoveAll(dir)
+
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	Expect(err).To(BeNil())
+	sshKey, err := ssh.NewPublicKey(publicKey)
+	Expect(err).To(BeNil())
+	key := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshKey)))
+	committer := object.Signature{Email: "jane@example.com", When: time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)}
+
+	allowed := func(line string) error {
+		signers := path.Join(dir, "allowed_signers")
+		Expect(ioutil.WriteFile(signers, []byte(line+"\n"), 0600)).To(BeNil())
+		e := &exporter{config: verifyConfig("", signers, false)}
+		_, err := e.findAllowedSigner(sshKey.Marshal(), committer)
+		return err
+	}
+
+	// Our key must be listed for the committer, on the git namespace and at the commit date
+	Expect(allowed("jane@example.com " + key)).To(BeNil())
+	Expect(allowed("john@example.com,*@example.com " + key)).To(BeNil())
+	Expect(allowed(`jane@example.com namespaces="file,git" ` + key)).To(BeNil())
+	Expect(allowed(`jane@example.com valid-after="20210101",valid-before="20210601120000Z" ` + key)).To(BeNil())
+
+	notAllowed := MatchError("SSH signing key is not allowed to sign git commits for jane@example.com")
+	Expect(allowed("john@example.com " + key)).To(notAllowed)
+	Expect(allowed("!jane@example.com,*@example.com " + key)).To(notAllowed)
+	Expect(allowed(`jane@example.com namespaces="file" ` + key)).To(notAllowed)
+	Expect(allowed(`jane@example.com valid-before="20210101" ` + key)).To(notAllowed)
+	Expect(allowed(`jane@example.com cert-authority ` + key)).To(notAllowed)
+	Expect(allowed(key)).To(MatchError("SSH signing key is not an allowed signer"), "Assert principals are required")
+}
+
+// verifyConfig mocks the configuration of our commit verification
+func verifyConfig(keyring string, signers string, all bool) *mocks.IConfig {
+	cfg := &mocks.IConfig{}
+	cfg.On("GetRepoGPGKeyring").Return(keyring)
+	cfg.On("GetRepoSSHAllowedSigners").Return(signers)
+	cfg.On("VerifyAllCommits").Return(all)
+	return cfg
+}
+
+// sshSignedRepo creates an empty repository, along with a trusted ("key") and an untrusted
+// ("other") SSH signing key, returning its temporary directory and allowed signers file
+func sshSignedRepo(t *testing.T) (string, *git.Repository, string) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "gonsul-ssh")
+	Expect(err).To(BeNil())
+
+	for _, key := range []string{"key", "other"} {
+		runCommand(dir, nil, "ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", key, "-f", path.Join(dir, key))
+	}
+	publicKey, err := ioutil.ReadFile(path.Join(dir, "key.pub"))
+	Expect(err).To(BeNil())
+	signers := path.Join(dir, "allowed_signers")
+	Expect(ioutil.WriteFile(signers, []byte("# Our signers\ngonsul@example.com "+string(publicKey)), 0600)).To(BeNil())
+
+	runCommand(dir, nil, "git", "init", "-q", path.Join(dir, "repo"))
+	repo, err := git.PlainOpen(path.Join(dir, "repo"))
+	Expect(err).To(BeNil())
+
+	return dir, repo, signers
+}
+
+// gitCommit creates an empty commit with the Git command line, which signs it given the
+// right options, and returns its hash. Any options are followed by the commit command
+func gitCommit(repoDir string, env []string, message string, options ...string) plumbing.Hash {
+	if len(options) == 0 {
+		options = []string{"commit"}
+	}
+	args := append([]string{"-c", "user.name=Gonsul", "-c", "user.email=gonsul@example.com"}, options...)
+	runCommand(repoDir, env, "git", append(args, "--allow-empty", "-q", "-m", message)...)
+
+	return plumbing.NewHash(strings.TrimSpace(runCommand(repoDir, env, "git", "rev-parse", "HEAD")))
+}
+
+// tamperCommit stores a copy of the given commit with another message, keeping its signature
+func tamperCommit(repo *git.Repository, commitHash plumbing.Hash) plumbing.Hash {
+	encoded, err := repo.Storer.EncodedObject(plumbing.CommitObject, commitHash)
+	Expect(err).To(BeNil())
+	reader, err := encoded.Reader()
+	Expect(err).To(BeNil())
+	raw, err := ioutil.ReadAll(reader)
+	Expect(err).To(BeNil())
+	_ = reader.Close()
+
+	tampered := repo.Storer.NewEncodedObject()
+	tampered.SetType(plumbing.CommitObject)
+	writer, err := tampered.Writer()
+	Expect(err).To(BeNil())
+	_, err = writer.Write([]byte(strings.Replace(string(raw), "\nSigned\n", "\nTampered\n", 1)))
+	Expect(err).To(BeNil())
+	Expect(writer.Close()).To(BeNil())
+
+	tamperedHash, err := repo.Storer.SetEncodedObject(tampered)
+	Expect(err).To(BeNil())
+	Expect(tamperedHash).To(Not(Equal(commitHash)))
+
+	return tamperedHash
+}
+
+// runCommand runs the given command on a directory, failing on any error
+func runCommand(dir string, env []string, name string, args ...string) string {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	output, err := cmd.CombinedOutput()
+	Expect(err).To(BeNil(), string(output))
+
+	return string(output)
+}
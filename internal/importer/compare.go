@@ -0,0 +1,150 @@
+package importer
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// number is a canonical number, so semantic comparison tells numbers from strings
+type number string
+
+// normalize applies our normalization rules to a value, either local or live
+func (i *importer) normalize(value string) string {
+	if i.config.ShouldNormalize(config.NormalizeLineEndings) {
+		value = strings.Replace(value, "\r\n", "\n", -1)
+		value = strings.Replace(value, "\r", "\n", -1)
+	}
+	if i.config.ShouldNormalize(config.NormalizeTrailingNewline) {
+		value = strings.TrimRight(value, "\r\n")
+	}
+
+	return value
+}
+
+// isSameValue tells if a (normalized) local value matches the base64 encoded live one
+func (i *importer) isSameValue(localVal string, localValB64 string, liveValB64 string) bool {
+	if localValB64 == liveValB64 {
+		return true
+	}
+
+	// Bytes differ, but live values may only differ before being normalized
+	liveBytes, err := base64.StdEncoding.DecodeString(liveValB64)
+	if err != nil {
+		return false
+	}
+	liveVal := i.normalize(string(liveBytes))
+	if localVal == liveVal {
+		return true
+	}
+
+	return i.config.IsCompareSemantic() && semanticEqual(localVal, liveVal)
+}
+
+// semanticEqual tells if both values are JSON, or YAML, documents with the same content.
+// Only objects and arrays are compared this way, scalars are compared as written
+func semanticEqual(a string, b string) bool {
+	aJSON, aIsJSON := decodeJSONDocument(a)
+	bJSON, bIsJSON := decodeJSONDocument(b)
+	if aIsJSON || bIsJSON {
+		return aIsJSON && bIsJSON && reflect.DeepEqual(canonicalValue(aJSON), canonicalValue(bJSON))
+	}
+
+	aYAML, aIsYAML := decodeYAMLDocument(a)
+	bYAML, bIsYAML := decodeYAMLDocument(b)
+
+	return aIsYAML && bIsYAML && reflect.DeepEqual(canonicalValue(aYAML), canonicalValue(bYAML))
+}
+
+// decodeJSONDocument decodes a JSON object or array, telling if the value is one
+func decodeJSONDocument(value string) (interface{}, bool) {
+	var document interface{}
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return nil, false
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, false
+	}
+
+	return document, isCollection(document)
+}
+
+// decodeYAMLDocument decodes a single YAML mapping or sequence, telling if the value is one
+func decodeYAMLDocument(value string) (interface{}, bool) {
+	var document interface{}
+	decoder := yaml.NewDecoder(strings.NewReader(value))
+	if err := decoder.Decode(&document); err != nil {
+		return nil, false
+	}
+	var next interface{}
+	if err := decoder.Decode(&next); err != io.EOF {
+		return nil, false
+	}
+
+	return document, isCollection(document)
+}
+
+// isCollection tells if a decoded value is an object or an array
+func isCollection(value interface{}) bool {
+	switch value.(type) {
+	case map[string]interface{}, map[interface{}]interface{}, []interface{}:
+		return true
+	}
+
+	return false
+}
+
+// canonicalValue converts a decoded value so equal contents are deeply equal: numbers are
+// compared by their value (1.0 is 1) and mapping keys are strings
+func canonicalValue(value interface{}) interface{} {
+	switch value.(type) {
+	case map[string]interface{}:
+		canonical := map[string]interface{}{}
+		for key, child := range value.(map[string]interface{}) {
+			canonical[key] = canonicalValue(child)
+		}
+		return canonical
+
+	case map[interface{}]interface{}:
+		canonical := map[string]interface{}{}
+		for key, child := range value.(map[interface{}]interface{}) {
+			canonical[fmt.Sprint(key)] = canonicalValue(child)
+		}
+		return canonical
+
+	case []interface{}:
+		canonical := make([]interface{}, 0, len(value.([]interface{})))
+		for _, child := range value.([]interface{}) {
+			canonical = append(canonical, canonicalValue(child))
+		}
+		return canonical
+
+	case json.Number:
+		if rat, ok := new(big.Rat).SetString(value.(json.Number).String()); ok {
+			return number(rat.RatString())
+		}
+
+	case int, int64, uint64:
+		if rat, ok := new(big.Rat).SetString(fmt.Sprint(value)); ok {
+			return number(rat.RatString())
+		}
+
+	case float64:
+		// Infinities and NaN have no rational value, they're kept as they are
+		if rat := new(big.Rat).SetFloat64(value.(float64)); rat != nil {
+			return number(rat.RatString())
+		}
+	}
+
+	return value
+}
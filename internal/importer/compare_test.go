@@ -0,0 +1,52 @@
+package importer
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+	"github.com/miniclip/gonsul/tests/mocks"
+
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+
+	"encoding/base64"
+	"testing"
+)
+
+// compareConfig is the configuration our value comparison depends on
+func compareConfig(normalize map[string]bool, semantic bool) *mocks.IConfig {
+	cfg := &mocks.IConfig{}
+	cfg.On("ShouldNormalize", mock.Anything).Return(func(rule string) bool { return normalize[rule] })
+	cfg.On("IsCompareSemantic").Return(semantic)
+
+	return cfg
+}
+
+func TestIsSameValue(t *testing.T) {
+	RegisterTestingT(t)
+
+	isSame := func(i *importer, local string, live string) bool {
+		local = i.normalize(local)
+		return i.isSameValue(local, base64.StdEncoding.EncodeToString([]byte(local)), base64.StdEncoding.EncodeToString([]byte(live)))
+	}
+
+	// Byte for byte comparison by default
+	i := &importer{config: compareConfig(nil, false)}
+	Expect(isSame(i, "value", "value")).To(BeTrue())
+	Expect(isSame(i, "value\n", "value")).To(BeFalse())
+	Expect(isSame(i, `{"a": 1}`, `{"a":1}`)).To(BeFalse())
+
+	// Normalization applies to both sides
+	i = &importer{config: compareConfig(map[string]bool{config.NormalizeLineEndings: true, config.NormalizeTrailingNewline: true}, false)}
+	Expect(i.normalize("a\r\nb\r\n\n")).To(Equal("a\nb"))
+	Expect(isSame(i, "a\nb\n", "a\r\nb")).To(BeTrue())
+	Expect(isSame(i, "a\nb\n", "a b")).To(BeFalse())
+
+	// Semantic comparison of JSON and YAML documents
+	i = &importer{config: compareConfig(nil, true)}
+	Expect(isSame(i, "{\n  \"a\": 1.0,\n  \"b\": [true, null]\n}", `{"b":[true,null],"a":1}`)).To(BeTrue())
+	Expect(isSame(i, `{"a": 123456789012345678901}`, `{"a": 123456789012345678902}`)).To(BeFalse(), "Assert big numbers are compared exactly")
+	Expect(isSame(i, `{"a": 1}`, `{"a": "1"}`)).To(BeFalse(), "Assert numbers are not strings")
+	Expect(isSame(i, "b: [x, y]\na: 1 # comment\n", "a: 1\nb:\n  - x\n  - y\n")).To(BeTrue())
+	Expect(isSame(i, "a: 1\n", `{"a": 1}`)).To(BeFalse(), "Assert JSON is only compared to JSON")
+	Expect(isSame(i, "a: 1\n---\nb: 2\n", "a: 1\n")).To(BeFalse(), "Assert every YAML document is compared")
+	Expect(isSame(i, "1.0", "1")).To(BeFalse(), "Assert scalars are compared as written")
+}
@@ -0,0 +1,62 @@
+package importer
+
+import (
+	"github.com/miniclip/gonsul/internal/entities"
+	"github.com/miniclip/gonsul/internal/secrets"
+	"github.com/miniclip/gonsul/internal/util"
+
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// addEncrypted adds the operation writing an encrypted value, if any. Values are encrypted
+// again only if the live one holds another plaintext, or was encrypted with another key
+func (i *importer) addEncrypted(operations *entities.OperationMatrix, localKey string, localVal string, liveData map[string]string) {
+	encrypter := i.config.GetEncrypter()
+
+	liveVal, exists := liveData[localKey]
+	if exists {
+		liveBytes, err := base64.StdEncoding.DecodeString(liveVal)
+		if err == nil {
+			sealed, err := secrets.IsSealed(encrypter, string(liveBytes), localVal)
+			if sealed {
+				return
+			}
+			// Values we can't digest are sealed again, reporting why
+			if err != nil {
+				i.logger.PrintError(fmt.Sprintf("Encrypt: %s: could not compare with the live value, encrypting it again: %s", localKey, err.Error()))
+			}
+		}
+	}
+
+	sealed, err := secrets.Seal(encrypter, localVal)
+	if err != nil {
+		util.ExitError(errors.New(fmt.Sprintf("Encrypt: %s: %s", localKey, err.Error())), util.ErrorFailedEncryption, i.logger)
+	}
+	sealedB64 := base64.StdEncoding.EncodeToString([]byte(sealed))
+
+	if exists {
+		operations.AddUpdate(entities.Entry{KVPath: localKey, Value: sealedB64})
+	} else {
+		operations.AddInsert(entities.Entry{KVPath: localKey, Value: sealedB64})
+	}
+}
+
+// relativeKey returns the given key relative to our Consul KV base path
+func (i *importer) relativeKey(key string) string {
+	basePath := strings.Trim(i.config.GetConsulBasePath(), "/")
+	if basePath == "" {
+		return key
+	}
+
+	return strings.TrimPrefix(key, basePath+"/")
+}
+
+// hasPlaceholders tells if the given value has any secret placeholder
+func hasPlaceholders(value string) bool {
+	names, err := secrets.Placeholders(value)
+
+	return err == nil && len(names) > 0
+}
@@ -3,52 +3,80 @@ package importer
 import (
 	"strings"
 
+	"github.com/miniclip/gonsul/internal/config"
 	"github.com/miniclip/gonsul/internal/entities"
 	"github.com/miniclip/gonsul/internal/util"
 
-	"github.com/cbroglie/mustache"
 	"github.com/olekukonko/tablewriter"
 
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"os"
 	"path"
+	"sort"
 	"strconv"
 )
 
 // createOperationMatrix ...
-func (i *importer) createOperationMatrix(liveData map[string]string, localData map[string]string) entities.OperationMatrix {
-	// Set local error variable
+func (i *importer) createOperationMatrix(liveData map[string]string, localData map[string]string, skippedKeys map[string]bool, emptyKeys map[string]bool) entities.OperationMatrix {
+	// Set local error variable, and the keys we failed to render
 	var err error
+	var renderErrors []string
 	// Create our Operations array
 	var operations = entities.NewOperationsMatrix()
 
+	// Our sync state would be overwritten by any key exported as it, refuse to go on
+	stateKey := i.getStateKey()
+	if _, exported := localData[stateKey]; exported && stateKey != "" {
+		util.ExitError(errors.New("ImportState: key exported as our sync state key: "+stateKey), util.ErrorInvalidKey, i.logger)
+	}
+
+	// Secrets may have been replaced on files already, by our exporter
+	doSecrets := i.config.DoSecrets() && i.config.GetSecretsStage() == config.SecretsStageImport
+
 	// Check for updates or inserts
 	for localKey, localVal := range localData {
-		// Make sure we do not have an empty value (Consul KV will not have it)
-		if localVal == "" {
+		// Make sure we do not have an empty value (Consul KV will not have it), unless
+		// it's written empty on purpose (null values, with --expand-nulls=empty)
+		if localVal == "" && !emptyKeys[localKey] {
 			continue
 		}
 
-		// Shall we run secret replacement
-		if i.config.DoSecrets() {
-			localVal, err = mustache.Render(localVal, i.config.GetSecretsMap())
+		// Values rendered from secrets may be written encrypted
+		fromSecrets := doSecrets && hasPlaceholders(localVal)
+		// Shall we run secret replacement, strictly refusing placeholders we can't replace
+		if doSecrets && i.config.IsSecretsStrict() {
+			renderErrors = append(renderErrors, i.checkPlaceholders(localKey, localVal)...)
+		}
+		if doSecrets {
+			localVal, err = i.config.GetSecrets().Render(localVal)
 		}
 		if err != nil {
-			util.ExitError(errors.New("MustacheRender: "+err.Error()), util.ErrorFailedMustache, i.logger)
+			// Keep going, so every broken key is reported at once
+			renderErrors = append(renderErrors, fmt.Sprintf("MustacheRender: %s: %s", localKey, err.Error()))
+			err = nil
+			continue
+		}
+
+		// Normalize and Base64 encode local value, what we compare is what we write
+		localVal = i.normalize(localVal)
+
+		// Encrypted values are compared by the plaintext they hold, instead
+		if i.config.ShouldEncrypt(i.relativeKey(localKey), fromSecrets) {
+			i.addEncrypted(&operations, localKey, localVal, liveData)
+			continue
 		}
 
-		// Base64 encode local value
 		localValB64 := base64.StdEncoding.EncodeToString([]byte(localVal))
 
 		// Does the current local KV key (path) exists in live?
 		if liveVal, ok := liveData[localKey]; ok {
 			// it does, is it different value?
-			if localValB64 != liveVal {
+			if !i.isSameValue(localVal, localValB64, liveVal) {
 				// Gentleman we have an update
 				operations.AddUpdate(entities.Entry{KVPath: localKey, Value: localValB64})
 			}
@@ -58,9 +86,31 @@ func (i *importer) createOperationMatrix(liveData map[string]string, localData m
 		}
 	}
 
+	// Secrets nobody uses are most likely typos of the placeholders we just refused
+	if doSecrets && i.config.IsSecretsStrict() {
+		values := make([]string, 0, len(localData))
+		for _, value := range localData {
+			values = append(values, value)
+		}
+		for _, name := range i.config.GetSecrets().Unused(values) {
+			renderErrors = append(renderErrors, fmt.Sprintf("MustacheRender: unused secret: %s", name))
+		}
+	}
+
+	if len(renderErrors) > 0 {
+		sort.Strings(renderErrors)
+		for _, renderError := range renderErrors {
+			i.logger.PrintError(renderError)
+		}
+		util.ExitError(errors.New(fmt.Sprintf("MustacheRender: %d errors found", len(renderErrors))), util.ErrorFailedMustache, i.logger)
+	}
+
 	// Now check for deletes
-	// Check for deletes
+	// Check for deletes (our sync state and skipped keys are never exported, but they're not to be deleted either)
 	for liveKey := range liveData {
+		if liveKey == stateKey || skippedKeys[liveKey] {
+			continue
+		}
 		if _, ok := localData[liveKey]; !ok && i.config.AllowDeletes() != "skip" {
 			// Not found in local - DELETE
 			operations.AddDelete(entities.Entry{KVPath: liveKey, Value: ""})
@@ -70,6 +120,22 @@ func (i *importer) createOperationMatrix(liveData map[string]string, localData m
 	return operations
 }
 
+// checkPlaceholders returns an error for each placeholder of the given value none of our secrets resolve
+func (i *importer) checkPlaceholders(localKey string, localVal string) []string {
+	missing, err := i.config.GetSecrets().Missing(localVal)
+	if err != nil {
+		// Broken templates are reported when rendered
+		return nil
+	}
+
+	var renderErrors []string
+	for _, name := range missing {
+		renderErrors = append(renderErrors, fmt.Sprintf("MustacheRender: %s: unknown secret placeholder: %s", localKey, name))
+	}
+
+	return renderErrors
+}
+
 // createLiveData ...
 func (i *importer) createLiveData() map[string]string {
 	// Create some local variables
@@ -146,8 +212,9 @@ func (i *importer) printOperations(matrix entities.OperationMatrix, printWhat st
 	fmt.Println()
 	// Let's make sure there are any operation
 	if matrix.GetTotalOps() > 0 {
-		// Instantiate our table and set table header
-		table := tablewriter.NewWriter(os.Stdout)
+		// Instantiate our table and set table header, it's redacted before being printed
+		output := &bytes.Buffer{}
+		table := tablewriter.NewWriter(output)
 		table.SetHeader([]string{"", "BATCH", "OP INDEX", "OPERATION NAME", "CONSUL VERB", "PATH"})
 		// Align our rows
 		table.SetAlignment(tablewriter.ALIGN_LEFT)
@@ -202,6 +269,7 @@ func (i *importer) printOperations(matrix entities.OperationMatrix, printWhat st
 		}
 		// Outputs ASCII table
 		table.Render()
+		fmt.Print(i.logger.Redact(output.String()))
 	} else {
 		i.logger.PrintInfo("No operations to process, all synced")
 	}
@@ -0,0 +1,131 @@
+package importer
+
+import (
+	"github.com/miniclip/gonsul/internal/config"
+	"github.com/miniclip/gonsul/internal/secrets"
+	"github.com/miniclip/gonsul/internal/util"
+	"github.com/miniclip/gonsul/tests/mocks"
+
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// secretsConfig is the configuration our secret replacement depends on
+func secretsConfig(values secrets.ISecrets, strict bool, encrypter secrets.IEncrypter) *mocks.IConfig {
+	cfg := compareConfig(nil, false)
+	cfg.On("DoSecrets").Return(true)
+	cfg.On("IsSecretsStrict").Return(strict)
+	cfg.On("GetSecretsStage").Return(config.SecretsStageImport)
+	cfg.On("GetSecrets").Return(values)
+	cfg.On("GetConsulStateKey").Return("")
+	cfg.On("AllowDeletes").Return("false")
+	cfg.On("GetConsulBasePath").Return("base")
+	cfg.On("GetEncrypter").Return(encrypter)
+	cfg.On("ShouldEncrypt", mock.Anything, mock.Anything).Return(func(key string, fromSecrets bool) bool {
+		return encrypter != nil && (fromSecrets || key == "app/plain")
+	})
+
+	return cfg
+}
+
+// fakeEncrypter "encrypts" values by reversing them, counting how many it encrypted
+type fakeEncrypter struct {
+	id        string
+	encrypted int
+}
+
+func (e *fakeEncrypter) ID() string { return e.id }
+func (e *fakeEncrypter) Encrypt(plaintext string) (string, error) {
+	e.encrypted++
+	reversed := []rune(plaintext)
+	for left, right := 0, len(reversed)-1; left < right; left, right = left+1, right-1 {
+		reversed[left], reversed[right] = reversed[right], reversed[left]
+	}
+	return string(reversed), nil
+}
+func (e *fakeEncrypter) Digest(salt []byte, plaintext string) (string, error) {
+	return base64.RawStdEncoding.EncodeToString(append(append([]byte(e.id+":"), salt...), plaintext...)), nil
+}
+
+func TestCreateOperationMatrix_SecretsStrict(t *testing.T) {
+	RegisterTestingT(t)
+
+	localData := map[string]string{"app/db": "{{db-user}}:{{db-pass}}", "app/token": "{{tokn}}"}
+	values := map[string]string{"db-pass": "s3cr3t", "token": "t0k3n"}
+
+	// Unknown placeholders are written empty by default
+	logger := &mocks.ILogger{}
+	i := &importer{config: secretsConfig(secrets.NewSecrets(values, nil), false, nil), logger: logger}
+	operations := i.createOperationMatrix(map[string]string{}, localData, map[string]bool{}, map[string]bool{})
+	Expect(operations.GetTotalInserts()).To(Equal(2))
+
+	// Strictly, every unknown placeholder and unused secret is reported before any write
+	logger.On("PrintError", mock.Anything).Return()
+	i = &importer{config: secretsConfig(secrets.NewSecrets(values, nil), true, nil), logger: logger}
+	Expect(func() {
+		i.createOperationMatrix(map[string]string{}, localData, map[string]bool{}, map[string]bool{})
+	}).To(PanicWith(util.GonsulError{Code: util.ErrorFailedMustache}))
+	logger.AssertCalled(t, "PrintError", "MustacheRender: app/db: unknown secret placeholder: db-user")
+	logger.AssertCalled(t, "PrintError", "MustacheRender: app/token: unknown secret placeholder: tokn")
+	logger.AssertCalled(t, "PrintError", "MustacheRender: unused secret: token")
+}
+
+func TestCreateOperationMatrix_Encrypted(t *testing.T) {
+	RegisterTestingT(t)
+
+	localData := map[string]string{"base/app/db": "{{db-pass}}", "base/app/plain": "visible", "base/app/other": "clear"}
+	values := map[string]string{"db-pass": "s3cr3t"}
+	encrypter := &fakeEncrypter{id: "key-1"}
+	i := &importer{config: secretsConfig(secrets.NewSecrets(values, nil), false, encrypter), logger: &mocks.ILogger{}}
+
+	// Values from secrets and matching keys are written sealed, with their plaintext hash
+	operations := i.createOperationMatrix(map[string]string{}, localData, map[string]bool{}, map[string]bool{})
+	Expect(operations.GetTotalInserts()).To(Equal(3))
+	liveData := map[string]string{}
+	for _, op := range operations.GetOperations() {
+		liveData[op.GetPath()] = op.GetValue()
+	}
+	sealed, _ := base64.StdEncoding.DecodeString(liveData["base/app/db"])
+	Expect(strings.SplitN(string(sealed), "\n", 2)[1]).To(Equal("t3rc3s"))
+	Expect(secrets.IsSealed(encrypter, string(sealed), "s3cr3t")).To(BeTrue())
+	Expect(liveData["base/app/other"]).To(Equal(base64.StdEncoding.EncodeToString([]byte("clear"))))
+
+	// Sealed values are only encrypted again when their plaintext or key change
+	operations = i.createOperationMatrix(liveData, localData, map[string]bool{}, map[string]bool{})
+	Expect(operations.GetTotalOps()).To(Equal(0))
+	Expect(encrypter.encrypted).To(Equal(2))
+
+	localData["base/app/plain"] = "changed"
+	operations = i.createOperationMatrix(liveData, localData, map[string]bool{}, map[string]bool{})
+	Expect(operations.GetTotalUpdates()).To(Equal(1))
+
+	encrypter.id = "key-2"
+	operations = i.createOperationMatrix(liveData, localData, map[string]bool{}, map[string]bool{})
+	Expect(operations.GetTotalUpdates()).To(Equal(2))
+}
+
+func TestCreateOperationMatrix_EmptyValues(t *testing.T) {
+	RegisterTestingT(t)
+
+	cfg := &mocks.IConfig{}
+	cfg.On("DoSecrets").Return(false)
+	cfg.On("ShouldNormalize", mock.Anything).Return(false)
+	cfg.On("IsCompareSemantic").Return(false)
+	cfg.On("GetConsulBasePath").Return("")
+	cfg.On("GetConsulStateKey").Return("")
+	cfg.On("ShouldEncrypt", mock.Anything, false).Return(false)
+	cfg.On("AllowDeletes").Return("skip")
+	i := &importer{config: cfg}
+
+	// Empty values are not written, unless they're written empty on purpose
+	localData := map[string]string{"app/empty": "", "app/null": "", "app/name": "web"}
+	operations := i.createOperationMatrix(map[string]string{}, localData, map[string]bool{}, map[string]bool{"app/null": true})
+	Expect(operations.GetTotalInserts()).To(Equal(2))
+	for _, op := range operations.GetOperations() {
+		Expect(op.GetPath()).To(Not(Equal("app/empty")))
+	}
+}
@@ -12,23 +12,25 @@ import (
 
 // IImporter ...
 type IImporter interface {
-	Start(localData map[string]string)
+	Start(localData map[string]string, skippedKeys map[string]bool, emptyKeys map[string]bool, commits []entities.CommitInfo)
+	GetSyncedCommits() []entities.CommitInfo
 }
 
 // importer ...
 type importer struct {
-	config config.IConfig
-	logger util.ILogger
-	client *http.Client
+	config  config.IConfig
+	logger  util.ILogger
+	client  *http.Client
+	version string
 }
 
 // NewImporter
-func NewImporter(config config.IConfig, logger util.ILogger, client *http.Client) IImporter {
-	return &importer{config: config, logger: logger, client: client}
+func NewImporter(config config.IConfig, logger util.ILogger, client *http.Client, version string) IImporter {
+	return &importer{config: config, logger: logger, client: client, version: version}
 }
 
 // Start ...
-func (i *importer) Start(localData map[string]string) {
+func (i *importer) Start(localData map[string]string, skippedKeys map[string]bool, emptyKeys map[string]bool, commits []entities.CommitInfo) {
 
 	// Create some local variables
 	var ops entities.OperationMatrix
@@ -38,7 +40,7 @@ func (i *importer) Start(localData map[string]string) {
 	liveData = i.createLiveData()
 
 	// Create our operations Matrix
-	ops = i.createOperationMatrix(liveData, localData)
+	ops = i.createOperationMatrix(liveData, localData, skippedKeys, emptyKeys)
 
 	// Print operation table
 	i.printOperations(ops, entities.OperationAll)
@@ -48,14 +50,14 @@ func (i *importer) Start(localData map[string]string) {
 		return
 	}
 
-	// Process our operations matrix
-	i.processOperations(ops)
+	// Process our operations matrix, along with our sync state (if needed)
+	i.processOperations(ops, i.createState(liveData, ops, commits))
 
 	// Print result summary
 	i.logger.PrintInfo(fmt.Sprintf("Finished: %d Inserts, %d Updates %d Deletes", ops.GetTotalInserts(), ops.GetTotalUpdates(), ops.GetTotalDeletes()))
 }
 
-func (i *importer) processOperations(matrix entities.OperationMatrix) {
+func (i *importer) processOperations(matrix entities.OperationMatrix, state *entities.Entry) {
 	// Did we got any deletes and are we allowed to delete them?
 	if i.config.AllowDeletes() == "false" && matrix.HasDeletes() {
 		// We're not supposed to trigger Consul deletes, output report and exit with error
@@ -80,22 +82,8 @@ func (i *importer) processOperations(matrix entities.OperationMatrix) {
 	// Fill our channel to indicate a non interruptible work (It stops here if interruption in progress)
 	i.config.WorkingChan() <- true
 
-	// Loop each operation
-	for _, op := range matrix.GetOperations() {
-		// We need to get the values to use pointers for our structure
-		// so we can clearly identify nil values, as in https://willnorris.com/2014/05/go-rest-apis-and-pointers
-		verb := op.GetVerb()
-		path := op.GetPath()
-
-		var TxnKV entities.ConsulTxnKV
-
-		if op.GetType() == entities.OperationDelete {
-			TxnKV = entities.ConsulTxnKV{Verb: &verb, Key: &path}
-		} else {
-			val := op.GetValue()
-			TxnKV = entities.ConsulTxnKV{Verb: &verb, Key: &path, Value: &val}
-		}
-
+	// addTransaction adds a transaction to our current batch, processing the batch first if full
+	addTransaction := func(TxnKV entities.ConsulTxnKV) {
 		// add the next transaction and check payload lenght
 		newTransactions = transactions
 		newTransactions = append(transactions, entities.ConsulTxn{KV: TxnKV})
@@ -111,6 +99,27 @@ func (i *importer) processOperations(matrix entities.OperationMatrix) {
 		transactions = append(transactions, entities.ConsulTxn{KV: TxnKV})
 	}
 
+	// Loop each operation
+	for _, op := range matrix.GetOperations() {
+		// We need to get the values to use pointers for our structure
+		// so we can clearly identify nil values, as in https://willnorris.com/2014/05/go-rest-apis-and-pointers
+		verb := op.GetVerb()
+		path := op.GetPath()
+
+		if op.GetType() == entities.OperationDelete {
+			addTransaction(entities.ConsulTxnKV{Verb: &verb, Key: &path})
+		} else {
+			val := op.GetValue()
+			addTransaction(entities.ConsulTxnKV{Verb: &verb, Key: &path, Value: &val})
+		}
+	}
+
+	// Our sync state always goes last, so it's written on the final transaction
+	if state != nil {
+		verb := "set"
+		addTransaction(entities.ConsulTxnKV{Verb: &verb, Key: &state.KVPath, Value: &state.Value})
+	}
+
 	// Do we have transactions to process
 	if len(transactions) > 0 {
 		i.processConsulTransaction(transactions, batch)
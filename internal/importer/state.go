@@ -0,0 +1,127 @@
+package importer
+
+import (
+	"github.com/miniclip/gonsul/internal/entities"
+	"github.com/miniclip/gonsul/internal/util"
+
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// getStateKey returns the full Consul KV path of our sync state, empty if disabled
+func (i *importer) getStateKey() string {
+	if i.config.GetConsulStateKey() == "" {
+		return ""
+	}
+
+	return path.Join(i.config.GetConsulBasePath(), i.config.GetConsulStateKey())
+}
+
+// createState builds our sync state entry. It returns nil if we're not writing a state, or
+// if there is nothing to sync and the live state already describes the exported commits
+func (i *importer) createState(liveData map[string]string, matrix entities.OperationMatrix, commits []entities.CommitInfo) *entities.Entry {
+	stateKey := i.getStateKey()
+	if stateKey == "" {
+		return nil
+	}
+
+	if matrix.GetTotalOps() == 0 && i.isLiveStateCurrent(liveData[stateKey], commits) {
+		return nil
+	}
+
+	state := entities.SyncState{
+		Commits:  commits,
+		Version:  i.version,
+		SyncedAt: time.Now().UTC().Format(time.RFC3339),
+		Inserts:  matrix.GetTotalInserts(),
+		Updates:  matrix.GetTotalUpdates(),
+		Deletes:  matrix.GetTotalDeletes(),
+	}
+
+	// Humans read this one too, do not escape author emails brackets
+	var payload bytes.Buffer
+	encoder := json.NewEncoder(&payload)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(state); err != nil {
+		util.ExitError(errors.New("MarshalState: "+err.Error()), util.ErrorFailedJsonEncode, i.logger)
+	}
+
+	return &entities.Entry{KVPath: stateKey, Value: base64.StdEncoding.EncodeToString(payload.Bytes())}
+}
+
+// isLiveStateCurrent tells if the given (base64 encoded) live state was written
+// by this Gonsul version for the exact same commits
+func (i *importer) isLiveStateCurrent(liveState string, commits []entities.CommitInfo) bool {
+	payload, err := base64.StdEncoding.DecodeString(liveState)
+	if err != nil || len(payload) == 0 {
+		return false
+	}
+
+	var state entities.SyncState
+	if err := json.Unmarshal(payload, &state); err != nil {
+		return false
+	}
+
+	return state.Version == i.version && reflect.DeepEqual(state.Commits, commits)
+}
+
+// GetSyncedCommits returns the commits of our last sync, as written on our live sync state.
+// It returns nil if we're not writing a state, or if there is no (valid) live state yet
+func (i *importer) GetSyncedCommits() []entities.CommitInfo {
+	stateKey := i.getStateKey()
+	if stateKey == "" {
+		return nil
+	}
+
+	hostname := strings.TrimSuffix(i.config.GetConsulURL(), "/")
+	req, err := http.NewRequest("GET", hostname+"/"+path.Join("v1", "kv", stateKey)+"?raw=true", nil)
+	if err != nil {
+		util.ExitError(errors.New("NewRequestGET: "+err.Error()), util.ErrorFailedConsulConnection, i.logger)
+	}
+
+	// Set ACL token (if given)
+	if i.config.GetConsulACL() != "" {
+		req.Header.Set("X-Consul-Token", i.config.GetConsulACL())
+	}
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		util.ExitError(errors.New("DoGET: "+err.Error()), util.ErrorFailedConsulConnection, i.logger)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			i.logger.PrintError("Could not close Consul http body")
+		}
+	}()
+
+	// No state yet, we never synced
+	if resp.StatusCode == 404 {
+		return nil
+	}
+
+	if resp.StatusCode >= 400 {
+		util.ExitError(errors.New("Invalid response from consul: "+resp.Status), util.ErrorFailedConsulConnection, i.logger)
+	}
+
+	payload, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		util.ExitError(errors.New("ReadGetResponse: "+err.Error()), util.ErrorFailedReadingResponse, i.logger)
+	}
+
+	// A state we cannot read is as good as no state, we'll verify from the trust anchor (or the beginning)
+	var state entities.SyncState
+	if err := json.Unmarshal(payload, &state); err != nil {
+		i.logger.PrintInfo("IMPORTER: ignoring invalid sync state at " + stateKey + ": " + err.Error())
+		return nil
+	}
+
+	return state.Commits
+}
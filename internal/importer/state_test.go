@@ -0,0 +1,122 @@
+package importer
+
+import (
+	"github.com/miniclip/gonsul/internal/entities"
+	"github.com/miniclip/gonsul/internal/util"
+	"github.com/miniclip/gonsul/tests/mocks"
+
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCreateState(t *testing.T) {
+	RegisterTestingT(t)
+
+	cfg := &mocks.IConfig{}
+	cfg.On("GetConsulBasePath").Return("base")
+	cfg.On("GetConsulStateKey").Return("_gonsul/state")
+	i := &importer{config: cfg, logger: &mocks.ILogger{}, version: "v1.2.0"}
+	commits := []entities.CommitInfo{{Mount: "default", SHA: "45a81b9041cfaff50b8da101579dd3cf15f6b3c2", Author: "Jane <jane@example.com>"}}
+
+	// Any sync writes our state, describing the commits and operations
+	matrix := entities.NewOperationsMatrix()
+	matrix.AddInsert(entities.Entry{KVPath: "base/app", Value: "dmFsdWU="})
+	entry := i.createState(map[string]string{}, matrix, commits)
+	Expect(entry).To(Not(BeNil()))
+	Expect(entry.KVPath).To(Equal("base/_gonsul/state"))
+	payload, _ := base64.StdEncoding.DecodeString(entry.Value)
+	Expect(string(payload)).To(ContainSubstring(`"author":"Jane <jane@example.com>"`), "Assert emails are not escaped")
+	var state entities.SyncState
+	Expect(json.Unmarshal(payload, &state)).To(BeNil())
+	Expect(state.Commits).To(Equal(commits))
+	Expect(state.Version).To(Equal("v1.2.0"))
+	Expect(state.Inserts).To(Equal(1))
+
+	// Without operations, a live state of the same commits and version is left as it is
+	liveData := map[string]string{"base/_gonsul/state": entry.Value}
+	Expect(i.createState(liveData, entities.NewOperationsMatrix(), commits)).To(BeNil())
+	Expect(i.isLiveStateCurrent(entry.Value, commits)).To(BeTrue())
+
+	// But other commits, another version or a broken live state are written again
+	other := []entities.CommitInfo{{Mount: "default", SHA: "4b825dc642cb6eb9a060e54bf8d69288fbee4904"}}
+	Expect(i.createState(liveData, entities.NewOperationsMatrix(), other)).To(Not(BeNil()))
+	Expect(i.isLiveStateCurrent(entry.Value, other)).To(BeFalse())
+	Expect((&importer{config: cfg, version: "v1.3.0"}).isLiveStateCurrent(entry.Value, commits)).To(BeFalse())
+	Expect(i.isLiveStateCurrent("not base64", commits)).To(BeFalse())
+	Expect(i.isLiveStateCurrent(base64.StdEncoding.EncodeToString([]byte("{broken")), commits)).To(BeFalse())
+	Expect(i.isLiveStateCurrent("", commits)).To(BeFalse())
+
+	// No state key, no state
+	cfg = &mocks.IConfig{}
+	cfg.On("GetConsulStateKey").Return("")
+	i = &importer{config: cfg, version: "v1.2.0"}
+	Expect(i.createState(map[string]string{}, matrix, commits)).To(BeNil())
+}
+
+func TestGetSyncedCommits(t *testing.T) {
+	RegisterTestingT(t)
+
+	commits := []entities.CommitInfo{{Mount: "default", SHA: "45a81b9041cfaff50b8da101579dd3cf15f6b3c2"}}
+	payload, _ := json.Marshal(entities.SyncState{Commits: commits, Version: "v1.2.0"})
+	live := map[string]string{"/v1/kv/base/_gonsul/state": string(payload), "/v1/kv/broken/_gonsul/state": "{broken"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value, ok := live[r.URL.Path]
+		if !ok || r.URL.Query().Get("raw") != "true" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(value))
+	}))
+	defer server.Close()
+
+	logger := &mocks.ILogger{}
+	logger.On("PrintInfo", mock.Anything).Return()
+	stateConfig := func(basePath string) *mocks.IConfig {
+		cfg := &mocks.IConfig{}
+		cfg.On("GetConsulURL").Return(server.URL)
+		cfg.On("GetConsulACL").Return("")
+		cfg.On("GetConsulBasePath").Return(basePath)
+		cfg.On("GetConsulStateKey").Return("_gonsul/state")
+		return cfg
+	}
+
+	// Our live state tells the commits of the last sync
+	i := &importer{config: stateConfig("base"), logger: logger, client: server.Client()}
+	Expect(i.GetSyncedCommits()).To(Equal(commits))
+
+	// No live state, or one we cannot read, means we never synced
+	i = &importer{config: stateConfig("other"), logger: logger, client: server.Client()}
+	Expect(i.GetSyncedCommits()).To(BeNil())
+	i = &importer{config: stateConfig("broken"), logger: logger, client: server.Client()}
+	Expect(i.GetSyncedCommits()).To(BeNil())
+
+	// No state key, no state
+	cfg := &mocks.IConfig{}
+	cfg.On("GetConsulStateKey").Return("")
+	i = &importer{config: cfg, logger: logger, client: server.Client()}
+	Expect(i.GetSyncedCommits()).To(BeNil())
+}
+
+func TestCreateOperationMatrix_StateKeyExported(t *testing.T) {
+	RegisterTestingT(t)
+
+	cfg := &mocks.IConfig{}
+	cfg.On("GetConsulBasePath").Return("base")
+	cfg.On("GetConsulStateKey").Return("_gonsul/state")
+	logger := &mocks.ILogger{}
+	logger.On("PrintError", mock.Anything).Return()
+	i := &importer{config: cfg, logger: logger}
+
+	// A file exporting our state key would have it overwritten on each sync
+	localData := map[string]string{"base/_gonsul/state": "{}", "base/app": "value"}
+	Expect(func() {
+		i.createOperationMatrix(map[string]string{}, localData, map[string]bool{}, map[string]bool{})
+	}).To(PanicWith(util.GonsulError{Code: util.ErrorInvalidKey}))
+	logger.AssertCalled(t, "PrintError", "ImportState: key exported as our sync state key: base/_gonsul/state")
+}
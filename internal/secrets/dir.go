@@ -0,0 +1,45 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// dirProvider serves secrets from the files of a directory, one secret per file, such
+// as Kubernetes secrets mounted as volumes
+type dirProvider struct {
+	directory string
+}
+
+// NewDirProvider serves {{dir.name}} placeholders from the content of the file directory/name
+func NewDirProvider(directory string) IProvider {
+	return &dirProvider{directory: directory}
+}
+
+// Get ...
+func (p *dirProvider) Get(key string) (string, bool, error) {
+	// Placeholders can't read anything outside our directory
+	if key == "" || path.IsAbs(key) || path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") {
+		return "", false, errors.New(fmt.Sprintf("invalid secret file name: %s", key))
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(p.directory, filepath.FromSlash(key)))
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	return string(content), true, nil
+}
+
+// Reset ...
+func (p *dirProvider) Reset() {
+	// There is nothing cached, we always read the latest
+}
@@ -0,0 +1,267 @@
+package secrets
+
+import (
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"golang.org/x/crypto/argon2"
+
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// sealedPrefix starts the first line of our sealed values, the ciphertext being on the next lines.
+// Values sealed by v1, with a plain salted hash, are never matched so they're sealed again
+const sealedPrefix = "gonsul:enc:v2:"
+
+// Our age digests are argon2id ones, as costly as RFC 9106 recommends when memory is constrained
+const ageDigestTime = 3
+const ageDigestMemory = 64 * 1024
+const ageDigestThreads = 4
+
+// IEncrypter encrypts values before they're written to Consul
+type IEncrypter interface {
+	// ID identifies the key values are encrypted with, so values are encrypted again if it changes
+	ID() string
+	// Encrypt encrypts the given plaintext, as text
+	Encrypt(plaintext string) (string, error)
+	// Digest returns a digest of the given salted plaintext, keyed by the encryption key or
+	// costly enough that guesses of the plaintext can't be checked against it at scale
+	Digest(salt []byte, plaintext string) (string, error)
+}
+
+// digestCache keeps the digests we computed for the process lifetime: they're costly on purpose,
+// while the same ones are computed for every encrypted key on each run
+type digestCache struct {
+	mutex   sync.Mutex
+	digests map[[sha256.Size]byte]string
+}
+
+// get returns the digest of the given salted plaintext, computing it only if we never did
+func (c *digestCache) get(salt []byte, plaintext string, compute func() (string, error)) (string, error) {
+	// Plaintexts are not kept, only a hash of them along with their salt
+	hash := sha256.New()
+	_, _ = fmt.Fprintf(hash, "%d:", len(salt))
+	hash.Write(salt)
+	hash.Write([]byte(plaintext))
+	var key [sha256.Size]byte
+	copy(key[:], hash.Sum(nil))
+
+	c.mutex.Lock()
+	digest, ok := c.digests[key]
+	c.mutex.Unlock()
+	if ok {
+		return digest, nil
+	}
+
+	digest, err := compute()
+	if err != nil {
+		return "", err
+	}
+
+	c.mutex.Lock()
+	if c.digests == nil {
+		c.digests = map[[sha256.Size]byte]string{}
+	}
+	c.digests[key] = digest
+	c.mutex.Unlock()
+
+	return digest, nil
+}
+
+// ageEncrypter encrypts values to an age X25519 recipient
+type ageEncrypter struct {
+	recipient *age.X25519Recipient
+	digests   digestCache
+}
+
+// NewAgeEncrypter encrypts values to the given age X25519 recipient (age1...), as armored age files
+func NewAgeEncrypter(recipient string) (IEncrypter, error) {
+	parsed, err := age.ParseX25519Recipient(recipient)
+	if err != nil {
+		return nil, errors.New("invalid age recipient: " + err.Error())
+	}
+
+	return &ageEncrypter{recipient: parsed}, nil
+}
+
+// ID ...
+func (e *ageEncrypter) ID() string {
+	return "age:" + e.recipient.String()
+}
+
+// Encrypt ...
+func (e *ageEncrypter) Encrypt(plaintext string) (string, error) {
+	encrypted := &bytes.Buffer{}
+	armored := armor.NewWriter(encrypted)
+	writer, err := age.Encrypt(armored, e.recipient)
+	if err != nil {
+		return "", err
+	}
+	if _, err := writer.Write([]byte(plaintext)); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+	if err := armored.Close(); err != nil {
+		return "", err
+	}
+
+	return encrypted.String(), nil
+}
+
+// Digest only has a public key to work with, so it makes each guess costly instead
+func (e *ageEncrypter) Digest(salt []byte, plaintext string) (string, error) {
+	return e.digests.get(salt, plaintext, func() (string, error) {
+		digest := argon2.IDKey([]byte(e.ID()+"\x00"+plaintext), salt, ageDigestTime, ageDigestMemory, ageDigestThreads, 32)
+
+		return base64.RawStdEncoding.EncodeToString(digest), nil
+	})
+}
+
+// vaultTransitEncrypter encrypts values with a Vault transit secrets engine key
+type vaultTransitEncrypter struct {
+	address string
+	token   string
+	mount   string
+	key     string
+	client  *http.Client
+	digests digestCache
+}
+
+// NewVaultTransitEncrypter encrypts values with the given Vault transit key, written as mount/key
+// (transit/gonsul), as Vault ciphertexts (vault:v1:...)
+func NewVaultTransitEncrypter(address string, token string, transitKey string, client *http.Client) (IEncrypter, error) {
+	transitKey = strings.Trim(transitKey, "/")
+	separator := strings.LastIndex(transitKey, "/")
+	if separator <= 0 {
+		return nil, errors.New(fmt.Sprintf("invalid Vault transit key (%s), must be: mount/key", transitKey))
+	}
+
+	return &vaultTransitEncrypter{
+		address: strings.TrimSuffix(address, "/"),
+		token:   token,
+		mount:   transitKey[:separator],
+		key:     transitKey[separator+1:],
+		client:  client,
+	}, nil
+}
+
+// ID ...
+func (e *vaultTransitEncrypter) ID() string {
+	return "vault:" + e.address + "/" + e.mount + "/" + e.key
+}
+
+// Encrypt ...
+func (e *vaultTransitEncrypter) Encrypt(plaintext string) (string, error) {
+	return e.post("encrypt", map[string]string{"plaintext": base64.StdEncoding.EncodeToString([]byte(plaintext))}, "ciphertext")
+}
+
+// Digest is an HMAC of our transit key, which never leaves Vault
+func (e *vaultTransitEncrypter) Digest(salt []byte, plaintext string) (string, error) {
+	return e.digests.get(salt, plaintext, func() (string, error) {
+		input := append(append([]byte{}, salt...), plaintext...)
+
+		return e.post("hmac", map[string]string{"input": base64.StdEncoding.EncodeToString(input)}, "hmac")
+	})
+}
+
+// post calls the given endpoint of our transit key, returning the given field of its response
+func (e *vaultTransitEncrypter) post(endpoint string, request map[string]string, field string) (string, error) {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("POST", e.address+"/v1/"+e.mount+"/"+endpoint+"/"+e.key, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	if e.token != "" {
+		req.Header.Set("X-Vault-Token", e.token)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode >= 400 {
+		return "", errors.New(fmt.Sprintf("invalid response from Vault calling %s with %s/%s: %s", endpoint, e.mount, e.key, resp.Status))
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	var response struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", errors.New(fmt.Sprintf("could not parse Vault response calling %s with %s/%s", endpoint, e.mount, e.key))
+	}
+	value, _ := response.Data[field].(string)
+	if value == "" {
+		return "", errors.New(fmt.Sprintf("could not parse Vault response calling %s with %s/%s", endpoint, e.mount, e.key))
+	}
+
+	return value, nil
+}
+
+// Seal encrypts a value with the given encrypter. The sealed value starts with a line holding
+// a salted digest of the plaintext, so it's compared without decrypting it: gonsul:enc:v2:salt:digest
+func Seal(encrypter IEncrypter, plaintext string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	digest, err := encrypter.Digest(salt, plaintext)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := encrypter.Encrypt(plaintext)
+	if err != nil {
+		return "", err
+	}
+
+	encodedSalt := base64.RawStdEncoding.EncodeToString(salt)
+
+	return sealedPrefix + encodedSalt + ":" + digest + "\n" + ciphertext, nil
+}
+
+// IsSealed tells if the given sealed value holds the given plaintext, encrypted by the given encrypter.
+// It returns an error if the plaintext couldn't be digested, the value not being sealed as far as we know
+func IsSealed(encrypter IEncrypter, sealed string, plaintext string) (bool, error) {
+	if !strings.HasPrefix(sealed, sealedPrefix) {
+		return false, nil
+	}
+
+	header := strings.SplitN(strings.SplitN(sealed, "\n", 2)[0], ":", 5)
+	if len(header) != 5 {
+		return false, nil
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(header[3])
+	if err != nil {
+		return false, nil
+	}
+
+	digest, err := encrypter.Digest(salt, plaintext)
+	if err != nil {
+		return false, err
+	}
+
+	return hmac.Equal([]byte(header[4]), []byte(digest)), nil
+}
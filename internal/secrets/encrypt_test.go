@@ -0,0 +1,126 @@
+package secrets
+
+import (
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	. "github.com/onsi/gomega"
+
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAgeEncrypter_Encrypt(t *testing.T) {
+	RegisterTestingT(t)
+
+	identity, err := age.GenerateX25519Identity()
+	Expect(err).To(BeNil())
+	encrypter, err := NewAgeEncrypter(identity.Recipient().String())
+	Expect(err).To(BeNil())
+
+	// Values spanning several chunks are decrypted back by age
+	for _, plaintext := range []string{"", "s3cr3t", strings.Repeat("x", 2*64*1024+1)} {
+		ciphertext, err := encrypter.Encrypt(plaintext)
+		Expect(err).To(BeNil())
+		Expect(ciphertext).To(HavePrefix("-----BEGIN AGE ENCRYPTED FILE-----"))
+		reader, err := age.Decrypt(armor.NewReader(strings.NewReader(ciphertext)), identity)
+		Expect(err).To(BeNil())
+		decrypted, err := ioutil.ReadAll(reader)
+		Expect(err).To(BeNil())
+		Expect(string(decrypted)).To(Equal(plaintext))
+	}
+
+	_, err = NewAgeEncrypter(identity.String())
+	Expect(err).NotTo(BeNil(), "Assert identities are not recipients")
+}
+
+func TestSeal(t *testing.T) {
+	RegisterTestingT(t)
+
+	hmacCalls := 0
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		if r.Method != "POST" || r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/transit/encrypt/gonsul":
+			_, _ = w.Write([]byte(`{"data": {"ciphertext": "vault:v1:` + request["plaintext"] + `"}}`))
+		case "/v1/transit/hmac/gonsul":
+			hmacCalls++
+			mac := hmac.New(sha256.New, []byte("transit key"))
+			input, _ := base64.StdEncoding.DecodeString(request["input"])
+			mac.Write(input)
+			_, _ = w.Write([]byte(`{"data": {"hmac": "vault:v1:` + base64.StdEncoding.EncodeToString(mac.Sum(nil)) + `"}}`))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer vault.Close()
+
+	encrypter, err := NewVaultTransitEncrypter(vault.URL, "root", "transit/gonsul", vault.Client())
+	Expect(err).To(BeNil())
+
+	// Sealed values hold their ciphertext, and are matched against their plaintext only
+	sealed, err := Seal(encrypter, "s3cr3t")
+	Expect(err).To(BeNil())
+	lines := strings.SplitN(sealed, "\n", 2)
+	Expect(lines[0]).To(HavePrefix(sealedPrefix))
+	Expect(lines[0]).To(ContainSubstring(":vault:v1:"), "Assert the digest is keyed by Vault")
+	Expect(lines[1]).To(Equal("vault:v1:" + base64.StdEncoding.EncodeToString([]byte("s3cr3t"))))
+	Expect(bytes.Contains([]byte(lines[0]), []byte("s3cr3t"))).To(BeFalse())
+	Expect(IsSealed(encrypter, sealed, "s3cr3t")).To(BeTrue())
+	Expect(IsSealed(encrypter, sealed, "other")).To(BeFalse())
+	Expect(IsSealed(encrypter, "s3cr3t", "s3cr3t")).To(BeFalse())
+	Expect(IsSealed(encrypter, strings.Replace(sealed, sealedPrefix, "gonsul:enc:v1:", 1), "s3cr3t")).To(BeFalse(), "Assert v1 values are sealed again")
+
+	// Digests are computed once for each salt and plaintext, whatever the number of runs
+	Expect(IsSealed(encrypter, sealed, "s3cr3t")).To(BeTrue())
+	Expect(IsSealed(encrypter, sealed, "other")).To(BeFalse())
+	Expect(hmacCalls).To(Equal(2))
+
+	// Another key seals values again
+	other, _ := NewVaultTransitEncrypter(vault.URL, "root", "transit/other", vault.Client())
+	isSealed, err := IsSealed(other, sealed, "s3cr3t")
+	Expect(isSealed).To(BeFalse())
+	Expect(err).To(MatchError(ContainSubstring("invalid response from Vault calling hmac")), "Assert digest errors are reported")
+	_, err = Seal(other, "s3cr3t")
+	Expect(err).NotTo(BeNil())
+
+	_, err = NewVaultTransitEncrypter(vault.URL, "root", "gonsul", vault.Client())
+	Expect(err).NotTo(BeNil())
+}
+
+func TestAgeEncrypter_Digest(t *testing.T) {
+	RegisterTestingT(t)
+
+	identity, _ := age.GenerateX25519Identity()
+	encrypter, err := NewAgeEncrypter(identity.Recipient().String())
+	Expect(err).To(BeNil())
+
+	// Digests are stable for a salt and recipient, and never the plain salted hash
+	salt := randomBytes(16)
+	digest, err := encrypter.Digest(salt, "s3cr3t")
+	Expect(err).To(BeNil())
+	Expect(encrypter.Digest(salt, "s3cr3t")).To(Equal(digest))
+	Expect(encrypter.Digest(randomBytes(16), "s3cr3t")).NotTo(Equal(digest))
+	Expect(encrypter.Digest(salt, "other")).NotTo(Equal(digest))
+
+	other, _ := age.GenerateX25519Identity()
+	otherEncrypter, _ := NewAgeEncrypter(other.Recipient().String())
+	Expect(otherEncrypter.Digest(salt, "s3cr3t")).NotTo(Equal(digest))
+
+	sealed, err := Seal(encrypter, "s3cr3t")
+	Expect(err).To(BeNil())
+	Expect(IsSealed(encrypter, sealed, "s3cr3t")).To(BeTrue())
+	Expect(IsSealed(otherEncrypter, sealed, "s3cr3t")).To(BeFalse())
+}
@@ -0,0 +1,27 @@
+package secrets
+
+import (
+	"os"
+)
+
+// envProvider serves secrets from environment variables, only those with its prefix
+type envProvider struct {
+	prefix string
+}
+
+// NewEnvProvider serves {{env.NAME}} placeholders from the environment variable prefix+NAME
+func NewEnvProvider(prefix string) IProvider {
+	return &envProvider{prefix: prefix}
+}
+
+// Get ...
+func (p *envProvider) Get(key string) (string, bool, error) {
+	value, found := os.LookupEnv(p.prefix + key)
+
+	return value, found, nil
+}
+
+// Reset ...
+func (p *envProvider) Reset() {
+	// There is nothing cached, we always read the latest
+}
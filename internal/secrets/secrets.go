@@ -0,0 +1,361 @@
+package secrets
+
+import (
+	"github.com/cbroglie/mustache"
+
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// IProvider is a source of secrets, serving the placeholders of its namespace: {{namespace.key}}
+type IProvider interface {
+	// Get returns the secret of the given key, telling if there is one
+	Get(key string) (string, bool, error)
+	// Reset forgets every secret fetched so far, so they're fetched again
+	Reset()
+}
+
+// IFileProvider is a provider reading its secrets from files of our repository, such as SOPS files
+type IFileProvider interface {
+	IProvider
+	// SetFiles tells where secret files are read from, from now on
+	SetFiles(files IFiles)
+}
+
+// IFiles is a read only file tree we read secret files from. Paths are slash separated, and
+// missing files are reported as fs.ErrNotExist
+type IFiles interface {
+	ReadFile(name string) ([]byte, error)
+}
+
+// ISecrets resolves the secret placeholders found on our values, either through the provider
+// of their namespace or from our secrets file
+type ISecrets interface {
+	// Lookup returns the secret of the given placeholder, telling if there is one
+	Lookup(name string) (string, bool, error)
+	// Render replaces every secret placeholder of the given value
+	Render(value string) (string, error)
+	// RenderEscaped replaces every secret placeholder of the given value, with secrets escaped
+	// by the given function instead of HTML escaped. The function gets the offset of each
+	// variable placeholder within the value, so secrets are escaped for where they're written
+	RenderEscaped(value string, escape func(offset int, secret string) (string, error)) (string, error)
+	// Missing returns the placeholders of the given value none of our secrets resolve
+	Missing(value string) ([]string, error)
+	// Unused returns the secrets of our secrets file none of the given values refer to
+	Unused(values []string) []string
+	// Values returns every secret value known so far, from our secrets file or looked up
+	Values() []string
+	// Reset forgets every secret looked up so far, so they're looked up again
+	Reset()
+	// SetFiles tells where our providers read secret files from, from now on
+	SetFiles(files IFiles)
+}
+
+// variableTag matches the mustache variable placeholders, whose secrets are escaped where
+// they're found: {{name}}, {{&name}} and {{{name}}}
+var variableTag = regexp.MustCompile(`\{\{\{\s*([^{}\s]+)\s*\}\}\}|\{\{\s*(?:&\s*)?([^{}\s#^/!>=&][^{}\s]*)\s*\}\}`)
+
+// occurrencePrefix names the context entry of each escaped placeholder, it can't be a secret name
+const occurrencePrefix = "gonsul:escaped:"
+
+// secrets ...
+type secrets struct {
+	values    map[string]string
+	providers map[string]IProvider
+	cache     map[string]lookupResult
+	// retired are the secrets looked up from files we don't read anymore, still known to Values
+	retired []string
+	mutex   sync.Mutex
+}
+
+// lookupResult is a secret we already looked up, so each one is only fetched once
+type lookupResult struct {
+	value string
+	found bool
+}
+
+// NewSecrets builds our secrets from the given secrets file map, and the providers of each namespace
+func NewSecrets(values map[string]string, providers map[string]IProvider) ISecrets {
+	if values == nil {
+		values = map[string]string{}
+	}
+
+	return &secrets{values: values, providers: providers, cache: map[string]lookupResult{}}
+}
+
+// Lookup ...
+func (s *secrets) Lookup(name string) (string, bool, error) {
+	s.mutex.Lock()
+	result, ok := s.cache[name]
+	s.mutex.Unlock()
+	if ok {
+		return result.value, result.found, nil
+	}
+
+	// Namespaced placeholders go through their provider, any other one is from our secrets file
+	value, found := s.values[name]
+	if parts := strings.SplitN(name, ".", 2); len(parts) == 2 {
+		if provider, ok := s.providers[parts[0]]; ok {
+			var err error
+			value, found, err = provider.Get(parts[1])
+			if err != nil {
+				return "", false, errors.New(fmt.Sprintf("secret %s: %s", name, err.Error()))
+			}
+		}
+	}
+
+	s.mutex.Lock()
+	s.cache[name] = lookupResult{value: value, found: found}
+	s.mutex.Unlock()
+
+	return value, found, nil
+}
+
+// Render ...
+func (s *secrets) Render(value string) (string, error) {
+	return s.RenderEscaped(value, nil)
+}
+
+// RenderEscaped ...
+func (s *secrets) RenderEscaped(value string, escape func(offset int, secret string) (string, error)) (string, error) {
+	if escape == nil {
+		return s.render(value)
+	}
+	if strings.Contains(value, "{{=") {
+		return "", errors.New("mustache delimiters can't be changed along with escaped secrets")
+	}
+
+	// Each variable placeholder is escaped for where it's found, becoming its own context entry
+	context := map[string]interface{}{}
+	var rewritten strings.Builder
+	last := 0
+	for index, match := range variableTag.FindAllStringSubmatchIndex(value, -1) {
+		// Triple braces are the first group, any other variable placeholder the second one
+		start, end := match[2], match[3]
+		if start < 0 {
+			start, end = match[4], match[5]
+		}
+		name := value[start:end]
+		secret, found, err := s.Lookup(name)
+		if err != nil {
+			return "", err
+		}
+		// Unknown placeholders are left to mustache, which writes them empty
+		if !found {
+			continue
+		}
+		escaped, err := escape(match[0], secret)
+		if err != nil {
+			return "", errors.New(fmt.Sprintf("secret %s: %s", name, err.Error()))
+		}
+
+		occurrence := occurrencePrefix + strconv.Itoa(index)
+		rewritten.WriteString(value[last:match[0]] + "{{{" + occurrence + "}}}")
+		context[occurrence] = escaped
+		last = match[1]
+	}
+	rewritten.WriteString(value[last:])
+
+	template, err := mustache.ParseStringRaw(rewritten.String(), true)
+	if err != nil {
+		return "", err
+	}
+
+	// Sections only tell whether their secret is there, they get it as it is
+	for _, name := range tagNames(template.Tags(), true) {
+		if strings.HasPrefix(name, occurrencePrefix) {
+			continue
+		}
+		secret, found, err := s.Lookup(name)
+		if err != nil {
+			return "", err
+		}
+		if found {
+			if err := setContext(context, name, secret); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return template.Render(context)
+}
+
+// render replaces every secret placeholder of the given value, HTML escaping secrets unless
+// their placeholder is a raw one ({{{name}}})
+func (s *secrets) render(value string) (string, error) {
+	template, err := mustache.ParseString(value)
+	if err != nil {
+		return "", err
+	}
+
+	// Our context only holds the secrets this value needs, looked up from their provider
+	context := map[string]interface{}{}
+	for _, name := range tagNames(template.Tags(), true) {
+		secret, found, err := s.Lookup(name)
+		if err != nil {
+			return "", err
+		}
+		if found {
+			if err := setContext(context, name, secret); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return template.Render(context)
+}
+
+// Missing ...
+func (s *secrets) Missing(value string) ([]string, error) {
+	names, err := Placeholders(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, name := range names {
+		_, found, err := s.Lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			missing = append(missing, name)
+		}
+	}
+
+	return missing, nil
+}
+
+// Unused ...
+func (s *secrets) Unused(values []string) []string {
+	used := map[string]bool{}
+	for _, value := range values {
+		// Broken templates are reported when rendered, they just don't use anything
+		if template, err := mustache.ParseString(value); err == nil {
+			for _, name := range tagNames(template.Tags(), true) {
+				used[name] = true
+			}
+		}
+	}
+
+	var unused []string
+	for name := range s.values {
+		if !used[name] {
+			unused = append(unused, name)
+		}
+	}
+	sort.Strings(unused)
+
+	return unused
+}
+
+// Values ...
+func (s *secrets) Values() []string {
+	var values []string
+	for _, value := range s.values {
+		values = append(values, value)
+	}
+
+	// Secrets of our providers are only known once looked up
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, result := range s.cache {
+		if result.found {
+			values = append(values, result.value)
+		}
+	}
+
+	return append(values, s.retired...)
+}
+
+// Reset ...
+func (s *secrets) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.cache = map[string]lookupResult{}
+	s.retired = nil
+	for _, provider := range s.providers {
+		provider.Reset()
+	}
+}
+
+// SetFiles ...
+func (s *secrets) SetFiles(files IFiles) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for namespace, provider := range s.providers {
+		fileProvider, ok := provider.(IFileProvider)
+		if !ok {
+			continue
+		}
+		fileProvider.SetFiles(files)
+
+		// Secrets of the files we read so far may be different on the new ones
+		for name, result := range s.cache {
+			if strings.HasPrefix(name, namespace+".") {
+				if result.found {
+					s.retired = append(s.retired, result.value)
+				}
+				delete(s.cache, name)
+			}
+		}
+	}
+}
+
+// Placeholders returns the name of every secret placeholder of the given value
+func Placeholders(value string) ([]string, error) {
+	template, err := mustache.ParseString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return tagNames(template.Tags(), false), nil
+}
+
+// tagNames returns the names of every variable of the given mustache tags, and optionally of their sections
+func tagNames(tags []mustache.Tag, withSections bool) []string {
+	var names []string
+	for _, tag := range tags {
+		switch tag.Type() {
+		case mustache.Variable:
+			names = append(names, tag.Name())
+		case mustache.Section, mustache.InvertedSection:
+			if withSections {
+				names = append(names, tag.Name())
+			}
+			names = append(names, tagNames(tag.Tags(), withSections)...)
+		}
+	}
+
+	return names
+}
+
+// setContext adds a secret to a mustache context. Mustache looks dotted names up one
+// part at a time, so namespaced secrets are nested: {{vault.db.pass}} is vault -> db -> pass
+func setContext(context map[string]interface{}, name string, secret string) error {
+	parts := strings.Split(name, ".")
+	for _, part := range parts[:len(parts)-1] {
+		if _, ok := context[part]; !ok {
+			context[part] = map[string]interface{}{}
+		}
+		child, ok := context[part].(map[string]interface{})
+		if !ok {
+			return errors.New(fmt.Sprintf("secret %s conflicts with another placeholder", name))
+		}
+		context = child
+	}
+
+	if _, ok := context[parts[len(parts)-1]].(map[string]interface{}); ok {
+		return errors.New(fmt.Sprintf("secret %s conflicts with another placeholder", name))
+	}
+	context[parts[len(parts)-1]] = secret
+
+	return nil
+}
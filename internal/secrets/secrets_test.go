@@ -0,0 +1,108 @@
+package secrets
+
+import (
+	. "github.com/onsi/gomega"
+
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecrets_Render(t *testing.T) {
+	RegisterTestingT(t)
+
+	directory, err := ioutil.TempDir("", "gonsul-secrets")
+	Expect(err).To(BeNil())
+	defer os.RemoveAll(directory)
+	Expect(ioutil.WriteFile(filepath.Join(directory, "db-pass"), []byte("s3cr3t"), 0600)).To(BeNil())
+	Expect(os.Setenv("GONSUL_TEST_TOKEN", "t0k3n")).To(BeNil())
+	defer os.Unsetenv("GONSUL_TEST_TOKEN")
+
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" || r.URL.Path != "/v1/secret/data/app" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data": {"data": {"user": "admin", "port": 5432}, "metadata": {"version": 1}}}`))
+	}))
+	defer vault.Close()
+
+	secrets := NewSecrets(map[string]string{"flat": "file", "plain.dotted": "ignored"}, map[string]IProvider{
+		"env":   NewEnvProvider("GONSUL_TEST_"),
+		"dir":   NewDirProvider(directory),
+		"vault": NewVaultProvider(vault.URL, "root", vault.Client()),
+	})
+
+	// Each namespace goes through its provider, anything else comes from our secrets file
+	rendered, err := secrets.Render("{{flat}} {{env.TOKEN}} {{dir.db-pass}} {{vault.secret/data/app#user}}:{{vault.secret/data/app#port}}")
+	Expect(err).To(BeNil())
+	Expect(rendered).To(Equal("file t0k3n s3cr3t admin:5432"))
+
+	// Missing secrets are not found, and placeholders can't escape their directory
+	_, found, err := secrets.Lookup("env.MISSING")
+	Expect(found).To(BeFalse())
+	Expect(err).To(BeNil())
+	_, found, err = secrets.Lookup("vault.secret/data/other#user")
+	Expect(found).To(BeFalse())
+	Expect(err).To(BeNil())
+	_, _, err = secrets.Lookup("dir.../etc/passwd")
+	Expect(err).NotTo(BeNil())
+
+	// Dotted placeholders without a provider still come from our secrets file
+	rendered, err = secrets.Render("{{plain.dotted}}")
+	Expect(err).To(BeNil())
+	Expect(rendered).To(Equal("ignored"))
+
+	// Escaped secrets are escaped for each placeholder offset, sections getting them as they are
+	var offsets []int
+	rendered, err = secrets.RenderEscaped("{{flat}} {{{ env.TOKEN }}}{{#flat}}!{{&flat}}{{/flat}}{{missing}}", func(offset int, secret string) (string, error) {
+		offsets = append(offsets, offset)
+		return "<" + secret + ">", nil
+	})
+	Expect(err).To(BeNil())
+	Expect(rendered).To(Equal("<file> <t0k3n>!<file>"))
+	Expect(offsets).To(Equal([]int{0, 9, 36}))
+
+	names, err := Placeholders("{{a}}{{#b}}{{c.d}}{{/b}}")
+	Expect(err).To(BeNil())
+	Expect(names).To(Equal([]string{"a", "c.d"}))
+}
+
+func TestSecrets_MissingUnused(t *testing.T) {
+	RegisterTestingT(t)
+
+	secrets := NewSecrets(map[string]string{"db-pass": "s3cr3t", "db-passwd": "typo", "flag": "on"}, nil)
+
+	missing, err := secrets.Missing("{{db-user}}:{{db-pass}}{{#flag}}{{other}}{{/flag}}")
+	Expect(err).To(BeNil())
+	Expect(missing).To(Equal([]string{"db-user", "other"}))
+
+	// Sections use secrets too
+	Expect(secrets.Unused([]string{"{{db-pass}}", "{{#flag}}x{{/flag}}", "{{#broken"})).To(Equal([]string{"db-passwd"}))
+}
+
+func TestSecrets_ResetSetFiles(t *testing.T) {
+	RegisterTestingT(t)
+
+	sops := sopsFixtureProvider()
+	Expect(os.Setenv("GONSUL_TEST_TOKEN", "t0k3n")).To(BeNil())
+	defer os.Unsetenv("GONSUL_TEST_TOKEN")
+	secrets := NewSecrets(nil, map[string]IProvider{"env": NewEnvProvider("GONSUL_TEST_"), "sops": sops})
+
+	// Each mount files have their own secrets, yet every secret we looked up stays known
+	secrets.SetFiles(memFiles{"app.yaml": sopsFixture("password-first.yaml")})
+	Expect(secrets.Render("{{sops.app.yaml#password}} {{env.TOKEN}}")).To(Equal("first t0k3n"))
+	secrets.SetFiles(memFiles{"app.yaml": sopsFixture("password-second.yaml")})
+	Expect(secrets.Render("{{sops.app.yaml#password}} {{env.TOKEN}}")).To(Equal("second t0k3n"))
+	Expect(secrets.Values()).To(ConsistOf("first", "second", "t0k3n"))
+
+	// Until we start over
+	Expect(os.Setenv("GONSUL_TEST_TOKEN", "r0t4t3d")).To(BeNil())
+	Expect(secrets.Render("{{env.TOKEN}}")).To(Equal("t0k3n"), "Assert secrets are cached")
+	secrets.Reset()
+	Expect(secrets.Values()).To(BeEmpty())
+	Expect(secrets.Render("{{env.TOKEN}}")).To(Equal("r0t4t3d"))
+}
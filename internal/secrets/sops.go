@@ -0,0 +1,465 @@
+package secrets
+
+import (
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"gopkg.in/yaml.v3"
+
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sopsDefaultUnencryptedSuffix is what SOPS assumes, when a file tells nothing about what is encrypted
+const sopsDefaultUnencryptedSuffix = "_unencrypted"
+
+// sopsMACOnlyEncryptedInit starts the MAC of files only authenticating their encrypted values,
+// so it never matches the MAC of the same values with every value authenticated
+var sopsMACOnlyEncryptedInit = []byte{0x8a, 0x3f, 0xd2, 0xad, 0x54, 0xce, 0x66, 0x52, 0x7b, 0x10, 0x34, 0xf3, 0xd1, 0x47, 0xbe, 0xb,
+	0xb, 0x97, 0x5b, 0x3b, 0xf4, 0x4f, 0x72, 0xc6, 0xfd, 0xad, 0xec, 0x81, 0x76, 0xf2, 0x7d, 0x69}
+
+// sopsProvider serves secrets from SOPS files of our repository, encrypted for age recipients
+type sopsProvider struct {
+	files      IFiles
+	identities []age.Identity
+	cache      map[string]*sopsFile
+}
+
+// sopsFile is a decrypted (and authenticated) SOPS file, its leaves being the values we serve
+type sopsFile struct {
+	tree interface{}
+}
+
+// sopsMetadata is what we need of the "sops" entry of a SOPS file
+type sopsMetadata struct {
+	Age []struct {
+		Enc string `yaml:"enc"`
+	} `yaml:"age"`
+	LastModified      string `yaml:"lastmodified"`
+	MAC               string `yaml:"mac"`
+	UnencryptedSuffix string `yaml:"unencrypted_suffix"`
+	EncryptedSuffix   string `yaml:"encrypted_suffix"`
+	UnencryptedRegex  string `yaml:"unencrypted_regex"`
+	EncryptedRegex    string `yaml:"encrypted_regex"`
+	MACOnlyEncrypted  bool   `yaml:"mac_only_encrypted"`
+}
+
+// sopsDecrypter walks a SOPS file, decrypting its values and computing its MAC along the way
+type sopsDecrypter struct {
+	metadata         sopsMetadata
+	unencryptedRegex *regexp.Regexp
+	encryptedRegex   *regexp.Regexp
+	dataKey          []byte
+	mac              hash.Hash
+}
+
+// NewSOPSProvider serves {{sops.file#path/to/value}} placeholders from the SOPS file at the given
+// path of our repository, decrypted with the given age identities (content of an age key file).
+// Files are read from wherever SetFiles tells, and their MAC is verified before serving anything
+func NewSOPSProvider(identities string) (IProvider, error) {
+	ageIdentities, err := age.ParseIdentities(strings.NewReader(identities))
+	if err != nil {
+		return nil, errors.New("invalid age identities: " + err.Error())
+	}
+
+	return &sopsProvider{identities: ageIdentities, cache: map[string]*sopsFile{}}, nil
+}
+
+// Get ...
+func (p *sopsProvider) Get(key string) (string, bool, error) {
+	parts := strings.SplitN(key, "#", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", false, errors.New(fmt.Sprintf("invalid SOPS secret (%s), must be: file#path/to/value", key))
+	}
+	filePath := parts[0]
+	if filePath == "" || path.IsAbs(filePath) || path.Clean(filePath) != filePath || filePath == ".." || strings.HasPrefix(filePath, "../") {
+		return "", false, errors.New(fmt.Sprintf("invalid SOPS file name: %s", filePath))
+	}
+
+	file, err := p.load(filePath)
+	if err != nil || file == nil {
+		return "", false, err
+	}
+
+	// Walk down to our value, through map keys and list indexes
+	node := file.tree
+	for _, segment := range strings.Split(parts[1], "/") {
+		switch typed := node.(type) {
+		case map[string]interface{}:
+			child, ok := typed[segment]
+			if !ok {
+				return "", false, nil
+			}
+			node = child
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(typed) {
+				return "", false, nil
+			}
+			node = typed[index]
+		default:
+			return "", false, nil
+		}
+	}
+
+	value, ok := node.(string)
+	if !ok {
+		return "", false, errors.New(fmt.Sprintf("SOPS secret %s is not a single value", key))
+	}
+
+	return value, true, nil
+}
+
+// Reset ...
+func (p *sopsProvider) Reset() {
+	p.cache = map[string]*sopsFile{}
+}
+
+// SetFiles ...
+func (p *sopsProvider) SetFiles(files IFiles) {
+	p.files = files
+	p.cache = map[string]*sopsFile{}
+}
+
+// load decodes, decrypts and authenticates the given SOPS file, nil if there is no such file
+func (p *sopsProvider) load(filePath string) (*sopsFile, error) {
+	if file, ok := p.cache[filePath]; ok {
+		return file, nil
+	}
+	if p.files == nil {
+		return nil, errors.New(fmt.Sprintf("%s: there are no repository files to read it from", filePath))
+	}
+
+	content, err := p.files.ReadFile(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		p.cache[filePath] = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := p.decrypt(content)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("%s: %s", filePath, err.Error()))
+	}
+	p.cache[filePath] = file
+
+	return file, nil
+}
+
+// decrypt decrypts a whole SOPS file, refusing it unless its MAC matches what we decrypted.
+// YAML being a superset of JSON, both kinds of SOPS files are decoded the same way
+func (p *sopsProvider) decrypt(content []byte) (*sopsFile, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+	if document.Kind != yaml.DocumentNode || len(document.Content) != 1 || document.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("not a SOPS file")
+	}
+	root := document.Content[0]
+
+	// Our metadata lives along with the values, on the sops root key
+	var metadataNode *yaml.Node
+	var branches []*yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "sops" {
+			metadataNode = root.Content[i+1]
+			continue
+		}
+		branches = append(branches, root.Content[i], root.Content[i+1])
+	}
+	if metadataNode == nil {
+		return nil, errors.New("not a SOPS file")
+	}
+
+	decrypter := &sopsDecrypter{mac: sha512.New()}
+	if err := metadataNode.Decode(&decrypter.metadata); err != nil {
+		return nil, errors.New("invalid SOPS metadata: " + err.Error())
+	}
+	if err := decrypter.compileRules(); err != nil {
+		return nil, err
+	}
+	if decrypter.metadata.MACOnlyEncrypted {
+		decrypter.mac.Write(sopsMACOnlyEncryptedInit)
+	}
+
+	// Our data key is encrypted for each age recipient, one of them should be ours
+	for _, recipient := range decrypter.metadata.Age {
+		if dataKey, err := p.decryptDataKey(recipient.Enc); err == nil {
+			decrypter.dataKey = dataKey
+			break
+		}
+	}
+	if decrypter.dataKey == nil {
+		return nil, errors.New("no age identity can decrypt its data key")
+	}
+
+	tree, err := decrypter.walk(&yaml.Node{Kind: yaml.MappingNode, Content: branches}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := decrypter.verify(); err != nil {
+		return nil, err
+	}
+
+	return &sopsFile{tree: tree}, nil
+}
+
+// decryptDataKey decrypts a data key encrypted for an age recipient, as an armored age file
+func (p *sopsProvider) decryptDataKey(encrypted string) ([]byte, error) {
+	reader, err := age.Decrypt(armor.NewReader(strings.NewReader(encrypted)), p.identities...)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadAll(reader)
+}
+
+// compileRules compiles the regular expressions telling which values are encrypted
+func (d *sopsDecrypter) compileRules() error {
+	metadata := &d.metadata
+	if metadata.UnencryptedSuffix == "" && metadata.EncryptedSuffix == "" && metadata.UnencryptedRegex == "" && metadata.EncryptedRegex == "" {
+		metadata.UnencryptedSuffix = sopsDefaultUnencryptedSuffix
+	}
+
+	var err error
+	if metadata.UnencryptedRegex != "" {
+		if d.unencryptedRegex, err = regexp.Compile(metadata.UnencryptedRegex); err != nil {
+			return errors.New("invalid SOPS unencrypted_regex: " + err.Error())
+		}
+	}
+	if metadata.EncryptedRegex != "" {
+		if d.encryptedRegex, err = regexp.Compile(metadata.EncryptedRegex); err != nil {
+			return errors.New("invalid SOPS encrypted_regex: " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+// isEncrypted tells if the value at the given map keys is encrypted, following the SOPS rules
+func (d *sopsDecrypter) isEncrypted(keys []string) bool {
+	encrypted := true
+	anyKey := func(match func(key string) bool) bool {
+		for _, key := range keys {
+			if match(key) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if suffix := d.metadata.UnencryptedSuffix; suffix != "" && anyKey(func(key string) bool { return strings.HasSuffix(key, suffix) }) {
+		encrypted = false
+	}
+	if suffix := d.metadata.EncryptedSuffix; suffix != "" {
+		encrypted = anyKey(func(key string) bool { return strings.HasSuffix(key, suffix) })
+	}
+	if d.unencryptedRegex != nil && anyKey(d.unencryptedRegex.MatchString) {
+		encrypted = false
+	}
+	if d.encryptedRegex != nil {
+		encrypted = anyKey(d.encryptedRegex.MatchString)
+	}
+
+	return encrypted
+}
+
+// walk decrypts the given node, in document order as that's what the MAC is computed in. Map keys
+// are part of each value's authenticated data, list indexes aren't
+func (d *sopsDecrypter) walk(node *yaml.Node, keys []string) (interface{}, error) {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return d.walk(node.Alias, keys)
+	case yaml.MappingNode:
+		tree := map[string]interface{}{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			child, err := d.walk(node.Content[i+1], append(append([]string{}, keys...), key))
+			if err != nil {
+				return nil, err
+			}
+			tree[key] = child
+		}
+		return tree, nil
+	case yaml.SequenceNode:
+		list := []interface{}{}
+		for _, item := range node.Content {
+			child, err := d.walk(item, keys)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, child)
+		}
+		return list, nil
+	case yaml.ScalarNode:
+		return d.leaf(node, keys)
+	default:
+		return nil, errors.New(fmt.Sprintf("unexpected SOPS node at %s", strings.Join(keys, "/")))
+	}
+}
+
+// leaf decrypts a single value, adding it to our MAC, and returns it the way we serve it
+func (d *sopsDecrypter) leaf(node *yaml.Node, keys []string) (interface{}, error) {
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	encrypted := d.isEncrypted(keys)
+	if !encrypted {
+		served, macBytes := sopsPlainValue(value)
+		if !d.metadata.MACOnlyEncrypted {
+			d.mac.Write(macBytes)
+		}
+		return served, nil
+	}
+
+	// Anything that should be encrypted and is not, was not written by SOPS
+	text, ok := value.(string)
+	if !ok || !strings.HasPrefix(text, "ENC[") {
+		return nil, errors.New(fmt.Sprintf("SOPS value %s is not encrypted", strings.Join(keys, "/")))
+	}
+	plaintext, valueType, err := sopsDecryptValue(text, d.dataKey, strings.Join(keys, ":")+":")
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("%s: %s", strings.Join(keys, "/"), err.Error()))
+	}
+
+	served, macBytes, err := sopsTypedValue(plaintext, valueType)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("%s: %s", strings.Join(keys, "/"), err.Error()))
+	}
+	d.mac.Write(macBytes)
+
+	return served, nil
+}
+
+// verify compares the MAC we computed with the one of the file, encrypted with the
+// data key and authenticated along with the file last modification date
+func (d *sopsDecrypter) verify() error {
+	if d.metadata.MAC == "" {
+		return errors.New("SOPS MAC is missing")
+	}
+
+	lastModified, err := time.Parse(time.RFC3339, d.metadata.LastModified)
+	if err != nil {
+		return errors.New("invalid SOPS lastmodified: " + d.metadata.LastModified)
+	}
+	mac, _, err := sopsDecryptValue(d.metadata.MAC, d.dataKey, lastModified.Format(time.RFC3339))
+	if err != nil {
+		return errors.New("SOPS MAC: " + err.Error())
+	}
+
+	if mac != fmt.Sprintf("%X", d.mac.Sum(nil)) {
+		return errors.New("SOPS MAC does not match, the file was tampered with")
+	}
+
+	return nil
+}
+
+// sopsPlainValue returns how we serve an unencrypted value, and what SOPS adds to its MAC for it
+func sopsPlainValue(value interface{}) (string, []byte) {
+	switch typed := value.(type) {
+	case int:
+		return strconv.Itoa(typed), []byte(strconv.Itoa(typed))
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64), []byte(strconv.FormatFloat(typed, 'f', -1, 64))
+	case bool:
+		return strconv.FormatBool(typed), sopsBoolBytes(typed)
+	default:
+		return fmt.Sprint(typed), []byte(fmt.Sprint(typed))
+	}
+}
+
+// sopsTypedValue returns how we serve a decrypted value of the given SOPS type, and what
+// SOPS adds to its MAC for it: the value it decodes, written back
+func sopsTypedValue(plaintext string, valueType string) (string, []byte, error) {
+	switch valueType {
+	case "int":
+		number, err := strconv.Atoi(plaintext)
+		if err != nil {
+			return "", nil, errors.New("invalid SOPS int value")
+		}
+		return plaintext, []byte(strconv.Itoa(number)), nil
+	case "float":
+		number, err := strconv.ParseFloat(plaintext, 64)
+		if err != nil {
+			return "", nil, errors.New("invalid SOPS float value")
+		}
+		return plaintext, []byte(strconv.FormatFloat(number, 'f', -1, 64)), nil
+	case "bool":
+		// SOPS writes booleans as True/False, we write them the way YAML and JSON do
+		boolean, err := strconv.ParseBool(plaintext)
+		if err != nil {
+			return "", nil, errors.New("invalid SOPS bool value")
+		}
+		return strconv.FormatBool(boolean), sopsBoolBytes(boolean), nil
+	default:
+		return plaintext, []byte(plaintext), nil
+	}
+}
+
+// sopsBoolBytes writes a boolean the way SOPS does, for its MAC
+func sopsBoolBytes(value bool) []byte {
+	if value {
+		return []byte("True")
+	}
+
+	return []byte("False")
+}
+
+// sopsDecryptValue decrypts a SOPS value, ENC[AES256_GCM,data:...,iv:...,tag:...,type:...],
+// returning its plaintext and type
+func sopsDecryptValue(value string, dataKey []byte, additionalData string) (string, string, error) {
+	invalid := errors.New("invalid SOPS encrypted value")
+	if !strings.HasPrefix(value, "ENC[AES256_GCM,") || !strings.HasSuffix(value, "]") {
+		return "", "", invalid
+	}
+
+	fields := map[string]string{}
+	for _, field := range strings.Split(strings.TrimSuffix(strings.TrimPrefix(value, "ENC[AES256_GCM,"), "]"), ",") {
+		parts := strings.SplitN(field, ":", 2)
+		if len(parts) != 2 {
+			return "", "", invalid
+		}
+		fields[parts[0]] = parts[1]
+	}
+
+	data, dataErr := base64.StdEncoding.DecodeString(fields["data"])
+	iv, ivErr := base64.StdEncoding.DecodeString(fields["iv"])
+	tag, tagErr := base64.StdEncoding.DecodeString(fields["tag"])
+	if dataErr != nil || ivErr != nil || tagErr != nil || len(iv) == 0 {
+		return "", "", invalid
+	}
+
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return "", "", err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return "", "", err
+	}
+	plaintext, err := gcm.Open(nil, iv, append(data, tag...), []byte(additionalData))
+	if err != nil {
+		return "", "", errors.New("failed to decrypt SOPS value, wrong key or tampered file")
+	}
+
+	return string(plaintext), fields["type"], nil
+}
@@ -0,0 +1,172 @@
+package secrets
+
+import (
+	"filippo.io/age"
+	. "github.com/onsi/gomega"
+
+	"crypto/rand"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// Our SOPS fixtures are written by sops itself (sops --encrypt --age <recipient>), for the
+// identity of tests/data/sops/age.key
+const sopsFixtures = "../../tests/data/sops"
+
+func randomBytes(size int) []byte {
+	data := make([]byte, size)
+	_, _ = rand.Read(data)
+
+	return data
+}
+
+// sopsFixture returns the content of the given SOPS fixture
+func sopsFixture(name string) string {
+	content, err := ioutil.ReadFile(sopsFixtures + "/" + name)
+	Expect(err).To(BeNil())
+
+	return string(content)
+}
+
+// sopsFixtureProvider is a SOPS provider for the identity of our fixtures
+func sopsFixtureProvider() IProvider {
+	provider, err := NewSOPSProvider(sopsFixture("age.key"))
+	Expect(err).To(BeNil())
+
+	return provider
+}
+
+// sopsLine returns the given line of a SOPS fixture, matched by its start
+func sopsLine(content string, start string) string {
+	line := regexp.MustCompile(`(?m)^` + regexp.QuoteMeta(start) + `.*$`).FindString(content)
+	Expect(line).NotTo(BeEmpty())
+
+	return line
+}
+
+func TestSOPSProvider_Get(t *testing.T) {
+	RegisterTestingT(t)
+
+	provider := sopsFixtureProvider()
+	provider.(IFileProvider).SetFiles(dirFiles(sopsFixtures))
+
+	// Every value type, unencrypted values, JSON files and files only encrypting some values
+	expected := map[string]string{
+		"app.yaml#db/password":          "s3cr3t",
+		"app.yaml#db/port":              "5432",
+		"app.yaml#db/ratio":             "0.5",
+		"app.yaml#db/debug":             "false",
+		"app.yaml#db/hosts/1":           "db-2",
+		"app.yaml#region_unencrypted":   "eu-west-1",
+		"app.yaml#replicas_unencrypted": "3",
+		"app.json#db/password":          "s3cr3t",
+		"app.json#db/hosts/0":           "db-1",
+		"only.yaml#db/password":         "s3cr3t",
+		"only.yaml#db/host":             "db-1",
+	}
+	for key, secret := range expected {
+		value, found, err := provider.Get(key)
+		Expect(err).To(BeNil(), key)
+		Expect(found).To(BeTrue(), key)
+		Expect(value).To(Equal(secret), key)
+	}
+
+	// Missing files and values are not found
+	_, found, err := provider.Get("app.yaml#db/user")
+	Expect(found).To(BeFalse())
+	Expect(err).To(BeNil())
+	_, found, err = provider.Get("other.yaml#db/user")
+	Expect(found).To(BeFalse())
+	Expect(err).To(BeNil())
+	_, _, err = provider.Get("app.yaml#db")
+	Expect(err).To(MatchError(ContainSubstring("is not a single value")))
+}
+
+func TestSOPSProvider_Tampered(t *testing.T) {
+	RegisterTestingT(t)
+
+	original := sopsFixture("app.yaml")
+	password := sopsLine(original, "    password: ")
+	port := sopsLine(original, "    port: ")
+	files := memFiles{
+		// Comments are encrypted, but not part of the MAC
+		"comment.yaml": strings.Replace(original, sopsLine(original, "#ENC[")+"\n", "", 1),
+		// Values are authenticated by their map keys, and the whole file by a MAC of its values in document order
+		"moved.yaml":     strings.Replace(original, password, strings.Replace(port, "port", "password", 1), 1),
+		"reordered.yaml": strings.Replace(strings.Replace(original, port, "PORT", 1), password, port+"\n"+password, 1),
+		"plain.yaml":     strings.Replace(original, password, "    password: s3cr3t", 1),
+	}
+	files["reordered.yaml"] = strings.Replace(files["reordered.yaml"], "PORT\n", "", 1)
+
+	provider := sopsFixtureProvider()
+	provider.(IFileProvider).SetFiles(files)
+
+	value, _, err := provider.Get("comment.yaml#db/password")
+	Expect(err).To(BeNil())
+	Expect(value).To(Equal("s3cr3t"))
+
+	// Values moved around, reordered or written in plain text refuse the whole file
+	_, _, err = provider.Get("moved.yaml#db/port")
+	Expect(err).To(MatchError(ContainSubstring("wrong key or tampered file")))
+	_, _, err = provider.Get("reordered.yaml#db/password")
+	Expect(err).To(MatchError(ContainSubstring("SOPS MAC does not match")))
+	_, _, err = provider.Get("plain.yaml#db/port")
+	Expect(err).To(MatchError(ContainSubstring("SOPS value db/password is not encrypted")))
+
+	// Only our recipient can decrypt the file
+	identity, err := age.GenerateX25519Identity()
+	Expect(err).To(BeNil())
+	other, err := NewSOPSProvider(identity.String())
+	Expect(err).To(BeNil())
+	other.(IFileProvider).SetFiles(memFiles{"app.yaml": original})
+	_, _, err = other.Get("app.yaml#db/password")
+	Expect(err).To(MatchError(ContainSubstring("no age identity can decrypt its data key")))
+
+	_, err = NewSOPSProvider("AGE-SECRET-KEY-1INVALID")
+	Expect(err).To(MatchError(ContainSubstring("invalid age identities")))
+}
+
+func TestSOPSProvider_Reset(t *testing.T) {
+	RegisterTestingT(t)
+
+	files := memFiles{"app.yaml": sopsFixture("app.yaml")}
+	provider := sopsFixtureProvider()
+	provider.(IFileProvider).SetFiles(files)
+
+	value, _, err := provider.Get("app.yaml#db/password")
+	Expect(err).To(BeNil())
+	Expect(value).To(Equal("s3cr3t"))
+
+	// Files are read again from whatever we read them from next
+	delete(files, "app.yaml")
+	value, _, err = provider.Get("app.yaml#db/password")
+	Expect(err).To(BeNil())
+	Expect(value).To(Equal("s3cr3t"), "Assert files are cached")
+	provider.Reset()
+	_, found, err := provider.Get("app.yaml#db/password")
+	Expect(found).To(BeFalse())
+	Expect(err).To(BeNil())
+}
+
+// memFiles is an in memory IFiles
+type memFiles map[string]string
+
+func (m memFiles) ReadFile(name string) ([]byte, error) {
+	content, ok := m[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return []byte(content), nil
+}
+
+// dirFiles reads files from a local directory
+type dirFiles string
+
+func (d dirFiles) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(os.DirFS(string(d)), name)
+}
@@ -0,0 +1,110 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// vaultProvider serves secrets from a Vault KV secrets engine, version 1 or 2
+type vaultProvider struct {
+	address string
+	token   string
+	client  *http.Client
+	cache   map[string]map[string]interface{}
+}
+
+// NewVaultProvider serves {{vault.path#field}} placeholders from the field of the Vault secret
+// at the given path, such as secret/data/app#password
+func NewVaultProvider(address string, token string, client *http.Client) IProvider {
+	return &vaultProvider{
+		address: strings.TrimSuffix(address, "/"),
+		token:   token,
+		client:  client,
+		cache:   map[string]map[string]interface{}{},
+	}
+}
+
+// Get ...
+func (p *vaultProvider) Get(key string) (string, bool, error) {
+	parts := strings.SplitN(key, "#", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", false, errors.New(fmt.Sprintf("invalid Vault secret (%s), must be: path#field", key))
+	}
+
+	secret, err := p.read(strings.Trim(parts[0], "/"))
+	if err != nil || secret == nil {
+		return "", false, err
+	}
+	value, found := secret[parts[1]]
+	if !found {
+		return "", false, nil
+	}
+	if text, ok := value.(string); ok {
+		return text, true, nil
+	}
+
+	// Any other field (numbers, objects...) is written as JSON
+	encoded, err := json.Marshal(value)
+
+	return string(encoded), err == nil, err
+}
+
+// Reset ...
+func (p *vaultProvider) Reset() {
+	p.cache = map[string]map[string]interface{}{}
+}
+
+// read returns the fields of the secret at the given path, nil if there is none
+func (p *vaultProvider) read(secretPath string) (map[string]interface{}, error) {
+	if secret, ok := p.cache[secretPath]; ok {
+		return secret, nil
+	}
+
+	req, err := http.NewRequest("GET", p.address+"/v1/"+secretPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	if p.token != "" {
+		req.Header.Set("X-Vault-Token", p.token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode == 404 {
+		p.cache[secretPath] = nil
+		return nil, nil
+	}
+	if resp.StatusCode >= 400 {
+		return nil, errors.New(fmt.Sprintf("invalid response from Vault reading %s: %s", secretPath, resp.Status))
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var response struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, errors.New(fmt.Sprintf("could not parse Vault response reading %s: %s", secretPath, err.Error()))
+	}
+
+	// KV version 2 secrets hold their fields under data, along with their metadata
+	secret := response.Data
+	if _, ok := secret["metadata"].(map[string]interface{}); ok {
+		secret, _ = secret["data"].(map[string]interface{})
+	}
+	p.cache[secretPath] = secret
+
+	return secret, nil
+}
@@ -7,9 +7,19 @@ const ErrorFailedConsulTxn 				= 31
 const ErrorFailedReadingResponse 		= 40
 const ErrorFailedJsonEncode 			= 50
 const ErrorFailedJsonDecode 			= 51
+const ErrorSchemaViolation				= 52
 const ErrorFailedCloning 				= 60
+const ErrorFailedVerification			= 61
+const ErrorFailedLFS					= 62
 const ErrorFailedMustache 				= 70
+const ErrorFailedTemplate				= 71
+const ErrorFailedReference				= 72
+const ErrorFailedEncryption			= 73
 const ErrorFailedHTTPServer				= 80
+const ErrorFailedReadingSource			= 90
+const ErrorMountConflict				= 91
+const ErrorKeyNotFound					= 92
+const ErrorInvalidKey					= 93
 
 type GonsulError struct {
 	Code int
@@ -1,7 +1,9 @@
 package util
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"sync"
 	"time"
 )
 
@@ -27,6 +29,8 @@ type ILogger interface {
 	PrintDebug(msg string)
 	AddMessage(msg string)
 	GetMessages() []string
+	SetSecrets(secrets func() []string)
+	Redact(msg string) string
 }
 
 // logger is our ILogger interface concrete implementation. It's used throughout the
@@ -34,6 +38,10 @@ type ILogger interface {
 type logger struct {
 	level 		int
 	messages 	[]string
+	secrets		func() []string
+	// warned holds a hash of the short secrets we warned about, they can't be redacted
+	warned		map[[sha256.Size]byte]bool
+	warnedMutex	sync.Mutex
 }
 
 // NewLogger is our logger constructor
@@ -41,20 +49,21 @@ func NewLogger(level int) ILogger {
 	return &logger{
 		level: level,
 		messages: []string{},
+		warned: map[[sha256.Size]byte]bool{},
 	}
 }
 
 // PrintError prints a message of ERROR level
 func (logger *logger) PrintError(msg string) {
 	t := time.Now()
-	fmt.Println("[" + LogErr + "] [" + t.Format(time.StampMilli) + "] " + msg)
+	fmt.Println("[" + LogErr + "] [" + t.Format(time.StampMilli) + "] " + logger.Redact(msg))
 }
 
 // PrintInfo prints a message of INFO level
 func (logger *logger) PrintInfo(msg string) {
 	t := time.Now()
 	if logger.level >= ErrorLevels[LogInfo] {
-		fmt.Println("[" + LogInfo + "]  [" + t.Format(time.StampMilli) + "] " + msg)
+		fmt.Println("[" + LogInfo + "]  [" + t.Format(time.StampMilli) + "] " + logger.Redact(msg))
 	}
 }
 
@@ -62,7 +71,7 @@ func (logger *logger) PrintInfo(msg string) {
 func (logger *logger) PrintDebug(msg string) {
 	t := time.Now()
 	if logger.level >= ErrorLevels[LogDebug] {
-		fmt.Println("[" + LogDebug + "] [" + t.Format(time.StampMilli) + "] " + msg)
+		fmt.Println("[" + LogDebug + "] [" + t.Format(time.StampMilli) + "] " + logger.Redact(msg))
 	}
 }
 
@@ -73,5 +82,50 @@ func (logger *logger) AddMessage(msg string) {
 
 // GetMessages returns our internal message slice
 func (logger *logger) GetMessages() []string {
-	return logger.messages
+	// Messages are redacted once read, as they may be sent over HTTP
+	messages := make([]string, 0, len(logger.messages))
+	for _, msg := range logger.messages {
+		messages = append(messages, logger.Redact(msg))
+	}
+
+	return messages
+}
+
+// SetSecrets sets the function returning every secret value known so far, redacted from any
+// message we output from then on
+func (logger *logger) SetSecrets(secrets func() []string) {
+	logger.secrets = secrets
+}
+
+// Redact replaces every secret value found in the given message, for output not going
+// through our logger (such as tables)
+func (logger *logger) Redact(msg string) string {
+	if logger.secrets == nil {
+		return msg
+	}
+
+	values := logger.secrets()
+	logger.warnShortSecrets(values)
+
+	return redact(msg, values)
+}
+
+// warnShortSecrets warns once about each secret value too short to be redacted, without
+// telling it, as it may appear in our output
+func (logger *logger) warnShortSecrets(values []string) {
+	warnings := 0
+	logger.warnedMutex.Lock()
+	for _, value := range values {
+		hash := sha256.Sum256([]byte(value))
+		if isShortSecret(value) && !logger.warned[hash] {
+			logger.warned[hash] = true
+			warnings++
+		}
+	}
+	logger.warnedMutex.Unlock()
+
+	// Printed once marked, as our warnings are redacted as well
+	for ; warnings > 0; warnings-- {
+		logger.PrintError(fmt.Sprintf("LOGGER: a secret value is shorter than %d characters, it can't be redacted from our output", redactMinLength))
+	}
 }
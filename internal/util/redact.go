@@ -0,0 +1,74 @@
+package util
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"html"
+	"sort"
+	"strings"
+)
+
+// Redacted replaces every secret value found in our output
+const Redacted = "[REDACTED]"
+
+// redactMinLength is the length secret values must have to be redacted, so short values such
+// as "1" or "on" don't mangle our whole output. We warn about those instead
+const redactMinLength = 4
+
+// redactForms returns the forms the given secret value may be found in: as it is, base64 encoded,
+// line by line for multi line values, and escaped the ways values are written to documents (JSON,
+// with or without HTML escaping, .env and properties files, YAML single quoted strings) or HTML
+func redactForms(value string) []string {
+	forms := []string{
+		value,
+		base64.StdEncoding.EncodeToString([]byte(value)),
+		html.EscapeString(value),
+		strings.Replace(value, "'", "''", -1),
+		strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(value),
+		strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(value),
+	}
+	if encoded, err := json.Marshal(value); err == nil {
+		forms = append(forms, string(encoded[1:len(encoded)-1]))
+	}
+	buffer := &bytes.Buffer{}
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err == nil {
+		encoded := strings.TrimSuffix(buffer.String(), "\n")
+		forms = append(forms, encoded[1:len(encoded)-1])
+	}
+	if strings.Contains(value, "\n") {
+		forms = append(forms, strings.Split(value, "\n")...)
+	}
+
+	return forms
+}
+
+// redact replaces the given secret values found in a message, in any of their forms
+func redact(msg string, values []string) string {
+	var forms []string
+	for _, value := range values {
+		forms = append(forms, redactForms(value)...)
+	}
+
+	// Longer values first, so a value containing another one is redacted as a whole
+	sort.SliceStable(forms, func(a, b int) bool {
+		return len(forms[a]) > len(forms[b])
+	})
+
+	for _, form := range forms {
+		if len(strings.TrimSpace(form)) >= redactMinLength {
+			msg = strings.Replace(msg, form, Redacted, -1)
+		}
+	}
+
+	return msg
+}
+
+// isShortSecret tells if the given secret value is too short to be redacted
+func isShortSecret(value string) bool {
+	trimmed := strings.TrimSpace(value)
+
+	return trimmed != "" && len(trimmed) < redactMinLength
+}